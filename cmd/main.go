@@ -2,13 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"shraga/internal/api"
+	"shraga/internal/archive"
 	"shraga/internal/config"
 	"shraga/internal/db"
 	"shraga/internal/logging"
+	"shraga/internal/monitor"
 	"shraga/internal/monitor/manager"
+	"shraga/internal/notify"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/samber/lo"
 )
@@ -17,16 +28,230 @@ func main() {
 	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancelCtx()
 
+	validate := flag.String("validate", "", "validate the monitors file at this path, without applying it, and exit")
+	flag.Parse()
+
 	cfg := config.LoadConfig()
 
-	logging.Initialize(cfg.Env == "prod")
+	logging.Initialize(cfg.Env == "prod", cfg.LogFormat)
 	logging.Logger.Info("Logger initialized")
 	defer logging.Logger.Sync()
+	if cfg.LogLevel != "" {
+		if err := logging.SetLevel(cfg.LogLevel); err != nil {
+			logging.Logger.Sugar().Errorf("invalid LOG_LEVEL: %v", err)
+		}
+	}
+
+	var dbOpts []db.Option
+	if cfg.ReplicaDSN != "" {
+		dbOpts = append(dbOpts, db.WithReplica(cfg.ReplicaDSN))
+	}
+	if cfg.ArchiveBucket != "" {
+		archiver := lo.Must(archive.NewS3Archiver(archive.S3Config{
+			Endpoint:  cfg.ArchiveEndpoint,
+			Region:    cfg.ArchiveRegion,
+			Bucket:    cfg.ArchiveBucket,
+			Prefix:    cfg.ArchivePrefix,
+			AccessKey: cfg.ArchiveAccessKey,
+			SecretKey: cfg.ArchiveSecretKey,
+			Insecure:  cfg.ArchiveInsecure,
+		}))
+		dbOpts = append(dbOpts, db.WithArchiver(archiver))
+	}
+	monitor.SetAllowedValidatorCommands(cfg.ValidatorCommands)
+	monitor.SetTransportLimits(monitor.TransportLimits{
+		MaxIdleConns:        cfg.HttpMaxIdleConns,
+		MaxIdleConnsPerHost: cfg.HttpMaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.HttpMaxConnsPerHost,
+	})
+	monitor.SetDNSCacheTTL(cfg.DNSCacheTTL)
+	monitor.SetDefaultInterval(cfg.DefaultInterval)
+	monitor.SetTargetNetworks(cfg.TargetAllowedNetworks, cfg.TargetDeniedNetworks)
+
+	notifiers := make(map[string]notify.Notifier)
+	if cfg.OpsgenieAPIKey != "" {
+		notifiers["opsgenie"] = lo.Must(notify.NewOpsgenieNotifier(cfg.OpsgenieAPIKey, cfg.OpsgenieRegion))
+	}
+	if cfg.SlackWebhookURL != "" {
+		notifiers["slack"] = notify.NewSlackNotifier(cfg.SlackWebhookURL)
+	}
+	if cfg.WebhookURL != "" {
+		notifiers["webhook"] = lo.Must(notify.NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookHeaders, cfg.WebhookPayloadTemplate))
+	}
+	if cfg.SMTPHost != "" {
+		notifiers["email"] = lo.Must(notify.NewEmailNotifier(notify.EmailConfig{
+			Host:            cfg.SMTPHost,
+			Port:            cfg.SMTPPort,
+			Username:        cfg.SMTPUsername,
+			Password:        cfg.SMTPPassword,
+			TLS:             cfg.SMTPTLS,
+			From:            cfg.EmailFrom,
+			To:              cfg.EmailTo,
+			SubjectTemplate: cfg.EmailSubjectTemplate,
+			BodyTemplate:    cfg.EmailBodyTemplate,
+		}))
+	}
+	monitor.SetNotifierNames(slices.Collect(maps.Keys(notifiers)))
+
+	if *validate != "" {
+		os.Exit(validateMonitors(*validate))
+	}
+
+	gormDB := lo.Must(db.NewGormDb(cfg.DSN, dbOpts...))
+
+	if cfg.MonitorsFile != "" {
+		syncMonitors(ctx, gormDB, cfg)
+	}
+
+	mgrOpts := []manager.Option{
+		manager.WithWorkers(cfg.Workers),
+		manager.WithTickInterval(cfg.TickInterval),
+		manager.WithResultRetention(cfg.ResultRetention),
+		manager.WithResultSampling(cfg.AggregateResults, cfg.RawRetention),
+		manager.WithMaxChecksPerSecond(cfg.MaxChecksPerSecond),
+		manager.WithCheckTimeout(cfg.CheckTimeout),
+	}
+	if cfg.LeaderElection {
+		mgrOpts = append(mgrOpts, manager.WithLeaderElection(replicaID(), cfg.LeaderLeaseTTL))
+	}
+	if cfg.DegradedMode {
+		mgrOpts = append(mgrOpts, manager.WithDegradedMode(cfg.DegradedBufferSize))
+	}
+	if cfg.ResultSinkDSN != "" {
+		mgrOpts = append(mgrOpts, manager.WithResultSinks(lo.Must(db.NewResultSink(cfg.ResultSinkDSN))))
+	}
+	for name, notifier := range notifiers {
+		mgrOpts = append(mgrOpts, manager.WithNotifier(name, notifier))
+	}
+	monitorMgr := manager.NewManager(gormDB, mgrOpts...)
 
-	gormDB := lo.Must(db.NewGormDb(cfg.DSN))
+	apiOpts := []api.Option{
+		api.WithHealthCheck("scheduler", monitorMgr.Healthy),
+		api.WithOpenMetrics(cfg.MetricsOpenMetrics),
+		api.WithResultIngestion(cfg.IngestToken, monitorMgr.Ingest),
+		api.WithAdminToken(cfg.AdminToken),
+	}
+	for name, notifier := range notifiers {
+		apiOpts = append(apiOpts, api.WithNotifier(name, notifier))
+	}
+	apiServer := api.NewServer(gormDB, apiOpts...)
+	srv := &http.Server{Addr: cfg.HttpAddr, Handler: apiServer}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Logger.Sugar().Errorf("http server failed: %v", err)
+		}
+	}()
 
-	monitorMgr := manager.NewManager(gormDB)
 	go monitorMgr.Run(ctx)
-	<-ctx.Done()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-hup:
+			cfg = reloadConfig(cfg, monitorMgr)
+		}
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		logging.Logger.Sugar().Errorf("failed to shut down http server: %v", err)
+	}
 	logging.Logger.Info("exiting")
 }
+
+// replicaID identifies this process among the replicas sharing the database.
+func replicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// syncMonitors upserts the valid monitors defined in the configured file.
+// Failures are logged and don't prevent startup.
+func syncMonitors(ctx context.Context, database db.Database, cfg config.Config) {
+	monitors, err := config.LoadMonitors(cfg.MonitorsFile)
+	if err != nil {
+		logging.Logger.Sugar().Errorf("failed to load monitors file: %v", err)
+	}
+	if len(monitors) == 0 {
+		return
+	}
+
+	if err := config.SyncMonitors(ctx, database, monitors, cfg.SyncWorkers); err != nil {
+		logging.Logger.Sugar().Errorf("monitors sync finished with errors: %v", err)
+		return
+	}
+	logging.Logger.Sugar().Infof("synced %d monitors", len(monitors))
+}
+
+// validateMonitors validates the monitors file at path, printing the problems
+// of each entry. It returns the exit status, 1 when the file isn't valid.
+func validateMonitors(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read monitors file: %v\n", err)
+		return 1
+	}
+	problems, err := config.ValidateMonitors(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid monitors file %s: %v\n", path, err)
+		return 1
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "entry %d (monitor %d): %s\n", problem.Entry, problem.ID, problem.Error)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
+
+// reloadable is the part of the manager that reloadConfig changes.
+type reloadable interface {
+	SetTickInterval(time.Duration)
+	SetWorkers(int)
+}
+
+// reloadConfig re-reads the configuration, including CONFIG_FILE, and applies
+// the settings that can change without a restart. It returns the
+// configuration now in effect.
+func reloadConfig(current config.Config, monitorMgr reloadable) config.Config {
+	logger := logging.Logger.Sugar()
+	logger.Info("reloading configuration")
+
+	next, err := config.Parse()
+	if err != nil {
+		logger.Errorf("failed to reload configuration, keeping the current one: %v", err)
+		return current
+	}
+
+	if next.LogLevel != current.LogLevel && next.LogLevel != "" {
+		if err := logging.SetLevel(next.LogLevel); err != nil {
+			logger.Errorf("invalid LOG_LEVEL, keeping log level %s: %v", logging.Level(), err)
+		} else {
+			logger.Infof("log level changed from %q to %q", current.LogLevel, next.LogLevel)
+			current.LogLevel = next.LogLevel
+		}
+	}
+
+	if next.TickInterval != current.TickInterval {
+		monitorMgr.SetTickInterval(next.TickInterval)
+		logger.Infof("tick interval changed from %s to %s", current.TickInterval, next.TickInterval)
+		current.TickInterval = next.TickInterval
+	}
+
+	if next.Workers != current.Workers {
+		monitorMgr.SetWorkers(next.Workers)
+		logger.Infof("workers changed from %d to %d", current.Workers, next.Workers)
+		current.Workers = next.Workers
+	}
+
+	// Other settings only take effect on restart
+	return current
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shraga/internal/config"
+	"shraga/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+type fakeReloadable struct {
+	tickInterval time.Duration
+	workers      int
+}
+
+func (f *fakeReloadable) SetTickInterval(d time.Duration) { f.tickInterval = d }
+func (f *fakeReloadable) SetWorkers(n int)                { f.workers = n }
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shraga.env")
+	require.NoError(t, os.WriteFile(path, []byte("TICK_INTERVAL=1s\nMONITOR_WORKERS=10\n"), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("MONITOR_WORKERS", "4")
+	defer func(level zapcore.Level) { logging.SetLevel(level.String()) }(logging.Level())
+
+	cfg, err := config.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.Workers, "the file should override the environment")
+
+	// The file is edited, then SIGHUP received
+	require.NoError(t, os.WriteFile(path, []byte("# Busier\nTICK_INTERVAL=5s\nMONITOR_WORKERS=25\nLOG_LEVEL=warn\n"), 0o600))
+	mgr := &fakeReloadable{}
+	cfg = reloadConfig(cfg, mgr)
+	assert.Equal(t, 5*time.Second, cfg.TickInterval)
+	assert.Equal(t, 25, cfg.Workers)
+	assert.Equal(t, &fakeReloadable{tickInterval: 5 * time.Second, workers: 25}, mgr)
+	assert.Equal(t, zapcore.WarnLevel, logging.Level())
+
+	// A broken file keeps the configuration in effect
+	require.NoError(t, os.WriteFile(path, []byte("MONITOR_WORKERS\n"), 0o600))
+	mgr = &fakeReloadable{}
+	assert.Equal(t, cfg, reloadConfig(cfg, mgr))
+	assert.Zero(t, *mgr)
+}
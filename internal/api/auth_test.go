@@ -0,0 +1,61 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "admin-token"
+
+// adminRequest returns a POST request bearing the test admin token.
+func adminRequest(target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestServer_AdminRoutes(t *testing.T) {
+	routes := []string{
+		"/notifiers/opsgenie/test",
+		"/ssl/recheck",
+		"/config/validate",
+		"/monitors/enabled",
+		"/monitors/1/unlock",
+		"/monitors/1/snooze?duration=2h",
+	}
+
+	database := &monitorsDatabase{}
+	server := NewServer(database, WithAdminToken(testAdminToken))
+	for _, route := range routes {
+		for _, authorization := range []string{"", "Bearer wrong-token", testAdminToken} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, route, nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			server.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, route)
+		}
+	}
+	assert.Empty(t, database.unlocked)
+	assert.Empty(t, database.snoozed)
+
+	// Not served without a token
+	server = NewServer(database)
+	for _, route := range routes {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, adminRequest(route, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, route)
+	}
+
+	// Reads and health checks stay open
+	for _, route := range []string{"/metrics", "/healthz"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, route, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, route)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"shraga/internal/config"
+)
+
+// maxConfigBody bounds the monitors file a validation request may send
+const maxConfigBody = 10 << 20
+
+// validateConfig checks a monitors file, sent as the body, without applying
+// it. Every entry is validated as it would be saved, listing the problems of
+// each.
+func (s *Server) validateConfig(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+
+	problems, err := config.ValidateMonitors(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid monitors file: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"valid":  len(problems) == 0,
+		"errors": problems,
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_validateConfig(t *testing.T) {
+	server := NewServer(&monitorsDatabase{}, WithAdminToken(testAdminToken))
+
+	rec := httptest.NewRecorder()
+	body := `[
+		{"ID": 1, "Type": 1, "Address": "https://example.com", "RequestMethod": "GET"},
+		{"ID": 2, "Type": 1, "Address": "https://example.com", "RequestMethod": "GET", "ResponseMatchMode": "regex"}
+	]`
+	server.ServeHTTP(rec, adminRequest("/config/validate", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"valid": false, "errors": [{"entry": 1, "id": 2, "error": "unknown response match mode \"regex\", must be exact, contains or not_contains"}]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/config/validate", strings.NewReader(`[{"ID": 1, "Type": 1, "Address": "https://example.com"}]`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"valid": true, "errors": []}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/config/validate", strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,19 @@
+package api
+
+import "net/http"
+
+// healthz reports the state of every registered health check, with status
+// 503 if any of them fails.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	checks := make(map[string]string, len(s.health))
+	for name, check := range s.health {
+		if err := check(); err != nil {
+			status = http.StatusServiceUnavailable
+			checks[name] = err.Error()
+		} else {
+			checks[name] = "ok"
+		}
+	}
+	writeJSON(w, status, checks)
+}
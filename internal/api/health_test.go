@@ -0,0 +1,26 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_healthz(t *testing.T) {
+	var schedulerErr error
+	s := NewServer(&fakeDatabase{}, WithHealthCheck("scheduler", func() error { return schedulerErr }))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"scheduler": "ok"}`, rec.Body.String())
+
+	schedulerErr = errors.New("scheduler stalled")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"scheduler": "scheduler stalled"}`, rec.Body.String())
+}
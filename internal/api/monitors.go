@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"shraga/internal/config"
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"strconv"
+	"time"
+)
+
+type downMonitor struct {
+	MonitorID       uint      `json:"monitorId"`
+	Type            string    `json:"type"`
+	DownSince       time.Time `json:"downSince"`
+	DowntimeSeconds float64   `json:"downtimeSeconds"`
+	Reason          string    `json:"reason"`
+	Error           string    `json:"error,omitempty"`
+	OwnerTeam       string    `json:"ownerTeam,omitempty"`
+	OwnerEmail      string    `json:"ownerEmail,omitempty"`
+	// Checks in a row that were down
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+}
+
+// downMonitors lists the monitors currently down, longest down first, as the
+// first screen for triage.
+func (s *Server) downMonitors(w http.ResponseWriter, r *http.Request) {
+	statuses, err := s.db.GetDownMonitors(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := make([]downMonitor, 0, len(statuses))
+	for _, status := range statuses {
+		resp = append(resp, downMonitor{
+			MonitorID:       status.MonitorID,
+			Type:            status.Type.String(),
+			DownSince:       status.DownSince,
+			DowntimeSeconds: status.Downtime.Seconds(),
+			Reason:          status.Reason.String(),
+			Error:           status.ErrorMsg,
+			OwnerTeam:       status.OwnerTeam,
+			OwnerEmail:      status.OwnerEmail,
+
+			ConsecutiveFailures: status.ConsecutiveFailures,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// monitorsByOwner returns the configuration of every monitor owned by the
+// team or email given as owner, in the format of the monitors file.
+func (s *Server) monitorsByOwner(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		writeError(w, http.StatusBadRequest, errors.New("owner is required"))
+		return
+	}
+
+	monitors, err := s.db.GetMonitorsByOwner(r.Context(), owner)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := make([]map[string]any, 0, len(monitors))
+	for _, mon := range monitors {
+		exported, err := config.ExportMonitor(mon)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp = append(resp, exported)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type setEnabledRequest struct {
+	Tags    map[string]string `json:"tags"`
+	Enabled *bool             `json:"enabled"`
+}
+
+// setEnabledByTag enables or disables every monitor carrying all the given
+// tags, e.g. during a regional maintenance, and returns how many matched.
+func (s *Server) setEnabledByTag(w http.ResponseWriter, r *http.Request) {
+	var req setEnabledRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if len(req.Tags) == 0 || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, errors.New("tags and enabled are required"))
+		return
+	}
+
+	affected, err := s.db.SetEnabledByTag(r.Context(), req.Tags, *req.Enabled)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logging.Logger.Sugar().Infof("set enabled=%t on %d monitors tagged %v, requested by %s", *req.Enabled, affected, req.Tags, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]int64{"affected": affected})
+}
+
+// unlockMonitor clears a stuck monitor lock, as an escape hatch for operators
+// without database access.
+func (s *Server) unlockMonitor(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	logging.Logger.Sugar().Warnf("monitor %d unlock requested by %s", id, r.RemoteAddr)
+	if err := s.db.ForceUnlock(r.Context(), id); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snoozeMonitor suppresses the notifications of a monitor for the given
+// duration, e.g. while on-call handles a known outage. Checks keep running. A
+// zero duration ends the snooze.
+func (s *Server) snoozeMonitor(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	v := r.URL.Query().Get("duration")
+	duration, err := time.ParseDuration(v)
+	if err != nil || duration < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %q", v))
+		return
+	}
+
+	until := time.Now().Add(duration)
+	logging.Logger.Sugar().Infof("monitor %d snoozed for %s, requested by %s", id, duration, r.RemoteAddr)
+	if err := s.db.SnoozeMonitor(r.Context(), id, until); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]time.Time{"snoozeUntil": until})
+}
+
+// exportMonitor returns the configuration of a monitor in the format of the
+// monitors file, so it can be checked in and synced back.
+func (s *Server) exportMonitor(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	mon, err := s.db.GetMonitor(r.Context(), id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	exported, err := config.ExportMonitor(mon)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, exported)
+}
+
+type monitorSummary struct {
+	MonitorID    uint      `json:"monitorId"`
+	Type         string    `json:"type"`
+	Enabled      bool      `json:"enabled"`
+	LastResult   string    `json:"lastResult"`
+	LastCheck    time.Time `json:"lastCheck"`
+	LatencyEMAMs float64   `json:"latencyEmaMs"` // Typical latency of checks that weren't down
+	// Checks in a row that were down
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+}
+
+// monitorSummary returns the latest state of a monitor, including its
+// smoothed latency, without aggregating its results.
+func (s *Server) monitorSummary(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	mon, err := s.db.GetMonitor(r.Context(), id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	base := mon.GetBase()
+	writeJSON(w, http.StatusOK, monitorSummary{
+		MonitorID:    base.ID,
+		Type:         base.Type.String(),
+		Enabled:      base.Enabled,
+		LastResult:   base.LastResult.String(),
+		LastCheck:    base.LastMonitorTime,
+		LatencyEMAMs: base.LatencyEMA,
+
+		ConsecutiveFailures: base.ConsecutiveFailures,
+	})
+}
+
+// monitorID parses the id path value, writing a 400 response when invalid.
+func monitorID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid monitor id: %q", r.PathValue("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeDBError responds 404 to unknown monitors, 400 to invalid ranges and
+// 500 otherwise.
+func writeDBError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrMonitorNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidRange) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
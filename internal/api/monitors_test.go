@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shraga/internal/db"
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type monitorsDatabase struct {
+	db.Database
+	unlocked []uint
+	snoozed  map[uint]time.Time
+	tags     map[string]string
+	enabled  bool
+}
+
+func (m *monitorsDatabase) SetEnabledByTag(_ context.Context, tags map[string]string, enabled bool) (int64, error) {
+	m.tags, m.enabled = tags, enabled
+	return 3, nil
+}
+
+func TestServer_setEnabledByTag(t *testing.T) {
+	database := &monitorsDatabase{enabled: true}
+	server := NewServer(database, WithAdminToken(testAdminToken))
+
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"tags": {"region": "eu"}, "enabled": false}`)
+	server.ServeHTTP(rec, adminRequest("/monitors/enabled", body))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"affected": 3}`, rec.Body.String())
+	assert.Equal(t, map[string]string{"region": "eu"}, database.tags)
+	assert.False(t, database.enabled)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/monitors/enabled", strings.NewReader(`{"enabled": false}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func (u *monitorsDatabase) ForceUnlock(_ context.Context, id uint) error {
+	if id != 1 {
+		return fmt.Errorf("%w: %d", db.ErrMonitorNotFound, id)
+	}
+	u.unlocked = append(u.unlocked, id)
+	return nil
+}
+
+func (m *monitorsDatabase) SnoozeMonitor(_ context.Context, id uint, until time.Time) error {
+	if id != 1 {
+		return fmt.Errorf("%w: %d", db.ErrMonitorNotFound, id)
+	}
+	m.snoozed = map[uint]time.Time{id: until}
+	return nil
+}
+
+func (m *monitorsDatabase) GetMonitor(_ context.Context, id uint) (monitor.Monitorer, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("%w: %d", db.ErrMonitorNotFound, id)
+	}
+	return &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP, IsMonitoring: true, LastResult: monitor.ResultUp, LatencyEMA: 42.5},
+		Address:     "https://example.com",
+	}, nil
+}
+
+func (m *monitorsDatabase) GetDownMonitors(context.Context) ([]db.MonitorStatus, error) {
+	return []db.MonitorStatus{{
+		MonitorID: 4,
+		Type:      monitor.TypeTCP,
+		DownSince: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+		Downtime:  90 * time.Second,
+		Reason:    monitor.ReasonConnRefused,
+		ErrorMsg:  "closed ports: 22",
+
+		ConsecutiveFailures: 5,
+	}}, nil
+}
+
+func TestServer_downMonitors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(&monitorsDatabase{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/down", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.JSONEq(t, `[{
+		"monitorId": 4,
+		"type": "TCP",
+		"downSince": "2020-01-01T12:00:00Z",
+		"downtimeSeconds": 90,
+		"reason": "ConnRefused",
+		"error": "closed ports: 22",
+		"consecutiveFailures": 5
+	}]`, rec.Body.String())
+}
+
+func TestServer_exportMonitor(t *testing.T) {
+	server := NewServer(&monitorsDatabase{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/export", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var exported map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &exported))
+	assert.Equal(t, "HTTP", exported["Type"])
+	assert.Equal(t, "https://example.com", exported["Address"])
+	assert.NotContains(t, exported, "IsMonitoring")
+	assert.NotContains(t, exported, "LatencyEMA")
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/2/export", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_monitorSummary(t *testing.T) {
+	server := NewServer(&monitorsDatabase{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/summary", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"monitorId": 1,
+		"type": "HTTP",
+		"enabled": false,
+		"lastResult": "Up",
+		"lastCheck": "0001-01-01T00:00:00Z",
+		"latencyEmaMs": 42.5,
+		"consecutiveFailures": 0
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/2/summary", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_snoozeMonitor(t *testing.T) {
+	database := &monitorsDatabase{}
+	server := NewServer(database, WithAdminToken(testAdminToken))
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/monitors/1/snooze?duration=2h", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), database.snoozed[1], time.Minute)
+
+	for _, target := range []string{"/monitors/1/snooze", "/monitors/1/snooze?duration=-1h"} {
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, adminRequest(target, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/monitors/2/snooze?duration=2h", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_unlockMonitor(t *testing.T) {
+	database := &monitorsDatabase{}
+	server := NewServer(database, WithAdminToken(testAdminToken))
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/monitors/1/unlock", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []uint{1}, database.unlocked)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/monitors/2/unlock", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/monitors/abc/unlock", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func (m *monitorsDatabase) GetTimeseries(_ context.Context, id uint, from, to time.Time, step time.Duration) ([]db.TimeseriesBucket, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("%w: %d", db.ErrMonitorNotFound, id)
+	}
+	if step != 10*time.Minute {
+		return nil, fmt.Errorf("%w: unexpected step %s", db.ErrInvalidRange, step)
+	}
+	return []db.TimeseriesBucket{
+		{Start: from, Count: 2, UpCount: 1, DownCount: 1, AvgLatency: 20, MaxLatency: 30},
+		{Start: from.Add(step)},
+	}, nil
+}
+
+func TestServer_timeseries(t *testing.T) {
+	server := NewServer(&monitorsDatabase{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/timeseries?step=10m&from=2020-01-01T12:00:00Z&to=2020-01-01T12:20:00Z", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"time": "2020-01-01T12:00:00Z", "count": 2, "up": 1, "down": 1, "warn": 0, "avgLatencyMs": 20, "maxLatencyMs": 30},
+		{"time": "2020-01-01T12:10:00Z", "count": 0, "up": 0, "down": 0, "warn": 0, "avgLatencyMs": null, "maxLatencyMs": null}
+	]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/timeseries?step=1s", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/timeseries?from=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/2/timeseries?step=10m", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func (m *monitorsDatabase) GetReasonBreakdown(_ context.Context, id uint, from, to time.Time) (map[monitor.Reason]int, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("%w: %d", db.ErrMonitorNotFound, id)
+	}
+	if to.Sub(from) != 7*24*time.Hour {
+		return nil, fmt.Errorf("%w: unexpected range %s", db.ErrInvalidRange, to.Sub(from))
+	}
+	return map[monitor.Reason]int{monitor.ReasonTimeout: 5, monitor.ReasonNone: 1}, nil
+}
+
+func TestServer_reasonBreakdown(t *testing.T) {
+	server := NewServer(&monitorsDatabase{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/reasons", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"Timeout": 5, "None": 1}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/reasons?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/1/reasons?to=tomorrow", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors/2/reasons", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func (m *monitorsDatabase) GetMonitorsByOwner(_ context.Context, owner string) ([]monitor.Monitorer, error) {
+	if owner != "payments" {
+		return nil, nil
+	}
+	return []monitor.Monitorer{&monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP, OwnerTeam: "payments"},
+		Address:     "https://example.com",
+	}}, nil
+}
+
+func TestServer_monitorsByOwner(t *testing.T) {
+	server := NewServer(&monitorsDatabase{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors?owner=payments", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var monitors []map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &monitors))
+	require.Len(t, monitors, 1)
+	assert.Equal(t, "payments", monitors[0]["OwnerTeam"])
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors?owner=search", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
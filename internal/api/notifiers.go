@@ -0,0 +1,26 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"shraga/internal/logging"
+)
+
+// testNotifier sends a test message through a notifier, so operators can
+// verify its configuration without waiting for an incident. A failure is
+// reported with status 502 and the notifier's error.
+func (s *Server) testNotifier(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	notifier, ok := s.notifiers[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown notifier %q", name))
+		return
+	}
+
+	logging.Logger.Sugar().Infof("test notification through %s requested by %s", name, r.RemoteAddr)
+	if err := notifier.TestNotify(r.Context()); err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("test notification through %s failed: %w", name, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shraga/internal/notify"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotifier struct {
+	notify.Notifier
+	err error
+}
+
+func (f *fakeNotifier) TestNotify(context.Context) error { return f.err }
+
+func TestServer_testNotifier(t *testing.T) {
+	server := NewServer(&monitorsDatabase{},
+		WithAdminToken(testAdminToken),
+		WithNotifier("opsgenie", &fakeNotifier{}),
+		WithNotifier("broken", &fakeNotifier{err: errors.New("opsgenie responded 401: invalid key")}),
+	)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/notifiers/opsgenie/test", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/notifiers/broken/test", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.JSONEq(t, `{"error": "test notification through broken failed: opsgenie responded 401: invalid key"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, adminRequest("/notifiers/slack/test", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
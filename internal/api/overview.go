@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"shraga/internal/monitor"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultOverviewWindow = 24 * time.Hour
+	defaultOverviewLimit  = 10
+)
+
+type overviewResponse struct {
+	Up            int               `json:"up"`
+	Down          int               `json:"down"`
+	Warn          int               `json:"warn"`
+	Unknown       int               `json:"unknown"`
+	Worst         []downtimeSummary `json:"worst"`
+	OpenIncidents []incidentSummary `json:"openIncidents"`
+}
+
+type downtimeSummary struct {
+	MonitorID       uint    `json:"monitorId"`
+	DowntimeSeconds float64 `json:"downtimeSeconds"`
+}
+
+type incidentSummary struct {
+	ID        uint      `json:"id"`
+	MonitorID uint      `json:"monitorId"`
+	StartedAt time.Time `json:"startedAt"`
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// overview returns the fleet health in one call for wall displays: monitor
+// counts by latest result, the monitors with the most downtime within the
+// window (24h by default) and the open incidents.
+func (s *Server) overview(w http.ResponseWriter, r *http.Request) {
+	window := defaultOverviewWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window: %q", v))
+			return
+		}
+		window = parsed
+	}
+
+	limit := defaultOverviewLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %q", v))
+			return
+		}
+		limit = parsed
+	}
+
+	overview, err := s.db.GetOverview(r.Context(), time.Now().Add(-window), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := overviewResponse{
+		Up:            overview.Counts[monitor.ResultUp],
+		Down:          overview.Counts[monitor.ResultDown],
+		Warn:          overview.Counts[monitor.ResultWarn],
+		Unknown:       overview.Counts[monitor.ResultUnknown],
+		Worst:         make([]downtimeSummary, 0, len(overview.Worst)),
+		OpenIncidents: make([]incidentSummary, 0, len(overview.OpenIncidents)),
+	}
+	for _, worst := range overview.Worst {
+		resp.Worst = append(resp.Worst, downtimeSummary{
+			MonitorID:       worst.MonitorID,
+			DowntimeSeconds: worst.Downtime.Seconds(),
+		})
+	}
+	for _, incident := range overview.OpenIncidents {
+		resp.OpenIncidents = append(resp.OpenIncidents, incidentSummary{
+			ID:        incident.ID,
+			MonitorID: incident.MonitorID,
+			StartedAt: incident.StartedAt,
+			Reason:    incident.Reason.String(),
+			Error:     incident.ErrorMsg,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
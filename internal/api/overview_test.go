@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shraga/internal/db"
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type overviewDatabase struct {
+	fakeDatabase
+	since time.Time
+	limit int
+}
+
+func (o *overviewDatabase) GetOverview(_ context.Context, since time.Time, limit int) (db.Overview, error) {
+	o.since, o.limit = since, limit
+	return db.Overview{
+		Counts: map[monitor.Result]int{monitor.ResultUp: 7, monitor.ResultDown: 2, monitor.ResultWarn: 1},
+		Worst:  []db.MonitorDowntime{{MonitorID: 3, Downtime: 90 * time.Second}},
+		OpenIncidents: []monitor.Incident{{
+			ID:        5,
+			MonitorID: 3,
+			StartedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Reason:    monitor.ReasonTimeout,
+			ErrorMsg:  "context deadline exceeded",
+		}},
+	}, nil
+}
+
+func TestServer_overview(t *testing.T) {
+	database := &overviewDatabase{}
+
+	rec := httptest.NewRecorder()
+	NewServer(database).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/overview?window=1h&limit=3", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 3, database.limit)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), database.since, time.Minute)
+	assert.JSONEq(t, `{
+		"up": 7, "down": 2, "warn": 1, "unknown": 0,
+		"worst": [{"monitorId": 3, "downtimeSeconds": 90}],
+		"openIncidents": [{"id": 5, "monitorId": 3, "startedAt": "2020-01-01T00:00:00Z", "reason": "Timeout", "error": "context deadline exceeded"}]
+	}`, rec.Body.String())
+}
+
+func TestServer_overview_InvalidWindow(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(&overviewDatabase{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/overview?window=soon", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
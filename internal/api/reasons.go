@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+const defaultReasonsRange = 7 * 24 * time.Hour
+
+// reasonBreakdown counts the results of a monitor that weren't up by reason,
+// between from and to (RFC 3339), defaulting to the last week. Results failed
+// without a specific reason are counted as None.
+func (s *Server) reasonBreakdown(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+	from, to, ok := timeRange(w, r, defaultReasonsRange)
+	if !ok {
+		return
+	}
+
+	breakdown, err := s.db.GetReasonBreakdown(r.Context(), id, from, to)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	resp := make(map[string]int, len(breakdown))
+	for reason, count := range breakdown {
+		resp[reason.String()] = count
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"shraga/internal/monitor"
+	"time"
+)
+
+// maxIngestBody bounds the body of a result ingestion request
+const maxIngestBody = 1 << 20
+
+// ingestResults stores results reported by external probes for a monitor, as
+// a single result or an array of them. Results are validated and recorded
+// together, all or none. While a check of the monitor runs, the request is
+// answered 409 Conflict, to be retried.
+func (s *Server) ingestResults(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := decodeExternalResults(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := time.Now()
+	for i := range results {
+		if err := results[i].Validate(now); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("result %d: %w", i, err))
+			return
+		}
+	}
+
+	mon, err := s.db.GetMonitor(r.Context(), id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	responses := make([]monitor.MonitorResponser, 0, len(results))
+	for _, result := range results {
+		response, err := result.Response(mon)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		responses = append(responses, response)
+	}
+
+	if err := s.ingest(r.Context(), id, responses); err != nil {
+		if errors.Is(err, db.ErrMonitorBusy) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeDBError(w, err)
+		return
+	}
+	logging.Logger.Sugar().Infof("ingested %d results of monitor %d from %s", len(responses), id, r.RemoteAddr)
+	writeJSON(w, http.StatusCreated, map[string]int{"ingested": len(responses)})
+}
+
+// decodeExternalResults decodes either a single result or an array of them.
+func decodeExternalResults(body io.Reader) ([]monitor.ExternalResult, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+
+	var results []monitor.ExternalResult
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+	} else {
+		var result monitor.ExternalResult
+		if err := json.Unmarshal(trimmed, &result); err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, errors.New("no results")
+	}
+	return results, nil
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shraga/internal/db"
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ingestResults(t *testing.T) {
+	var ingested []monitor.MonitorResponser
+	ingestErr := error(nil)
+	server := NewServer(&monitorsDatabase{}, WithResultIngestion("probe-token", func(_ context.Context, monitorID uint, results []monitor.MonitorResponser) error {
+		assert.Equal(t, uint(1), monitorID)
+		ingested = append(ingested, results...)
+		return ingestErr
+	}))
+
+	rec := httptest.NewRecorder()
+	body := `[
+		{"result": "up", "latencyMs": 80, "timestamp": "2020-01-01T12:01:00Z"},
+		{"result": "down", "timestamp": "2020-01-01T12:00:00Z", "error": "timeout at edge fra"}
+	]`
+	server.ServeHTTP(rec, ingestRequest("/monitors/1/results", body))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"ingested": 2}`, rec.Body.String())
+	require.Len(t, ingested, 2)
+	assert.Equal(t, int64(80), ingested[0].(*monitor.HttpResponse).Latency)
+	down := ingested[1].(*monitor.HttpResponse)
+	assert.Equal(t, monitor.ResultDown, down.Result)
+	assert.Equal(t, "timeout at edge fra", down.ErrorMsg)
+	assert.Equal(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), down.ResponseTime)
+
+	// A single result
+	ingested = nil
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, ingestRequest("/monitors/1/results", `{"result": "warn"}`))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Len(t, ingested, 1)
+	assert.Equal(t, monitor.ResultWarn, ingested[0].GetBaseMonitorResponse().Result)
+	assert.False(t, ingested[0].GetBaseMonitorResponse().ResponseTime.IsZero())
+
+	ingested = nil
+	for _, body := range []string{
+		`{"latencyMs": 10}`,
+		`{"result": "up", "latencyMs": -1}`,
+		`{"result": "up", "timestamp": "2999-01-01T00:00:00Z"}`,
+		`[]`,
+		`not json`,
+	} {
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, ingestRequest("/monitors/1/results", body))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	assert.Empty(t, ingested)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, ingestRequest("/monitors/2/results", `{"result": "up"}`))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	ingestErr = errors.New("database unavailable")
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, ingestRequest("/monitors/1/results", `{"result": "up"}`))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	// A check of the monitor is running, the probe should retry
+	ingestErr = fmt.Errorf("%w: 1", db.ErrMonitorBusy)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, ingestRequest("/monitors/1/results", `{"result": "up"}`))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+// ingestRequest returns a result ingestion request bearing the test token.
+func ingestRequest(target, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer probe-token")
+	return req
+}
+
+func TestServer_ingestResults_Unauthenticated(t *testing.T) {
+	// Ingesting records the results and notifies their transitions
+	var ingests int
+	server := NewServer(&monitorsDatabase{}, WithResultIngestion("probe-token", func(context.Context, uint, []monitor.MonitorResponser) error {
+		ingests++
+		return nil
+	}))
+
+	for _, authorization := range []string{"", "Bearer wrong-token", "probe-token", "Basic cHJvYmUtdG9rZW4="} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/monitors/1/results", strings.NewReader(`{"result": "down"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		server.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, authorization)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	}
+	assert.Zero(t, ingests, "unauthenticated results shouldn't be ingested nor notified")
+}
+
+func TestServer_ingestResults_Disabled(t *testing.T) {
+	ingest := func(context.Context, uint, []monitor.MonitorResponser) error { return nil }
+	for _, server := range []*Server{
+		NewServer(&monitorsDatabase{}),
+		// Not served without a token
+		NewServer(&monitorsDatabase{}, WithResultIngestion("", ingest)),
+	} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, ingestRequest("/monitors/1/results", `{"result": "up"}`))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"shraga/internal/metrics"
+	"shraga/internal/monitor"
+	"shraga/internal/notify"
+)
+
+// Server exposes shraga's HTTP API and metrics.
+type Server struct {
+	db          db.Database
+	mux         *http.ServeMux
+	health      map[string]func() error
+	notifiers   map[string]notify.Notifier
+	openMetrics bool
+	ingest      func(ctx context.Context, monitorID uint, results []monitor.MonitorResponser) error
+	ingestToken string
+	adminToken  string
+}
+
+// Option configures optional behaviour of Server.
+type Option func(*Server)
+
+// WithHealthCheck makes /healthz report unhealthy while check returns an
+// error.
+func WithHealthCheck(name string, check func() error) Option {
+	return func(s *Server) {
+		s.health[name] = check
+	}
+}
+
+// WithNotifier makes notifier testable at POST /notifiers/{name}/test.
+func WithNotifier(name string, notifier notify.Notifier) Option {
+	return func(s *Server) {
+		s.notifiers[name] = notifier
+	}
+}
+
+// WithResultIngestion accepts results reported by external probes at
+// POST /monitors/{id}/results, recording each request's results with one call
+// to ingest, e.g. Manager.Ingest. As they can page on-call, only requests
+// bearing token are accepted, and the route isn't served without one.
+func WithResultIngestion(token string, ingest func(ctx context.Context, monitorID uint, results []monitor.MonitorResponser) error) Option {
+	return func(s *Server) {
+		s.ingestToken = token
+		s.ingest = ingest
+	}
+}
+
+// WithAdminToken serves the routes changing state, e.g. snoozing a monitor,
+// to requests bearing token. They aren't served without one, as they share
+// the listener of /metrics.
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithOpenMetrics sets whether /metrics serves OpenMetrics to scrapers
+// accepting it. Enabled by default.
+func WithOpenMetrics(enabled bool) Option {
+	return func(s *Server) {
+		s.openMetrics = enabled
+	}
+}
+
+// NewServer returns new Server.
+func NewServer(db db.Database, opts ...Option) *Server {
+	s := &Server{
+		db:          db,
+		mux:         http.NewServeMux(),
+		health:      make(map[string]func() error),
+		notifiers:   make(map[string]notify.Notifier),
+		openMetrics: true,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.Handle("GET /metrics", metrics.Handler(s.openMetrics))
+	s.mux.HandleFunc("GET /healthz", s.healthz)
+	s.mux.HandleFunc("GET /overview", s.overview)
+	s.mux.HandleFunc("GET /monitors", s.monitorsByOwner)
+	s.mux.HandleFunc("GET /monitors/down", s.downMonitors)
+	s.mux.HandleFunc("GET /monitors/{id}/export", s.exportMonitor)
+	s.mux.HandleFunc("GET /monitors/{id}/summary", s.monitorSummary)
+	s.mux.HandleFunc("GET /monitors/{id}/timeseries", s.timeseries)
+	s.mux.HandleFunc("GET /monitors/{id}/reasons", s.reasonBreakdown)
+	if s.ingest != nil && s.ingestToken != "" {
+		s.mux.Handle("POST /monitors/{id}/results", requireToken(s.ingestToken, s.ingestResults))
+	}
+	if s.adminToken != "" {
+		s.mux.Handle("POST /notifiers/{name}/test", requireToken(s.adminToken, s.testNotifier))
+		s.mux.Handle("POST /ssl/recheck", requireToken(s.adminToken, s.recheckSSL))
+		s.mux.Handle("POST /config/validate", requireToken(s.adminToken, s.validateConfig))
+		s.mux.Handle("POST /monitors/enabled", requireToken(s.adminToken, s.setEnabledByTag))
+		s.mux.Handle("POST /monitors/{id}/unlock", requireToken(s.adminToken, s.unlockMonitor))
+		s.mux.Handle("POST /monitors/{id}/snooze", requireToken(s.adminToken, s.snoozeMonitor))
+	}
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Logger.Sugar().Warnf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"shraga/internal/monitor"
+	"sync"
+	"time"
+)
+
+// sslRecheckWorkers bounds how many certificates are checked concurrently.
+const sslRecheckWorkers = 10
+
+type sslRecheckResult struct {
+	MonitorID uint      `json:"monitorId"`
+	Address   string    `json:"address"`
+	Valid     bool      `json:"valid"`
+	Expiry    time.Time `json:"expiry"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// recheckSSL checks the certificate of every enabled HTTPS monitor right away
+// and returns their expiry dates, e.g. to confirm a mass renewal landed.
+func (s *Server) recheckSSL(w http.ResponseWriter, r *http.Request) {
+	monitors, err := s.db.GetEnabledMonitorsByType(r.Context(), monitor.TypeHTTP)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var httpsMonitors []*monitor.HttpMonitor
+	for _, mon := range monitors {
+		hm := mon.(*monitor.HttpMonitor)
+		if u, err := url.Parse(hm.Address); err == nil && u.Scheme == "https" {
+			httpsMonitors = append(httpsMonitors, hm)
+		}
+	}
+
+	results := make([]sslRecheckResult, len(httpsMonitors))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < sslRecheckWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				hm := httpsMonitors[idx]
+				ssl := hm.CheckSSL(r.Context())
+				results[idx] = sslRecheckResult{
+					MonitorID: hm.ID,
+					Address:   hm.Address,
+					Valid:     ssl.Valid,
+					Expiry:    ssl.Expiry,
+					Issuer:    ssl.Issuer,
+					Subject:   ssl.Subject,
+					Error:     ssl.Error,
+				}
+			}
+		}()
+	}
+	for idx := range httpsMonitors {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, results)
+}
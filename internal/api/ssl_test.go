@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shraga/internal/db"
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDatabase struct {
+	db.Database
+	monitors []monitor.Monitorer
+}
+
+func (f *fakeDatabase) GetEnabledMonitorsByType(_ context.Context, monitorType monitor.MonitorType) ([]monitor.Monitorer, error) {
+	return f.monitors, nil
+}
+
+func TestServer_recheckSSL(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+
+	database := &fakeDatabase{monitors: []monitor.Monitorer{
+		&monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 1}, Address: tlsServer.URL},
+		&monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 2}, Address: "http://example.com"},
+	}}
+
+	rec := httptest.NewRecorder()
+	NewServer(database, WithAdminToken(testAdminToken)).ServeHTTP(rec, adminRequest("/ssl/recheck", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var results []sslRecheckResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	require.Len(t, results, 1)
+	assert.Equal(t, uint(1), results[0].MonitorID)
+	assert.Equal(t, tlsServer.URL, results[0].Address)
+	// The test server's certificate isn't trusted
+	assert.False(t, results[0].Valid)
+}
+
+func TestServer_recheckSSL_ClientGone(t *testing.T) {
+	// Accepts connections and never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	database := &fakeDatabase{monitors: []monitor.Monitorer{
+		&monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 1}, Address: "https://" + listener.Addr().String()},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	NewServer(database, WithAdminToken(testAdminToken)).ServeHTTP(rec, adminRequest("/ssl/recheck", nil).WithContext(ctx))
+	assert.Less(t, time.Since(start), 2*time.Second, "the recheck should stop with the request")
+
+	var results []sslRecheckResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	require.Len(t, results, 1)
+	assert.False(t, results[0].Valid)
+	assert.NotEmpty(t, results[0].Error)
+}
+
+func TestServer_recheckSSL_MethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(&fakeDatabase{}, WithAdminToken(testAdminToken)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ssl/recheck", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
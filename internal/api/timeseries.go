@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTimeseriesStep  = 5 * time.Minute
+	defaultTimeseriesRange = 24 * time.Hour
+)
+
+type timeseriesBucket struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+	Up    int64     `json:"up"`
+	Down  int64     `json:"down"`
+	Warn  int64     `json:"warn"`
+	// Null for buckets without results
+	AvgLatencyMs *float64 `json:"avgLatencyMs"`
+	MaxLatencyMs *int64   `json:"maxLatencyMs"`
+}
+
+// timeRange parses the from and to query parameters (RFC 3339), defaulting to
+// the last defaultRange, and writes a 400 response when either is invalid.
+func timeRange(w http.ResponseWriter, r *http.Request, defaultRange time.Duration) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid to: %q", v))
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultRange)
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid from: %q", v))
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+	return from, to, true
+}
+
+// timeseries returns the results of a monitor bucketed by step between from
+// and to (RFC 3339), for dashboards covering long ranges.
+func (s *Server) timeseries(w http.ResponseWriter, r *http.Request) {
+	id, ok := monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	step := defaultTimeseriesStep
+	if v := query.Get("step"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid step: %q", v))
+			return
+		}
+		step = parsed
+	}
+
+	from, to, ok := timeRange(w, r, defaultTimeseriesRange)
+	if !ok {
+		return
+	}
+	buckets, err := s.db.GetTimeseries(r.Context(), id, from, to, step)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	resp := make([]timeseriesBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		entry := timeseriesBucket{
+			Time:  bucket.Start,
+			Count: bucket.Count,
+			Up:    bucket.UpCount,
+			Down:  bucket.DownCount,
+			Warn:  bucket.WarnCount,
+		}
+		if bucket.Count > 0 {
+			entry.AvgLatencyMs = &bucket.AvgLatency
+			entry.MaxLatencyMs = &bucket.MaxLatency
+		}
+		resp = append(resp, entry)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config locates the bucket of an S3Archiver.
+type S3Config struct {
+	Endpoint  string // host[:port], e.g. s3.amazonaws.com
+	Region    string
+	Bucket    string
+	Prefix    string // Prepended to every object key
+	AccessKey string
+	SecretKey string
+	Insecure  bool // Plain HTTP, e.g. for a local MinIO
+}
+
+// S3Archiver archives results to an S3-compatible object store, as gzipped
+// JSON lines partitioned by date and monitor:
+// <prefix>/results/date=2006-01-02/monitor=<id>/<first id>-<last id>.json.gz
+type S3Archiver struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Archiver returns an S3Archiver writing to the bucket of cfg.
+func NewS3Archiver(cfg S3Config) (*S3Archiver, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("archive endpoint and bucket are required")
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Archiver{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+// Archive uploads results as one object. Its key is derived from the IDs of
+// the results, so archiving the same results again overwrites it.
+func (a *S3Archiver) Archive(ctx context.Context, monitorID uint, day time.Time, results []map[string]any) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	key := path.Join(a.prefix, "results",
+		"date="+day.UTC().Format(time.DateOnly),
+		fmt.Sprintf("monitor=%d", monitorID),
+		fmt.Sprintf("%v-%v.json.gz", results[0]["id"], results[len(results)-1]["id"]))
+	_, err := a.client.PutObject(ctx, a.bucket, key, bytes.NewReader(buf.Bytes()), int64(buf.Len()), minio.PutObjectOptions{
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "gzip",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
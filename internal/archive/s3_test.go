@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Archiver_Archive(t *testing.T) {
+	var paths []string
+	var lines []map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=access/")
+		paths = append(paths, r.URL.Path)
+
+		// Uploads over plain HTTP are signed per chunk
+		assert.Equal(t, "STREAMING-AWS4-HMAC-SHA256-PAYLOAD", r.Header.Get("X-Amz-Content-Sha256"))
+		gz, err := gzip.NewReader(decodeChunks(t, r.Body))
+		require.NoError(t, err)
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var line map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	archiver, err := NewS3Archiver(S3Config{
+		Endpoint:  strings.TrimPrefix(ts.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    "shraga",
+		Prefix:    "prod",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Insecure:  true,
+	})
+	require.NoError(t, err)
+
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = archiver.Archive(context.Background(), 7, day, []map[string]any{
+		{"id": 10, "monitor_id": 7, "result": 1},
+		{"id": 12, "monitor_id": 7, "result": 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/shraga/prod/results/date=2020-01-01/monitor=7/10-12.json.gz"}, paths)
+	assert.Equal(t, []map[string]any{
+		{"id": float64(10), "monitor_id": float64(7), "result": float64(1)},
+		{"id": float64(12), "monitor_id": float64(7), "result": float64(3)},
+	}, lines)
+}
+
+func TestNewS3Archiver_RequiresBucket(t *testing.T) {
+	_, err := NewS3Archiver(S3Config{Endpoint: "s3.amazonaws.com"})
+	assert.EqualError(t, err, "archive endpoint and bucket are required")
+}
+
+// decodeChunks returns the payload of an aws-chunked body, dropping the chunk
+// signatures.
+func decodeChunks(t *testing.T, body io.Reader) io.Reader {
+	var payload bytes.Buffer
+	reader := bufio.NewReader(body)
+	for {
+		header, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		require.NoError(t, err)
+		if size == 0 {
+			return &payload
+		}
+		chunk := make([]byte, size+2) // Followed by CRLF
+		_, err = io.ReadFull(reader, chunk)
+		require.NoError(t, err)
+		payload.Write(chunk[:size])
+	}
+}
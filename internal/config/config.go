@@ -1,21 +1,218 @@
 package config
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
 	"shraga/internal/logging"
+	"shraga/internal/monitor"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v8"
 )
 
 type Config struct {
-    DSN string `env:"DATABASE_DSN" envDefault:"host=localhost user=postgres password=postgres dbname=monitoring port=5432 sslmode=disable"`
-    Env string `env:"APP_ENV" envDefault:"dev"` // Environment type (e.g., prod, dev, test)
+	DSN               string   `env:"DATABASE_DSN" envDefault:"host=localhost user=postgres password=postgres dbname=monitoring port=5432 sslmode=disable"`
+	ReplicaDSN        string   `env:"DATABASE_REPLICA_DSN"`                  // Optional read replica for reporting queries
+	ResultSinkDSN     string   `env:"RESULT_SINK_DSN"`                       // Optional database every result is also written to
+	Env               string   `env:"APP_ENV" envDefault:"dev"`              // Environment type (e.g., prod, dev, test)
+	HttpAddr          string   `env:"HTTP_ADDR" envDefault:":9090"`          // Listen address for the API and /metrics
+	MonitorsFile      string   `env:"MONITORS_FILE"`                         // Optional JSON file of monitors to sync at startup
+	ValidatorCommands []string `env:"VALIDATOR_COMMANDS" envSeparator:","`   // Executables allowed as a monitor's ValidatorCommand
+	SyncWorkers       int      `env:"MONITORS_SYNC_WORKERS" envDefault:"10"` // Concurrent upserts during the startup sync
+	LogFormat         string   `env:"LOG_FORMAT"`                            // json or console; defaults to json in prod and console otherwise
+	// Serve /metrics as OpenMetrics to scrapers whose Accept header asks for it
+	MetricsOpenMetrics bool `env:"METRICS_OPENMETRICS" envDefault:"true"`
+	// Results of external probes are accepted from requests bearing this
+	// token, as "Authorization: Bearer <token>"; without one they aren't
+	IngestToken string `env:"INGEST_TOKEN"`
+	// The routes changing state, e.g. snoozing a monitor, are served to
+	// requests bearing this token; without one they aren't
+	AdminToken string `env:"ADMIN_TOKEN"`
+	// Connection limits of the transport shared by HTTP monitors; zero means
+	// no limit
+	HttpMaxIdleConns        int `env:"HTTP_MAX_IDLE_CONNS" envDefault:"100"`
+	HttpMaxIdleConnsPerHost int `env:"HTTP_MAX_IDLE_CONNS_PER_HOST" envDefault:"2"`
+	HttpMaxConnsPerHost     int `env:"HTTP_MAX_CONNS_PER_HOST" envDefault:"10"`
+	// How long hosts resolved by HTTP monitors are cached, falling back to the
+	// cached addresses when DNS fails; zero disables caching
+	DNSCacheTTL time.Duration `env:"DNS_CACHE_TTL"`
+	// CIDR networks monitors may target, comma separated. Denied networks are
+	// never reachable; when allowed ones are set, nothing else is.
+	TargetAllowedNetworks []netip.Prefix `env:"TARGET_ALLOWED_NETWORKS" envSeparator:","`
+	TargetDeniedNetworks  []netip.Prefix `env:"TARGET_DENIED_NETWORKS" envSeparator:","`
+	// Interval given to monitors created without one
+	DefaultInterval time.Duration `env:"DEFAULT_INTERVAL" envDefault:"60s"`
+	// How long results are kept for monitors without their own retention; zero
+	// keeps them forever
+	ResultRetention time.Duration `env:"RESULT_RETENTION"`
+	// Results purged for exceeding their retention are archived to this
+	// S3-compatible bucket first, when set
+	ArchiveBucket    string `env:"ARCHIVE_BUCKET"`
+	ArchiveEndpoint  string `env:"ARCHIVE_ENDPOINT" envDefault:"s3.amazonaws.com"`
+	ArchiveRegion    string `env:"ARCHIVE_REGION"`
+	ArchivePrefix    string `env:"ARCHIVE_PREFIX"`
+	ArchiveAccessKey string `env:"ARCHIVE_ACCESS_KEY"`
+	ArchiveSecretKey string `env:"ARCHIVE_SECRET_KEY"`
+	ArchiveInsecure  bool   `env:"ARCHIVE_INSECURE"` // Plain HTTP, e.g. for a local MinIO
+	// Whether results are rolled up per minute, keeping raw results for
+	// RAW_RETENTION, for monitors that don't set AggregateResults or
+	// RawRetention
+	AggregateResults bool          `env:"AGGREGATE_RESULTS"`
+	RawRetention     time.Duration `env:"RAW_RETENTION" envDefault:"1h"`
+	// Caps checks dispatched per second across all monitors; 0 is unlimited
+	MaxChecksPerSecond float64 `env:"MAX_CHECKS_PER_SECOND"`
+	// Checks running longer are abandoned and recorded as stuck, freeing their
+	// worker; zero never abandons them. Monitors with a timeout of their own
+	// are abandoned sooner, 15s past it.
+	CheckTimeout time.Duration `env:"CHECK_TIMEOUT" envDefault:"10m"`
+	// Elect one replica to dispatch checks when several share the database,
+	// for the workers of every replica to run
+	LeaderElection bool          `env:"LEADER_ELECTION"`
+	LeaderLeaseTTL time.Duration `env:"LEADER_LEASE_TTL" envDefault:"15s"`
+	// Keep checking the last-known monitors while the database is unavailable,
+	// buffering up to DegradedBufferSize results until it recovers
+	DegradedMode       bool `env:"DEGRADED_MODE"`
+	DegradedBufferSize int  `env:"DEGRADED_BUFFER_SIZE" envDefault:"10000"`
+	// Opsgenie alerts are sent when an API key is set
+	OpsgenieAPIKey string `env:"OPSGENIE_API_KEY"`
+	OpsgenieRegion string `env:"OPSGENIE_REGION" envDefault:"us"` // us or eu
+	// Slack messages are posted when an incoming webhook URL is set
+	SlackWebhookURL string `env:"SLACK_WEBHOOK_URL"`
+	// Events are posted as JSON when a webhook URL is set, with the given
+	// headers, e.g. "Authorization:Bearer token". The payload template is a
+	// text/template executed with the event, e.g.
+	// {"text": {{json .Address}}, "state": "{{.Current}}"}, replacing the
+	// default payload when set
+	WebhookURL             string            `env:"WEBHOOK_URL"`
+	WebhookHeaders         map[string]string `env:"WEBHOOK_HEADERS"`
+	WebhookPayloadTemplate string            `env:"WEBHOOK_PAYLOAD_TEMPLATE"`
+	// Alert emails are sent through SMTP when a host is set. The templates
+	// are text/template, executed with the notified event.
+	SMTPHost             string   `env:"SMTP_HOST"`
+	SMTPPort             int      `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername         string   `env:"SMTP_USERNAME"`
+	SMTPPassword         string   `env:"SMTP_PASSWORD"`
+	SMTPTLS              string   `env:"SMTP_TLS" envDefault:"starttls"` // starttls, tls or none
+	EmailFrom            string   `env:"EMAIL_FROM"`
+	EmailTo              []string `env:"EMAIL_TO" envSeparator:","`
+	EmailSubjectTemplate string   `env:"EMAIL_SUBJECT_TEMPLATE"`
+	EmailBodyTemplate    string   `env:"EMAIL_BODY_TEMPLATE"`
+	// The settings below are applied live when the process receives SIGHUP.
+	// As the environment of a process can't change, set them in the
+	// CONFIG_FILE to change them without a restart
+	LogLevel     string        `env:"LOG_LEVEL"`                       // Defaults to debug in dev and info in prod
+	TickInterval time.Duration `env:"TICK_INTERVAL" envDefault:"1s"`   // How often due monitors are looked up
+	Workers      int           `env:"MONITOR_WORKERS" envDefault:"10"` // Concurrent monitor checks
 }
 
 // LoadConfig loads configuration from environment variables or default values
 func LoadConfig() Config {
-    cfg := Config{}
-    if err := env.Parse(&cfg); err != nil {
-        logging.Logger.Sugar().Fatalf("Failed to load configuration: %v", err)
-    }
-    return cfg
+	cfg, err := Parse()
+	if err != nil {
+		logging.Logger.Sugar().Fatalf("Failed to load configuration: %v", err)
+	}
+	return cfg
+}
+
+// Parse reads the configuration from environment variables or default values.
+// When CONFIG_FILE is set, the variables it sets override the environment;
+// unlike the environment, it's read again on every call.
+func Parse() (Config, error) {
+	environment, err := environ()
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{}
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: environment}); err != nil {
+		return Config{}, err
+	}
+	if cfg.LogFormat != "" && cfg.LogFormat != "json" && cfg.LogFormat != "console" {
+		return Config{}, fmt.Errorf("LOG_FORMAT must be json or console, got %q", cfg.LogFormat)
+	}
+	if cfg.OpsgenieRegion != "us" && cfg.OpsgenieRegion != "eu" {
+		return Config{}, fmt.Errorf("OPSGENIE_REGION must be us or eu, got %q", cfg.OpsgenieRegion)
+	}
+	if cfg.SMTPTLS != "starttls" && cfg.SMTPTLS != "tls" && cfg.SMTPTLS != "none" {
+		return Config{}, fmt.Errorf("SMTP_TLS must be starttls, tls or none, got %q", cfg.SMTPTLS)
+	}
+	if cfg.SMTPHost != "" && (cfg.EmailFrom == "" || len(cfg.EmailTo) == 0) {
+		return Config{}, errors.New("EMAIL_FROM and EMAIL_TO are required with SMTP_HOST")
+	}
+	if cfg.DefaultInterval <= 0 {
+		return Config{}, fmt.Errorf("DEFAULT_INTERVAL must be positive, got %s", cfg.DefaultInterval)
+	}
+	if cfg.RawRetention < monitor.MinRawRetention {
+		return Config{}, fmt.Errorf("RAW_RETENTION must be at least %s, got %s", monitor.MinRawRetention, cfg.RawRetention)
+	}
+	if cfg.MaxChecksPerSecond < 0 {
+		return Config{}, fmt.Errorf("MAX_CHECKS_PER_SECOND must not be negative, got %g", cfg.MaxChecksPerSecond)
+	}
+	if cfg.CheckTimeout < 0 {
+		return Config{}, fmt.Errorf("CHECK_TIMEOUT must not be negative, got %s", cfg.CheckTimeout)
+	}
+	if cfg.LeaderElection && cfg.LeaderLeaseTTL <= 0 {
+		return Config{}, fmt.Errorf("LEADER_LEASE_TTL must be positive, got %s", cfg.LeaderLeaseTTL)
+	}
+	if cfg.DegradedMode && cfg.DegradedBufferSize < 1 {
+		return Config{}, fmt.Errorf("DEGRADED_BUFFER_SIZE must be at least 1, got %d", cfg.DegradedBufferSize)
+	}
+	if cfg.TickInterval <= 0 {
+		return Config{}, fmt.Errorf("TICK_INTERVAL must be positive, got %s", cfg.TickInterval)
+	}
+	if cfg.Workers < 1 {
+		return Config{}, fmt.Errorf("MONITOR_WORKERS must be at least 1, got %d", cfg.Workers)
+	}
+	return cfg, nil
+}
+
+// environ returns the environment of the process, overridden by the variables
+// set in CONFIG_FILE, if any.
+func environ() (map[string]string, error) {
+	environment := make(map[string]string)
+	for _, variable := range os.Environ() {
+		key, value, _ := strings.Cut(variable, "=")
+		environment[key] = value
+	}
+
+	path := environment["CONFIG_FILE"]
+	if path == "" {
+		return environment, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+	if err := parseEnvFile(data, environment); err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_FILE %s: %w", path, err)
+	}
+	return environment, nil
+}
+
+// parseEnvFile sets the KEY=value lines of data in environment. Blank lines
+// and lines starting with # are skipped, and values may be quoted.
+func parseEnvFile(data []byte, environment map[string]string) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("line %d: expected KEY=value", line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		environment[key] = value
+	}
+	return scanner.Err()
 }
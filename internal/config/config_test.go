@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	environment := map[string]string{"LOG_LEVEL": "info", "APP_ENV": "prod"}
+	err := parseEnvFile([]byte(`
+# Applied on SIGHUP
+LOG_LEVEL = debug
+export EMAIL_SUBJECT_TEMPLATE="{{.Address}} is {{.Current}}"
+WEBHOOK_HEADERS='Authorization:Bearer a=b'
+`), environment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"LOG_LEVEL":              "debug",
+		"APP_ENV":                "prod",
+		"EMAIL_SUBJECT_TEMPLATE": "{{.Address}} is {{.Current}}",
+		"WEBHOOK_HEADERS":        "Authorization:Bearer a=b",
+	}, environment)
+
+	assert.EqualError(t, parseEnvFile([]byte("LOG_LEVEL=debug\nWORKERS\n"), environment), "line 2: expected KEY=value")
+}
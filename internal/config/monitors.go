@@ -0,0 +1,251 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"shraga/internal/monitor"
+	"slices"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// LoadMonitors reads a JSON file holding an array of monitor definitions.
+// Each entry is decoded into the monitor type named by its Type field. The
+// valid entries are returned along with the problems of the others, joined,
+// so that one bad entry doesn't hold back the rest of the file.
+func LoadMonitors(path string) ([]monitor.Monitorer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	monitors := make([]monitor.Monitorer, 0, len(entries))
+	var errs []error
+	for i, entry := range entries {
+		mon, err := decodeMonitor(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("entry %d: %w", i, err))
+			continue
+		}
+		monitors = append(monitors, mon)
+	}
+
+	return monitors, errors.Join(errs...)
+}
+
+// decodeMonitor decodes a monitor definition into the monitor type named by
+// its Type field.
+func decodeMonitor(entry json.RawMessage) (monitor.Monitorer, error) {
+	var header struct {
+		Type monitor.MonitorType
+	}
+	if err := json.Unmarshal(entry, &header); err != nil {
+		return nil, err
+	}
+
+	mon, err := monitor.New(header.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(entry, mon); err != nil {
+		return nil, err
+	}
+	if mon.GetBase().ID == 0 {
+		return nil, errors.New("missing ID")
+	}
+	if hasRedacted(entry) {
+		return nil, errors.New("holds a redacted secret, set its value before loading")
+	}
+	return mon, nil
+}
+
+// hasRedacted reports whether an exported secret was left redacted in entry.
+func hasRedacted(entry json.RawMessage) bool {
+	var value any
+	if err := json.Unmarshal(entry, &value); err != nil {
+		return false
+	}
+
+	var walk func(any) bool
+	walk = func(v any) bool {
+		switch v := v.(type) {
+		case string:
+			return v == monitor.Redacted
+		case []any:
+			return slices.ContainsFunc(v, walk)
+		case map[string]any:
+			for _, item := range v {
+				if walk(item) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return walk(value)
+}
+
+// EntryError is the problem found with an entry of a monitors file.
+type EntryError struct {
+	Entry int    `json:"entry"`
+	ID    uint   `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// ValidateMonitors checks monitor definitions, in the form read by
+// LoadMonitors, as they would be saved, without saving them. Every entry is
+// checked, returning the problems of each; err is only set when data isn't an
+// array of definitions.
+func ValidateMonitors(data []byte) ([]EntryError, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	problems := []EntryError{}
+	seen := make(map[uint]int, len(entries))
+	for i, entry := range entries {
+		mon, err := decodeMonitor(entry)
+		if err != nil {
+			problems = append(problems, EntryError{Entry: i, Error: err.Error()})
+			continue
+		}
+
+		id := mon.GetBase().ID
+		if first, ok := seen[id]; ok {
+			problems = append(problems, EntryError{Entry: i, ID: id, Error: fmt.Sprintf("duplicate ID, also used by entry %d", first)})
+			continue
+		}
+		seen[id] = i
+
+		// The hooks don't use the transaction, validating without a database
+		if hook, ok := mon.(interface{ BeforeSave(*gorm.DB) error }); ok {
+			if err := hook.BeforeSave(nil); err != nil {
+				problems = append(problems, EntryError{Entry: i, ID: id, Error: err.Error()})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// runtimeFields are updated by the checks themselves rather than configured.
+var runtimeFields = []string{
+	"IsMonitoring",
+	"Dispatched",
+	"LastMonitorTime",
+	"LastResult",
+	"ConsecutiveFailures",
+	"ConsecutiveWarnings",
+	"WarningSince",
+	"LatencyEMA",
+	"SnoozeUntil",
+	"DeferUntil",
+	"CreatedAt",
+	"UpdatedAt",
+	"LastCertFingerprint",
+	"SSLExpiryNotified",
+	"BodySizeBaseline",
+	"LastBodyHash",
+}
+
+// ExportMonitor returns the configuration of mon in the form read by
+// LoadMonitors, without runtime state or the columns duplicating a field
+// for storage. Secrets, including credential headers, are replaced with
+// monitor.Redacted, which LoadMonitors refuses.
+func ExportMonitor(mon monitor.Monitorer) (map[string]any, error) {
+	data, err := json.Marshal(mon)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, name := range runtimeFields {
+		delete(fields, name)
+	}
+	for name := range fields {
+		for _, suffix := range []string{"Int", "JSON"} {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			if _, ok := fields[strings.TrimSuffix(name, suffix)]; ok {
+				delete(fields, name)
+			}
+		}
+	}
+	if headers, ok := fields["ReqHeaders"].(map[string]any); ok {
+		for name := range headers {
+			if monitor.IsCredentialHeader(name) {
+				headers[name] = monitor.Redacted
+			}
+		}
+	}
+	fields["Type"] = mon.GetType().String()
+
+	return fields, nil
+}
+
+// SyncMonitors upserts monitors using up to workers concurrent writers. A bad
+// entry doesn't abort the sync; every failure is returned joined together.
+func SyncMonitors(ctx context.Context, database db.Database, monitors []monitor.Monitorer, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		jobs = make(chan monitor.Monitorer)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mon := range jobs {
+				logger := logging.Logger.Sugar().With("monitorID", mon.GetBase().ID)
+				if err := database.UpsertMonitor(ctx, mon); err != nil {
+					logger.Errorf("failed to sync monitor: %v", err)
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("monitor %d: %w", mon.GetBase().ID, err))
+					mu.Unlock()
+					continue
+				}
+				logger.Info("monitor synced")
+			}
+		}()
+	}
+
+feed:
+	for _, mon := range monitors {
+		select {
+		case jobs <- mon:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
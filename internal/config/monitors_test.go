@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"shraga/internal/db"
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDatabase struct {
+	db.Database
+	mu       sync.Mutex
+	upserted []uint
+	failID   uint
+}
+
+func (f *fakeDatabase) UpsertMonitor(_ context.Context, mon monitor.Monitorer) error {
+	if mon.GetBase().ID == f.failID {
+		return errors.New("boom")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upserted = append(f.upserted, mon.GetBase().ID)
+	return nil
+}
+
+func TestLoadMonitors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitors.json")
+	err := os.WriteFile(path, []byte(`[
+		{"ID": 1, "Type": 1, "Address": "https://example.com", "ValidStatusCodes": [200]},
+		{"ID": 2, "Type": 2, "Address": "ftp.example.com", "ListDir": "/pub"}
+	]`), 0o600)
+	require.NoError(t, err)
+
+	monitors, err := LoadMonitors(path)
+	require.NoError(t, err)
+	require.Len(t, monitors, 2)
+
+	httpMon := monitors[0].(*monitor.HttpMonitor)
+	assert.Equal(t, "https://example.com", httpMon.Address)
+	assert.Equal(t, []int{200}, httpMon.ValidStatusCodes)
+
+	ftpMon := monitors[1].(*monitor.FtpMonitor)
+	assert.Equal(t, monitor.TypeFTP, ftpMon.GetType())
+	assert.Equal(t, "/pub", ftpMon.ListDir)
+}
+
+func TestLoadMonitors_UnknownType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitors.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"ID": 1, "Type": 42}]`), 0o600))
+
+	_, err := LoadMonitors(path)
+	assert.EqualError(t, err, "entry 0: unknown type: MonitorType(42)")
+}
+
+func TestLoadMonitors_SkipsInvalidEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitors.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"ID": 1, "Type": 1, "Address": "https://example.com"},
+		{"Type": 1, "Address": "https://missing-id.example.com"},
+		{"ID": 3, "Type": 5, "Host": "db.internal", "Ports": [5432]},
+		{"ID": 4, "Type": 42}
+	]`), 0o600))
+
+	monitors, err := LoadMonitors(path)
+	assert.EqualError(t, err, "entry 1: missing ID\nentry 3: unknown type: MonitorType(42)")
+	require.Len(t, monitors, 2)
+	assert.Equal(t, uint(1), monitors[0].GetBase().ID)
+	assert.Equal(t, uint(3), monitors[1].GetBase().ID)
+}
+
+func TestSyncMonitors_ContinuesPastFailures(t *testing.T) {
+	var monitors []monitor.Monitorer
+	for id := uint(1); id <= 20; id++ {
+		monitors = append(monitors, &monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: id}})
+	}
+	database := &fakeDatabase{failID: 7}
+
+	err := SyncMonitors(context.Background(), database, monitors, 4)
+
+	assert.EqualError(t, err, "monitor 7: boom")
+	assert.Len(t, database.upserted, 19)
+}
+
+func TestExportMonitor(t *testing.T) {
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:              5,
+			Type:            monitor.TypeHTTP,
+			Interval:        time.Minute,
+			IntervalInt:     int64(time.Minute),
+			LastMonitorTime: time.Now(),
+			IsMonitoring:    true,
+		},
+		Address:             "https://example.com",
+		ValidStatusCodes:    []int{200},
+		ReqHeaders:          map[string]string{"Accept": "application/json"},
+		ReqHeadersJSON:      `{"Accept":"application/json"}`,
+		LastCertFingerprint: "abc",
+	}
+
+	exported, err := ExportMonitor(mon)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP", exported["Type"])
+	for _, field := range []string{"IsMonitoring", "LastMonitorTime", "LastCertFingerprint", "IntervalInt", "ReqHeadersJSON"} {
+		assert.NotContains(t, exported, field)
+	}
+
+	// The export can be loaded back
+	data, err := json.Marshal([]any{exported})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "monitors.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	monitors, err := LoadMonitors(path)
+	require.NoError(t, err)
+	require.Len(t, monitors, 1)
+	loaded := monitors[0].(*monitor.HttpMonitor)
+	assert.Equal(t, uint(5), loaded.ID)
+	assert.Equal(t, time.Minute, loaded.Interval)
+	assert.Equal(t, "https://example.com", loaded.Address)
+	assert.Equal(t, map[string]string{"Accept": "application/json"}, loaded.ReqHeaders)
+	assert.False(t, loaded.IsMonitoring)
+}
+
+func TestExportMonitor_RedactsSecrets(t *testing.T) {
+	monitors := []monitor.Monitorer{
+		&monitor.HttpMonitor{
+			BaseMonitor:       monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP},
+			Address:           "https://example.com",
+			ReqHeaders:        map[string]string{"Accept": "application/json", "Authorization": "Bearer token-1", "X-Api-Key": "key-1"},
+			ClientKeyPEM:      "pem-1",
+			BasicAuthPassword: "password-3",
+		},
+		&monitor.FtpMonitor{
+			BaseMonitor:        monitor.BaseMonitor{ID: 2, Type: monitor.TypeFTP},
+			FileTransferConfig: monitor.FileTransferConfig{Address: "ftp.example.com", Username: "ops", Password: "password-1"},
+		},
+		&monitor.SftpMonitor{
+			BaseMonitor:        monitor.BaseMonitor{ID: 3, Type: monitor.TypeSFTP},
+			FileTransferConfig: monitor.FileTransferConfig{Address: "sftp.example.com", Password: "password-2"},
+			PrivateKey:         "pem-2",
+		},
+	}
+
+	var entries []any
+	for _, mon := range monitors {
+		exported, err := ExportMonitor(mon)
+		require.NoError(t, err)
+		entries = append(entries, exported)
+	}
+	data, err := json.Marshal(entries)
+	require.NoError(t, err)
+	for _, secret := range []string{"token-1", "key-1", "pem-1", "password-1", "password-2", "pem-2", "password-3"} {
+		assert.NotContains(t, string(data), secret)
+	}
+	assert.Equal(t, "application/json", entries[0].(map[string]any)["ReqHeaders"].(map[string]any)["Accept"])
+
+	// Loading the export back requires setting the secrets again
+	path := filepath.Join(t.TempDir(), "monitors.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	monitors, err = LoadMonitors(path)
+	assert.ErrorContains(t, err, "entry 0: holds a redacted secret, set its value before loading")
+	assert.Empty(t, monitors)
+}
+
+func TestValidateMonitors(t *testing.T) {
+	problems, err := ValidateMonitors([]byte(`[
+		{"ID": 1, "Type": 1, "Address": "https://example.com", "RequestMethod": "GET"},
+		{"ID": 2, "Type": 1, "Address": "https://example.com", "RequestMethod": "GET", "ExpectedFormat": "yaml"},
+		{"ID": 1, "Type": 1, "Address": "https://example.org", "RequestMethod": "GET"},
+		{"ID": 4, "Type": 42},
+		{"Type": 1}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []EntryError{
+		{Entry: 1, ID: 2, Error: `unknown expected format "yaml", must be json or xml`},
+		{Entry: 2, ID: 1, Error: "duplicate ID, also used by entry 0"},
+		{Entry: 3, Error: "unknown type: MonitorType(42)"},
+		{Entry: 4, Error: "missing ID"},
+	}, problems)
+
+	problems, err = ValidateMonitors([]byte(`[{"ID": 1, "Type": 1, "Address": "https://example.com", "RequestMethod": "GET"}]`))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	_, err = ValidateMonitors([]byte(`{"ID": 1}`))
+	assert.Error(t, err)
+}
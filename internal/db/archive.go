@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// archiveBatchSize bounds the results archived and deleted at once
+const archiveBatchSize = 5000
+
+// Archiver keeps the results purged for exceeding their retention, e.g. in an
+// object store.
+type Archiver interface {
+	// Archive stores results of monitorID, rows of its result table by column
+	// name, all checked on day (UTC).
+	Archive(ctx context.Context, monitorID uint, day time.Time, results []map[string]any) error
+}
+
+// WithArchiver makes PurgeResults hand the results it purges to archiver
+// first. Results that fail to archive are kept.
+func WithArchiver(archiver Archiver) Option {
+	return func(o *options) {
+		o.archiver = archiver
+	}
+}
+
+// archiveResults archives and deletes the results of monitorID in
+// resultTable checked before cutoff, in batches of archiveBatchSize.
+func (db *GormDb) archiveResults(ctx context.Context, resultTable string, monitorID uint, cutoff time.Time) error {
+	for {
+		var rows []map[string]any
+		err := db.WithContext(ctx).
+			Table(resultTable).
+			Where("monitor_id = ? AND response_time < ?", monitorID, cutoff).
+			Order("response_time, id").
+			Limit(archiveBatchSize).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		// Rows are ordered, so each day is a contiguous run
+		ids := make([]any, 0, len(rows))
+		start := 0
+		for i, row := range rows {
+			ids = append(ids, row["id"])
+			if i+1 < len(rows) && sameDay(rows[i+1], row) {
+				continue
+			}
+			day := rows[start]["response_time"].(time.Time).UTC().Truncate(24 * time.Hour)
+			if err := db.archiver.Archive(ctx, monitorID, day, rows[start:i+1]); err != nil {
+				return fmt.Errorf("failed to archive results: %w", err)
+			}
+			start = i + 1
+		}
+
+		err = db.WithContext(ctx).
+			Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", resultTable), ids).
+			Error
+		if err != nil {
+			return err
+		}
+		if len(rows) < archiveBatchSize {
+			return nil
+		}
+	}
+}
+
+// sameDay reports whether two result rows were checked on the same UTC day.
+func sameDay(a, b map[string]any) bool {
+	dayA := a["response_time"].(time.Time).UTC().Truncate(24 * time.Hour)
+	dayB := b["response_time"].(time.Time).UTC().Truncate(24 * time.Hour)
+	return dayA.Equal(dayB)
+}
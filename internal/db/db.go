@@ -3,13 +3,39 @@ package db
 import (
 	"context"
 	"shraga/internal/monitor"
+	"time"
 )
 
 type Database interface {
 	AddMonitor(context.Context, monitor.Monitorer) error
-	Lock(context.Context, monitor.Monitorer) error
+	UpsertMonitor(context.Context, monitor.Monitorer) error
 	Unlock(context.Context, monitor.Monitorer) error
+	SaveRuntimeState(context.Context, monitor.Monitorer) error
+	ForceUnlock(ctx context.Context, id uint) error
+	SnoozeMonitor(ctx context.Context, id uint, until time.Time) error
+	SetEnabledByTag(ctx context.Context, tags map[string]string, enabled bool) (int64, error)
 	SaveResult(ctx context.Context, result monitor.MonitorResponser) error
+	GetMonitor(ctx context.Context, id uint) (monitor.Monitorer, error)
+	GetMonitorForUpdate(ctx context.Context, id uint) (monitor.Monitorer, error)
+	GetMonitorsByOwner(ctx context.Context, owner string) ([]monitor.Monitorer, error)
 	GetEnabledMonitorsByType(context.Context, monitor.MonitorType) ([]monitor.Monitorer, error)
+	GetEnabledMonitors(ctx context.Context) ([]monitor.Monitorer, error)
 	GetMonitorsToRun(ctx context.Context) ([]monitor.Monitorer, error)
+	DispatchMonitors(ctx context.Context) (int64, error)
+	ClaimDispatched(ctx context.Context, limit int) ([]monitor.Monitorer, error)
+	GetLastResults(ctx context.Context, monitorIDs []uint) (map[uint]monitor.Result, error)
+	GetDependencyGraph(ctx context.Context) (map[uint]DependencyNode, error)
+	RollupResults(ctx context.Context, aggregateByDefault bool, defaultRawRetention time.Duration) error
+	GetRollups(ctx context.Context, monitorID uint, from, to time.Time) ([]monitor.ResultRollup, error)
+	PurgeResults(ctx context.Context, defaultRetention time.Duration) error
+	UpdateIncident(ctx context.Context, result monitor.MonitorResponser) (*monitor.Incident, error)
+	GetOpenIncidents(ctx context.Context) ([]monitor.Incident, error)
+	RebuildIncidents(ctx context.Context, monitorID uint) error
+	GetTimeseries(ctx context.Context, monitorID uint, from, to time.Time, step time.Duration) ([]TimeseriesBucket, error)
+	GetReasonBreakdown(ctx context.Context, monitorID uint, from, to time.Time) (map[monitor.Reason]int, error)
+	GetOverview(ctx context.Context, since time.Time, limit int) (Overview, error)
+	GetDownMonitors(ctx context.Context) ([]MonitorStatus, error)
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+	InTransaction(ctx context.Context, fn func(Database) error) error
 }
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"shraga/internal/monitor"
+)
+
+// DependencyNode is a monitor of the dependency graph.
+type DependencyNode struct {
+	DependsOn  []uint
+	LastResult monitor.Result
+}
+
+// GetDependencyGraph returns every monitor, whatever its type, with the
+// monitors it depends on and its latest result.
+func (db *GormDb) GetDependencyGraph(ctx context.Context) (map[uint]DependencyNode, error) {
+	graph := make(map[uint]DependencyNode)
+	for _, model := range monitorModels {
+		var rows []struct {
+			ID            uint
+			DependsOnJSON string
+			LastResult    monitor.Result
+		}
+		err := db.WithContext(ctx).
+			Table(model.table).
+			Select("id", "depends_on_json", "last_result").
+			Find(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			node := DependencyNode{LastResult: row.LastResult}
+			if row.DependsOnJSON != "" {
+				if err := json.Unmarshal([]byte(row.DependsOnJSON), &node.DependsOn); err != nil {
+					return nil, fmt.Errorf("monitor %d: invalid depends_on_json: %w", row.ID, err)
+				}
+			}
+			graph[row.ID] = node
+		}
+	}
+	return graph, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"shraga/internal/monitor"
+	"sort"
+	"time"
+)
+
+// MonitorStatus describes a monitor that is currently down.
+type MonitorStatus struct {
+	MonitorID  uint
+	Type       monitor.MonitorType
+	DownSince  time.Time
+	Downtime   time.Duration
+	Reason     monitor.Reason // Reason of the result that opened the incident
+	ErrorMsg   string
+	OwnerTeam  string
+	OwnerEmail string
+	// Checks in a row that were down
+	ConsecutiveFailures int
+}
+
+// GetDownMonitors returns every enabled monitor whose latest result is down,
+// longest down first. DownSince is the start of its open incident, or its
+// latest check when it has none.
+func (db *GormDb) GetDownMonitors(ctx context.Context) ([]MonitorStatus, error) {
+	var statuses []MonitorStatus
+	for _, model := range monitorModels {
+		var rows []struct {
+			ID         uint
+			Type       monitor.MonitorType
+			DownSince  time.Time
+			Reason     monitor.Reason
+			ErrorMsg   string
+			OwnerTeam  string
+			OwnerEmail string
+
+			ConsecutiveFailures int
+		}
+		query := fmt.Sprintf(`
+SELECT m.id, m.type, m.owner_team, m.owner_email, m.consecutive_failures, COALESCE(i.started_at, m.last_monitor_time) AS down_since, COALESCE(i.reason, 0) AS reason, COALESCE(i.error_msg, '') AS error_msg
+FROM %s m
+LEFT JOIN incidents i ON i.monitor_id = m.id AND i.ended_at IS NULL
+WHERE m.enabled = true AND m.last_result = ?`, model.table)
+		if err := db.WithContext(ctx).Raw(query, int(monitor.ResultDown)).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			statuses = append(statuses, MonitorStatus{
+				MonitorID:  row.ID,
+				Type:       row.Type,
+				DownSince:  row.DownSince,
+				Reason:     row.Reason,
+				ErrorMsg:   row.ErrorMsg,
+				OwnerTeam:  row.OwnerTeam,
+				OwnerEmail: row.OwnerEmail,
+
+				ConsecutiveFailures: row.ConsecutiveFailures,
+			})
+		}
+	}
+
+	now := db.now()
+	for i := range statuses {
+		statuses[i].Downtime = now.Sub(statuses[i].DownSince)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].DownSince.Before(statuses[j].DownSince)
+	})
+	return statuses, nil
+}
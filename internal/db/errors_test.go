@@ -0,0 +1,25 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnavailable(t *testing.T) {
+	assert.True(t, IsUnavailable(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}))
+	assert.True(t, IsUnavailable(fmt.Errorf("save: %w", driver.ErrBadConn)))
+	assert.True(t, IsUnavailable(&pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"}))
+	assert.True(t, IsUnavailable(&pgconn.PgError{Code: "08006", Message: "connection failure"}))
+
+	assert.False(t, IsUnavailable(&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}))
+	assert.False(t, IsUnavailable(errors.New("invalid input syntax")))
+	assert.False(t, IsUnavailable(context.Canceled))
+}
@@ -2,37 +2,110 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"shraga/internal/logging"
 	"shraga/internal/monitor"
+	"sort"
 	"time"
 
 	"github.com/samber/lo"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 	"moul.io/zapgorm2"
 )
 
-var now = time.Now
+// ErrMonitorNotFound is returned when no monitor has the requested ID.
+var ErrMonitorNotFound = errors.New("monitor not found")
+
+// ErrMonitorBusy is returned by GetMonitorForUpdate while the monitor is
+// claimed by a check.
+var ErrMonitorBusy = errors.New("monitor is being checked")
 
 type GormDb struct {
 	*gorm.DB
+	now      func() time.Time
+	archiver Archiver // Set to archive results before purging them
+}
+
+// Option configures optional behaviour of GormDb.
+type Option func(*options)
+
+type options struct {
+	replicaDSN string
+	now        func() time.Time
+	archiver   Archiver
+}
+
+// WithReplica routes read-only queries to the read replica at dsn, while
+// writes and locking keep going to the primary.
+func WithReplica(dsn string) Option {
+	return func(o *options) {
+		o.replicaDSN = dsn
+	}
+}
+
+// WithClock makes GormDb, and the monitors it loads, use now instead of the
+// wall clock. Useful for simulating schedules at arbitrary times.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
 }
 
 // NewGormDb returns new GormDb.
-func NewGormDb(dsn string) (*GormDb, error) {
+func NewGormDb(dsn string, opts ...Option) (*GormDb, error) {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	logger := zapgorm2.New(logging.Logger)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{NowFunc: o.now, Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+
+	if o.replicaDSN != "" {
+		err = db.Use(dbresolver.Register(dbresolver.Config{
+			Replicas: []gorm.Dialector{postgres.Open(o.replicaDSN)},
+		}))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.AutoMigrate(migrationModels...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = shareMonitorIDs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GormDb{DB: db, now: o.now, archiver: o.archiver}, nil
+}
+
+// NewResultSink connects to a database only written results with Save, e.g.
+// as a result sink of the manager. Only the result tables are migrated, as
+// monitors, incidents and leases are kept in the main database.
+func NewResultSink(dsn string) (*GormDb, error) {
 	logger := zapgorm2.New(logging.Logger)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{NowFunc: now, Logger: logger})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger})
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&monitor.HttpMonitor{}, &monitor.HttpResponse{})
+	err = db.AutoMigrate(resultModels...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &GormDb{db}, nil
+	return &GormDb{DB: db, now: time.Now}, nil
 }
 
 func (db *GormDb) AddMonitor(ctx context.Context, monitor monitor.Monitorer) error {
@@ -43,6 +116,31 @@ func (db *GormDb) AddMonitor(ctx context.Context, monitor monitor.Monitorer) err
 	return nil
 }
 
+// runtimeColumns are owned by the scheduler and kept as-is by UpsertMonitor.
+var runtimeColumns = []string{"id", "created_at", "last_monitor_time", "is_monitoring", "dispatched", "snooze_until"}
+
+// UpsertMonitor creates the monitor or, when its ID already exists, replaces
+// its configuration while keeping the scheduler's runtime state.
+func (db *GormDb) UpsertMonitor(ctx context.Context, mon monitor.Monitorer) error {
+	stmt := &gorm.Statement{DB: db.DB}
+	if err := stmt.Parse(mon); err != nil {
+		return err
+	}
+
+	keep := runtimeColumns
+	if stateful, ok := mon.(monitor.StatefulMonitor); ok {
+		keep = append(lo.Keys(stateful.RuntimeState()), keep...)
+	}
+	columns, _ := lo.Difference(stmt.Schema.DBNames, keep)
+
+	return db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(columns),
+		}).
+		Create(mon).Error
+}
+
 func (db *GormDb) SaveResult(ctx context.Context, result monitor.MonitorResponser) error {
 	err := db.WithContext(ctx).Create(result).Error
 	if err != nil {
@@ -51,50 +149,268 @@ func (db *GormDb) SaveResult(ctx context.Context, result monitor.MonitorResponse
 	return nil
 }
 
+// Save stores result, making GormDb a result sink of the manager.
+func (db *GormDb) Save(ctx context.Context, result monitor.MonitorResponser) error {
+	return db.SaveResult(ctx, result)
+}
+
 func (db *GormDb) GetEnabledMonitorsByType(ctx context.Context, monitorType monitor.MonitorType) ([]monitor.Monitorer, error) {
-	var results []monitor.Monitorer
+	model, ok := modelByType(monitorType)
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %s", monitorType)
+	}
+
+	return model.find(db.WithContext(ctx).Where("enabled = true"), db.now)
+}
 
-	switch monitorType {
-	case monitor.TypeHTTP:
-		var monitors []monitor.HttpMonitor
-		if err := db.WithContext(ctx).Where("enabled = true").Find(&monitors).Error; err != nil {
+// GetEnabledMonitors returns the enabled monitors of every type.
+func (db *GormDb) GetEnabledMonitors(ctx context.Context) ([]monitor.Monitorer, error) {
+	var enabled []monitor.Monitorer
+	for _, model := range monitorModels {
+		monitors, err := model.find(db.WithContext(ctx).Where("enabled = true"), db.now)
+		if err != nil {
 			return nil, err
 		}
+		enabled = append(enabled, monitors...)
+	}
+	return enabled, nil
+}
 
-		results = lo.Map(monitors, func(item monitor.HttpMonitor, _ int) monitor.Monitorer {
-			return &item
-		})
-	case monitor.TypeUnknown:
-		fallthrough
-	default:
-		return nil, fmt.Errorf("unknown type: %s", monitorType)
+// GetMonitor returns the monitor with the given ID, whatever its type.
+func (db *GormDb) GetMonitor(ctx context.Context, id uint) (monitor.Monitorer, error) {
+	for _, model := range monitorModels {
+		monitors, err := model.find(db.WithContext(ctx).Where("id = ?", id), db.now)
+		if err != nil {
+			return nil, err
+		}
+		if len(monitors) > 0 {
+			return monitors[0], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+}
+
+// GetMonitorForUpdate returns the monitor with the given ID, locking its row
+// until the transaction ends, so that it can't be claimed meanwhile. It's
+// meant to be called within InTransaction. A monitor claimed by a check
+// returns ErrMonitorBusy.
+func (db *GormDb) GetMonitorForUpdate(ctx context.Context, id uint) (monitor.Monitorer, error) {
+	for _, model := range monitorModels {
+		query := db.WithContext(ctx).
+			Clauses(dbresolver.Write, clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id)
+		monitors, err := model.find(query, db.now)
+		if err != nil {
+			return nil, err
+		}
+		if len(monitors) == 0 {
+			continue
+		}
+		if monitors[0].GetBase().IsMonitoring {
+			return nil, fmt.Errorf("%w: %d", ErrMonitorBusy, id)
+		}
+		return monitors[0], nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+}
+
+// InTransaction calls fn with a Database running every call in a single
+// transaction, committed when fn returns nil and rolled back otherwise.
+func (db *GormDb) InTransaction(ctx context.Context, fn func(Database) error) error {
+	return db.WithContext(ctx).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormDb{DB: tx, now: db.now, archiver: db.archiver})
+	})
+}
+
+// GetMonitorsByOwner returns the monitors whose owner team or owner email is
+// owner, ordered by ID.
+func (db *GormDb) GetMonitorsByOwner(ctx context.Context, owner string) ([]monitor.Monitorer, error) {
+	var results []monitor.Monitorer
+	for _, model := range monitorModels {
+		tx := db.WithContext(ctx).Where("owner_team = ? OR owner_email = ?", owner, owner)
+		monitors, err := model.find(tx, db.now)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, monitors...)
 	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].GetBase().ID < results[j].GetBase().ID
+	})
 	return results, nil
 }
 
+// dueCondition selects the idle monitors BaseMonitor.Due reports due at the
+// time given twice. The interval column holds nanoseconds; rows created
+// before defer_until existed hold NULL there.
+const dueCondition = `enabled = true AND is_monitoring = false
+	AND last_monitor_time + make_interval(secs => "interval" / 1e9) < ?
+	AND (defer_until IS NULL OR defer_until <= ?)`
+
+// GetMonitorsToRun claims the monitors due for a check and returns them. A
+// claimed monitor is locked, is_monitoring set, so it isn't returned again,
+// here or to another scheduler, until it's unlocked.
 func (db *GormDb) GetMonitorsToRun(ctx context.Context) ([]monitor.Monitorer, error) {
 	var results []monitor.Monitorer
 
-	var monitors []monitor.HttpMonitor
-	if err := db.WithContext(ctx).Where("enabled = true AND is_monitoring = false").Find(&monitors).Error; err != nil {
+	nowTime := db.now()
+	// Scheduling must see the latest lock state, so never read it from a
+	// replica. Claims are all or nothing, so a failure leaves no monitor locked.
+	err := db.WithContext(ctx).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		for _, model := range monitorModels {
+			// Only due rows are locked. Rows being claimed concurrently are
+			// skipped rather than waited for.
+			query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where(dueCondition, nowTime, nowTime)
+			monitors, err := model.find(query, db.now)
+			if err != nil {
+				return err
+			}
+
+			var ids []uint
+			for _, mon := range monitors {
+				mon.GetBase().IsMonitoring = true
+				results = append(results, mon)
+				ids = append(ids, mon.GetBase().ID)
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			err = tx.Table(model.table).Where("id IN ?", ids).Update("is_monitoring", true).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	nowTime := now()
-	for _, mon := range monitors {
-		if mon.LastMonitorTime.Add(mon.Interval).Before(nowTime) {
-			results = append(results, &mon)
+	// Dispatch the most overdue monitors first, so a saturated tick delays
+	// the ones that can afford it
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].GetBase().Overdue(nowTime) > results[j].GetBase().Overdue(nowTime)
+	})
+	return results, nil
+}
+
+// DispatchMonitors marks the monitors due for a check as dispatched, for the
+// workers of any replica to claim with ClaimDispatched, and returns how many
+// it marked. It's meant for the elected scheduler, so that due monitors are
+// looked up once however many replicas share the database.
+func (db *GormDb) DispatchMonitors(ctx context.Context) (int64, error) {
+	nowTime := db.now()
+	var dispatched int64
+	for _, model := range monitorModels {
+		result := db.WithContext(ctx).
+			Clauses(dbresolver.Write).
+			Table(model.table).
+			Where(dueCondition+" AND dispatched = false", nowTime, nowTime).
+			Update("dispatched", true)
+		if result.Error != nil {
+			return dispatched, result.Error
+		}
+		dispatched += result.RowsAffected
+	}
+	return dispatched, nil
+}
+
+// ClaimDispatched claims up to limit of the monitors DispatchMonitors marked,
+// most overdue first, and returns them. Like GetMonitorsToRun, a claimed
+// monitor is locked until it's unlocked, and rows being claimed by another
+// replica are skipped. Dispatched monitors that are no longer due, e.g.
+// disabled or snoozed since, aren't claimed.
+func (db *GormDb) ClaimDispatched(ctx context.Context, limit int) ([]monitor.Monitorer, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var results []monitor.Monitorer
+	nowTime := db.now()
+	err := db.WithContext(ctx).Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		for _, model := range monitorModels {
+			remaining := limit - len(results)
+			if remaining == 0 {
+				break
+			}
+			query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("dispatched = true AND "+dueCondition, nowTime, nowTime).
+				Order(`last_monitor_time + make_interval(secs => "interval" / 1e9)`).
+				Limit(remaining)
+			monitors, err := model.find(query, db.now)
+			if err != nil {
+				return err
+			}
+
+			var ids []uint
+			for _, mon := range monitors {
+				mon.GetBase().IsMonitoring = true
+				mon.GetBase().Dispatched = false
+				results = append(results, mon)
+				ids = append(ids, mon.GetBase().ID)
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			err = tx.Table(model.table).Where("id IN ?", ids).
+				Updates(map[string]any{"is_monitoring": true, "dispatched": false}).Error
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].GetBase().Overdue(nowTime) > results[j].GetBase().Overdue(nowTime)
+	})
 	return results, nil
 }
 
-func (db *GormDb) Lock(ctx context.Context, mon monitor.Monitorer) error {
+// GetLastResults returns the latest result of each of the given monitors,
+// whatever their type.
+func (db *GormDb) GetLastResults(ctx context.Context, monitorIDs []uint) (map[uint]monitor.Result, error) {
+	results := make(map[uint]monitor.Result, len(monitorIDs))
+	for _, model := range monitorModels {
+		var rows []struct {
+			ID         uint
+			LastResult monitor.Result
+		}
+		err := db.WithContext(ctx).
+			Table(model.table).
+			Select("id", "last_result").
+			Where("id IN ?", monitorIDs).
+			Find(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			results[row.ID] = row.LastResult
+		}
+	}
+	return results, nil
+}
+
+func (db *GormDb) Unlock(ctx context.Context, mon monitor.Monitorer) error {
+	updates := map[string]any{
+		"is_monitoring":     false,
+		"last_monitor_time": db.now(),
+	}
+	if stateful, ok := mon.(monitor.StatefulMonitor); ok {
+		for column, value := range stateful.RuntimeState() {
+			updates[column] = value
+		}
+	}
+
 	result := db.WithContext(ctx).
 		Model(mon).
 		Where("id = ?", mon.GetBase().ID).
-		Update("is_monitoring", true)
+		Updates(updates)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -104,19 +420,62 @@ func (db *GormDb) Lock(ctx context.Context, mon monitor.Monitorer) error {
 	return nil
 }
 
-func (db *GormDb) Unlock(ctx context.Context, mon monitor.Monitorer) error {
+// SaveRuntimeState persists the runtime state of mon and its latest check
+// time, for results recorded outside of a scheduled check.
+func (db *GormDb) SaveRuntimeState(ctx context.Context, mon monitor.Monitorer) error {
+	stateful, ok := mon.(monitor.StatefulMonitor)
+	if !ok {
+		return nil
+	}
+
+	updates := stateful.RuntimeState()
+	updates["last_monitor_time"] = mon.GetBase().LastMonitorTime
 	result := db.WithContext(ctx).
 		Model(mon).
 		Where("id = ?", mon.GetBase().ID).
-		Updates(map[string]any{
-			"is_monitoring":     false,
-			"last_monitor_time": now(),
-		})
+		Updates(updates)
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("monitor with ID %d not found", mon.GetBase().ID)
+		return fmt.Errorf("%w: %d", ErrMonitorNotFound, mon.GetBase().ID)
 	}
 	return nil
 }
+
+// ForceUnlock clears the lock of monitor id whatever its state, for locks left
+// behind by a check that never finished.
+func (db *GormDb) ForceUnlock(ctx context.Context, id uint) error {
+	for _, model := range monitorModels {
+		result := db.WithContext(ctx).
+			Table(model.table).
+			Where("id = ?", id).
+			Update("is_monitoring", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			logging.Logger.Sugar().Warnf("force-unlocked monitor %d at %s", id, db.now().Format(time.RFC3339))
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+}
+
+// SnoozeMonitor suppresses the notifications of monitor id until the given
+// time. A time in the past ends the snooze.
+func (db *GormDb) SnoozeMonitor(ctx context.Context, id uint, until time.Time) error {
+	for _, model := range monitorModels {
+		result := db.WithContext(ctx).
+			Table(model.table).
+			Where("id = ?", id).
+			Update("snooze_until", until)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+}
@@ -2,11 +2,14 @@ package db
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"shraga/internal/monitor"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/suite"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -15,6 +18,7 @@ import (
 type GormDbTestSuite struct {
 	suite.Suite
 	container testcontainers.Container
+	dsn       string
 	db        *GormDb
 }
 
@@ -43,11 +47,11 @@ func (suite *GormDbTestSuite) SetupSuite() {
 	port, err := suite.container.MappedPort(ctx, "5432")
 	suite.Require().NoError(err)
 
-	dsn := "host=" + host + " port=" + port.Port() + " user=test password=test dbname=test sslmode=disable"
-	suite.db, err = NewGormDb(dsn)
+	suite.dsn = "host=" + host + " port=" + port.Port() + " user=test password=test dbname=test sslmode=disable"
+	suite.db, err = NewGormDb(suite.dsn)
 	suite.Require().NoError(err)
 
-	err = suite.db.AutoMigrate(&monitor.HttpMonitor{}, &monitor.HttpResponse{})
+	err = suite.db.AutoMigrate(migrationModels...)
 	suite.Require().NoError(err)
 }
 
@@ -56,7 +60,7 @@ func (suite *GormDbTestSuite) TearDownSuite() {
 }
 
 func (suite *GormDbTestSuite) SetupTest() {
-	err := suite.db.Exec("TRUNCATE TABLE http_monitors, http_responses RESTART IDENTITY CASCADE").Error
+	err := suite.db.Exec("TRUNCATE TABLE http_monitors, http_responses, ftp_monitors, sftp_monitors, file_transfer_responses, grpc_monitors, grpc_responses, tcp_monitors, tcp_responses, result_rollups, incidents, leases RESTART IDENTITY CASCADE").Error
 	suite.Require().NoError(err)
 }
 
@@ -80,6 +84,38 @@ func (suite *GormDbTestSuite) TestAddMonitor() {
 	suite.Equal(mon.Address, result.Address)
 }
 
+func (suite *GormDbTestSuite) TestUpsertMonitor_KeepsRuntimeState() {
+	lastRun := time.Now().Add(-time.Hour).Truncate(time.Second)
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:              1,
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: lastRun,
+		},
+		Address: "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(context.Background(), mon))
+
+	updated := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:       1,
+			Type:     monitor.TypeHTTP,
+			Enabled:  true,
+			Interval: 5 * time.Minute,
+		},
+		Address: "https://example.org",
+	}
+	suite.NoError(suite.db.UpsertMonitor(context.Background(), updated))
+
+	var result monitor.HttpMonitor
+	suite.NoError(suite.db.First(&result, 1).Error)
+	suite.Equal("https://example.org", result.Address)
+	suite.Equal(5*time.Minute, result.Interval)
+	suite.True(lastRun.Equal(result.LastMonitorTime))
+}
+
 func (suite *GormDbTestSuite) TestSaveResult() {
 
 	result := &monitor.HttpResponse{
@@ -99,6 +135,19 @@ func (suite *GormDbTestSuite) TestSaveResult() {
 	suite.Equal(result.Result, savedResult.Result)
 }
 
+func (suite *GormDbTestSuite) TestNewResultSink_MigratesOnlyResults() {
+	suite.Require().NoError(suite.db.Exec("CREATE DATABASE sink").Error)
+	sink, err := NewResultSink(strings.Replace(suite.dsn, "dbname=test", "dbname=sink", 1))
+	suite.Require().NoError(err)
+
+	suite.True(sink.Migrator().HasTable(&monitor.HttpResponse{}))
+	suite.False(sink.Migrator().HasTable(&monitor.HttpMonitor{}))
+	suite.False(sink.Migrator().HasTable(&monitor.Incident{}))
+
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, Result: monitor.ResultUp}}
+	suite.NoError(sink.Save(context.Background(), result))
+}
+
 func (suite *GormDbTestSuite) TestGetEnabledMonitorsByType() {
 
 	mon := &monitor.HttpMonitor{
@@ -135,8 +184,9 @@ func (suite *GormDbTestSuite) TestLockUnlock() {
 	err := suite.db.AddMonitor(context.Background(), mon)
 	suite.NoError(err)
 
-	err = suite.db.Lock(context.Background(), mon)
+	claimed, err := suite.db.GetMonitorsToRun(context.Background())
 	suite.NoError(err)
+	suite.Len(claimed, 1)
 
 	var lockedMonitor monitor.HttpMonitor
 	err = suite.db.First(&lockedMonitor, 1).Error
@@ -184,32 +234,643 @@ func (suite *GormDbTestSuite) TestGetMonitorsToRun() {
 	monitors, err := suite.db.GetMonitorsToRun(context.Background())
 	suite.NoError(err)
 	suite.Len(monitors, 2)
-	suite.Equal(mon1.ID, monitors[0].GetBase().ID)
-	suite.Equal(mon2.ID, monitors[1].GetBase().ID)
+	// mon2 is the most overdue
+	suite.Equal(mon2.ID, monitors[0].GetBase().ID)
+	suite.Equal(mon1.ID, monitors[1].GetBase().ID)
 }
 
-func (suite *GormDbTestSuite) TestGetEnabledMonitorsByType_UnknownType() {
+func (suite *GormDbTestSuite) TestGetMonitorsToRun_MultipleTypes() {
+	httpMon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: time.Now().Add(-2 * time.Minute),
+		},
+		Address: "https://example.com",
+	}
 
+	ftpMon := &monitor.FtpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: time.Now().Add(-2 * time.Minute),
+		},
+		FileTransferConfig: monitor.FileTransferConfig{Address: "ftp.example.com"},
+	}
 
-	_, err := suite.db.GetEnabledMonitorsByType(context.Background(), monitor.TypeUnknown)
-	suite.Error(err)
-	suite.Equal("unknown type: Unknown", err.Error())
+	suite.NoError(suite.db.AddMonitor(context.Background(), httpMon))
+	suite.NoError(suite.db.AddMonitor(context.Background(), ftpMon))
+	suite.NotEqual(httpMon.ID, ftpMon.ID)
+
+	monitors, err := suite.db.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Len(monitors, 2)
+	suite.Equal(monitor.TypeHTTP, monitors[0].GetType())
+	suite.Equal(monitor.TypeFTP, monitors[1].GetType())
+
+	ftpMonitors, err := suite.db.GetEnabledMonitorsByType(context.Background(), monitor.TypeFTP)
+	suite.NoError(err)
+	suite.Len(ftpMonitors, 1)
+	suite.Equal(ftpMon.ID, ftpMonitors[0].GetBase().ID)
 }
 
-func (suite *GormDbTestSuite) TestLock_Error() {
+func (suite *GormDbTestSuite) TestGetMonitorsToRun_WithClock() {
+	lastRun := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:              1,
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Hour,
+			LastMonitorTime: lastRun,
+		},
+		Address: "https://example.com",
+	}
+
+	err := suite.db.AddMonitor(context.Background(), mon)
+	suite.NoError(err)
+
+	simulated := lastRun.Add(30 * time.Minute)
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return simulated }}
+
+	monitors, err := clockDb.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Empty(monitors)
+
+	simulated = lastRun.Add(2 * time.Hour)
+	monitors, err = clockDb.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Len(monitors, 1)
+	suite.Equal(simulated, monitors[0].GetBase().Now())
+}
 
+func (suite *GormDbTestSuite) TestGetMonitorsToRun_Deferred() {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
 	mon := &monitor.HttpMonitor{
 		BaseMonitor: monitor.BaseMonitor{
-			ID:       1,
+			ID:              1,
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: now.Add(-time.Hour),
+			DeferUntil:      now.Add(time.Minute),
+		},
+		Address: "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(context.Background(), mon))
+
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return now }}
+	monitors, err := clockDb.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Empty(monitors)
+
+	now = now.Add(time.Minute)
+	monitors, err = clockDb.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Len(monitors, 1)
+}
+
+func (suite *GormDbTestSuite) TestGetMonitorsToRun_DistinctMonitors() {
+	var due []uint
+	for _, lastRun := range []time.Duration{-2 * time.Minute, -10 * time.Second, -5 * time.Minute, -3 * time.Minute} {
+		mon := &monitor.HttpMonitor{
+			BaseMonitor: monitor.BaseMonitor{
+				Type:            monitor.TypeHTTP,
+				Enabled:         true,
+				Interval:        time.Minute,
+				LastMonitorTime: time.Now().Add(lastRun),
+			},
+			Address: "https://example.com",
+		}
+		suite.NoError(suite.db.AddMonitor(context.Background(), mon))
+		if lastRun < -time.Minute {
+			due = append(due, mon.ID)
+		}
+	}
+
+	monitors, err := suite.db.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	ids := make([]uint, 0, len(monitors))
+	for _, mon := range monitors {
+		ids = append(ids, mon.GetBase().ID)
+	}
+	suite.ElementsMatch(due, ids)
+}
+
+func (suite *GormDbTestSuite) TestGetMonitorsToRun_ClaimsMonitors() {
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: time.Now().Add(-2 * time.Minute),
+		},
+		Address: "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(context.Background(), mon))
+
+	monitors, err := suite.db.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Len(monitors, 1)
+	suite.True(monitors[0].GetBase().IsMonitoring)
+
+	// A slow check is still running on the next tick
+	monitors, err = suite.db.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Empty(monitors)
+
+	suite.NoError(suite.db.ForceUnlock(context.Background(), mon.ID))
+	monitors, err = suite.db.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Len(monitors, 1)
+}
+
+func (suite *GormDbTestSuite) TestClaimDispatched() {
+	ctx := context.Background()
+	var ids []uint
+	for _, overdue := range []time.Duration{time.Minute, time.Hour, 0} {
+		mon := &monitor.HttpMonitor{
+			BaseMonitor: monitor.BaseMonitor{
+				Type:            monitor.TypeHTTP,
+				Enabled:         true,
+				Interval:        time.Minute,
+				LastMonitorTime: time.Now().Add(-time.Minute - overdue),
+			},
+			Address: "https://example.com",
+		}
+		if overdue == 0 {
+			mon.LastMonitorTime = time.Now()
+		}
+		suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+		ids = append(ids, mon.ID)
+	}
+
+	// Nothing is claimed until dispatched, and the monitor that isn't due
+	// isn't dispatched
+	monitors, err := suite.db.ClaimDispatched(ctx, 10)
+	suite.NoError(err)
+	suite.Empty(monitors)
+	dispatched, err := suite.db.DispatchMonitors(ctx)
+	suite.NoError(err)
+	suite.Equal(int64(2), dispatched)
+	dispatched, err = suite.db.DispatchMonitors(ctx)
+	suite.NoError(err)
+	suite.Zero(dispatched)
+
+	// Claimed up to the limit, most overdue first
+	monitors, err = suite.db.ClaimDispatched(ctx, 1)
+	suite.NoError(err)
+	suite.Require().Len(monitors, 1)
+	suite.Equal(ids[1], monitors[0].GetBase().ID)
+	suite.True(monitors[0].GetBase().IsMonitoring)
+
+	monitors, err = suite.db.ClaimDispatched(ctx, 10)
+	suite.NoError(err)
+	suite.Require().Len(monitors, 1)
+	suite.Equal(ids[0], monitors[0].GetBase().ID)
+
+	// Claimed monitors aren't dispatched again until unlocked
+	dispatched, err = suite.db.DispatchMonitors(ctx)
+	suite.NoError(err)
+	suite.Zero(dispatched)
+}
+
+func (suite *GormDbTestSuite) TestGetMonitorsToRun_MostOverdueFirst() {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	slightly := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: now.Add(-2 * time.Minute),
+		},
+		Address: "https://example.com",
+	}
+	very := &monitor.FtpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			Enabled:         true,
+			Interval:        time.Minute,
+			LastMonitorTime: now.Add(-time.Hour),
+		},
+		FileTransferConfig: monitor.FileTransferConfig{Address: "ftp.example.com"},
+	}
+	suite.NoError(suite.db.AddMonitor(context.Background(), slightly))
+	suite.NoError(suite.db.AddMonitor(context.Background(), very))
+
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return now }}
+	monitors, err := clockDb.GetMonitorsToRun(context.Background())
+	suite.NoError(err)
+	suite.Len(monitors, 2)
+	suite.Equal(very.ID, monitors[0].GetBase().ID)
+	suite.Equal(slightly.ID, monitors[1].GetBase().ID)
+}
+
+func (suite *GormDbTestSuite) TestRollupResults() {
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:               1,
+			Type:             monitor.TypeHTTP,
+			Enabled:          true,
+			Interval:         5 * time.Second,
+			AggregateResults: lo.ToPtr(true),
+			RawRetention:     10 * time.Minute,
+		},
+		Address: "https://example.com",
+	}
+	err := suite.db.AddMonitor(context.Background(), mon)
+	suite.NoError(err)
+
+	now := time.Date(2020, 1, 1, 12, 30, 30, 0, time.UTC)
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return now }}
+
+	// Two results in an old minute and two in a recent one
+	old := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	recent := time.Date(2020, 1, 1, 12, 25, 0, 0, time.UTC)
+	for _, result := range []*monitor.HttpResponse{
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: old, Result: monitor.ResultUp}, Latency: 10},
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: old.Add(time.Second), Result: monitor.ResultDown}, Latency: 30},
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: recent, Result: monitor.ResultUp}, Latency: 20},
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: recent.Add(time.Second), Result: monitor.ResultUp}, Latency: 40},
+	} {
+		suite.NoError(suite.db.SaveResult(context.Background(), result))
+	}
+
+	suite.NoError(clockDb.RollupResults(context.Background(), false, time.Hour))
+	// Running again must not double count
+	suite.NoError(clockDb.RollupResults(context.Background(), false, time.Hour))
+
+	rollups, err := clockDb.GetRollups(context.Background(), 1, old, now)
+	suite.NoError(err)
+	suite.Require().Len(rollups, 2)
+	suite.True(old.Equal(rollups[0].Bucket))
+	suite.Equal(int64(2), rollups[0].Count)
+	suite.Equal(int64(1), rollups[0].UpCount)
+	suite.Equal(int64(1), rollups[0].DownCount)
+	suite.Equal(int64(10), rollups[0].MinLatency)
+	suite.Equal(int64(30), rollups[0].MaxLatency)
+	suite.Equal(20.0, rollups[0].AvgLatency())
+	suite.Equal(int64(2), rollups[1].UpCount)
+
+	// Only the results within the raw retention window are kept
+	var remaining int64
+	suite.NoError(suite.db.Model(&monitor.HttpResponse{}).Count(&remaining).Error)
+	suite.Equal(int64(2), remaining)
+}
+
+func (suite *GormDbTestSuite) TestRollupResults_DefaultSampling() {
+	ctx := context.Background()
+	for id, aggregate := range map[uint]*bool{1: nil, 2: lo.ToPtr(false)} {
+		mon := &monitor.HttpMonitor{
+			BaseMonitor: monitor.BaseMonitor{ID: id, Type: monitor.TypeHTTP, Interval: time.Minute, AggregateResults: aggregate},
+			Address:     "https://example.com",
+		}
+		suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+	}
+
+	old := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []uint{1, 2} {
+		suite.NoError(suite.db.SaveResult(ctx, &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{
+			MonitorID: id, ResponseTime: old, Result: monitor.ResultUp,
+		}}))
+	}
+
+	// Monitor 1 follows the default, monitor 2 opted out of aggregation
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return old.Add(2 * time.Hour) }}
+	suite.NoError(clockDb.RollupResults(ctx, true, time.Hour))
+
+	var remaining []uint
+	suite.NoError(suite.db.Model(&monitor.HttpResponse{}).Pluck("monitor_id", &remaining).Error)
+	suite.Equal([]uint{2}, remaining)
+	rollups, err := clockDb.GetRollups(ctx, 1, old, old.Add(time.Minute))
+	suite.NoError(err)
+	suite.Len(rollups, 1)
+}
+
+func (suite *GormDbTestSuite) TestGetTimeseries() {
+	ctx := context.Background()
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:               1,
+			Type:             monitor.TypeHTTP,
+			Enabled:          true,
+			Interval:         5 * time.Second,
+			AggregateResults: lo.ToPtr(true),
+			RawRetention:     10 * time.Minute,
+		},
+		Address: "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(ctx, mon))
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, result := range []*monitor.HttpResponse{
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: start, Result: monitor.ResultUp}, Latency: 10},
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: start.Add(time.Minute), Result: monitor.ResultDown}, Latency: 30},
+		// 12:05-12:10 is empty
+		{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: start.Add(25 * time.Minute), Result: monitor.ResultWarn}, Latency: 40},
+	} {
+		suite.NoError(suite.db.SaveResult(ctx, result))
+	}
+	// Roll the first minutes up and purge their raw results
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return start.Add(30 * time.Minute) }}
+	suite.NoError(clockDb.RollupResults(ctx, false, time.Hour))
+
+	buckets, err := suite.db.GetTimeseries(ctx, 1, start.Add(2*time.Minute), start.Add(30*time.Minute), 10*time.Minute)
+	suite.NoError(err)
+	suite.Require().Len(buckets, 3)
+	suite.True(start.Equal(buckets[0].Start), "the range start is aligned to the step")
+	suite.Equal(int64(2), buckets[0].Count)
+	suite.Equal(int64(1), buckets[0].UpCount)
+	suite.Equal(int64(1), buckets[0].DownCount)
+	suite.Equal(20.0, buckets[0].AvgLatency)
+	suite.Equal(int64(30), buckets[0].MaxLatency)
+	suite.Equal(int64(0), buckets[1].Count)
+	suite.Equal(int64(1), buckets[2].WarnCount)
+	suite.Equal(int64(40), buckets[2].MaxLatency)
+
+	_, err = suite.db.GetTimeseries(ctx, 1, start, start.Add(time.Hour), 1500*time.Millisecond)
+	suite.ErrorIs(err, ErrInvalidRange)
+	_, err = suite.db.GetTimeseries(ctx, 99, start, start.Add(time.Hour), time.Minute)
+	suite.ErrorIs(err, ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestGetReasonBreakdown() {
+	ctx := context.Background()
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP, Enabled: true, Interval: time.Minute},
+		Address:     "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(ctx, mon))
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, result := range []monitor.BaseMonitorResponse{
+		{Result: monitor.ResultUp},
+		{Result: monitor.ResultDown, Reason: monitor.ReasonTimeout},
+		{Result: monitor.ResultDown, Reason: monitor.ReasonTimeout},
+		{Result: monitor.ResultDown, Reason: monitor.ReasonConnRefused},
+		{Result: monitor.ResultWarn},
+	} {
+		result.MonitorID = 1
+		result.ResponseTime = start.Add(time.Duration(i) * time.Minute)
+		suite.NoError(suite.db.SaveResult(ctx, &monitor.HttpResponse{BaseMonitorResponse: result}))
+	}
+
+	breakdown, err := suite.db.GetReasonBreakdown(ctx, 1, start, start.Add(time.Hour))
+	suite.NoError(err)
+	suite.Equal(map[monitor.Reason]int{
+		monitor.ReasonTimeout:     2,
+		monitor.ReasonConnRefused: 1,
+		monitor.ReasonNone:        1,
+	}, breakdown)
+
+	breakdown, err = suite.db.GetReasonBreakdown(ctx, 1, start, start.Add(2*time.Minute))
+	suite.NoError(err)
+	suite.Equal(map[monitor.Reason]int{monitor.ReasonTimeout: 1}, breakdown)
+
+	_, err = suite.db.GetReasonBreakdown(ctx, 1, start, start)
+	suite.ErrorIs(err, ErrInvalidRange)
+	_, err = suite.db.GetReasonBreakdown(ctx, 99, start, start.Add(time.Hour))
+	suite.ErrorIs(err, ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestPurgeResults() {
+	critical := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:              1,
+			Type:            monitor.TypeHTTP,
+			Enabled:         true,
+			Interval:        time.Minute,
+			ResultRetention: 90 * 24 * time.Hour,
+		},
+		Address: "https://example.com",
+	}
+	noisy := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			ID:       2,
 			Type:     monitor.TypeHTTP,
 			Enabled:  true,
 			Interval: time.Minute,
 		},
-		Address: "https://example.com",
+		Address: "https://example.org",
 	}
+	suite.NoError(suite.db.AddMonitor(context.Background(), critical))
+	suite.NoError(suite.db.AddMonitor(context.Background(), noisy))
+
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return now }}
+
+	monthAgo := now.Add(-30 * 24 * time.Hour)
+	for _, monitorID := range []uint{1, 2} {
+		result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: monitorID, ResponseTime: monthAgo}}
+		suite.NoError(suite.db.SaveResult(context.Background(), result))
+	}
+
+	// The noisy monitor falls back to the one week default
+	suite.NoError(clockDb.PurgeResults(context.Background(), 7*24*time.Hour))
+
+	var remaining []monitor.HttpResponse
+	suite.NoError(suite.db.Find(&remaining).Error)
+	suite.Require().Len(remaining, 1)
+	suite.Equal(uint(1), remaining[0].MonitorID)
+}
+
+type fakeArchiver struct {
+	days    []time.Time
+	results []map[string]any
+}
+
+func (f *fakeArchiver) Archive(_ context.Context, _ uint, day time.Time, results []map[string]any) error {
+	f.days = append(f.days, day)
+	f.results = append(f.results, results...)
+	return nil
+}
+
+func (suite *GormDbTestSuite) TestPurgeResults_Archives() {
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP, Enabled: true, Interval: time.Minute},
+		Address:     "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(context.Background(), mon))
+
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	archiver := &fakeArchiver{}
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return now }, archiver: archiver}
+
+	for _, at := range []time.Time{now.Add(-10 * 24 * time.Hour), now.Add(-9 * 24 * time.Hour), now.Add(-time.Hour)} {
+		result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, ResponseTime: at}}
+		suite.NoError(suite.db.SaveResult(context.Background(), result))
+	}
+
+	suite.NoError(clockDb.PurgeResults(context.Background(), 7*24*time.Hour))
+
+	suite.Equal([]time.Time{now.Add(-10 * 24 * time.Hour), now.Add(-9 * 24 * time.Hour)}, archiver.days)
+	suite.Len(archiver.results, 2)
+	var remaining []monitor.HttpResponse
+	suite.NoError(suite.db.Find(&remaining).Error)
+	suite.Len(remaining, 1)
+}
+
+func (suite *GormDbTestSuite) TestUpdateIncident_AndGetOverview() {
+	for _, id := range []uint{1, 2} {
+		mon := &monitor.HttpMonitor{
+			BaseMonitor: monitor.BaseMonitor{
+				ID:         id,
+				Type:       monitor.TypeHTTP,
+				Enabled:    true,
+				Interval:   time.Minute,
+				LastResult: monitor.ResultUp,
+			},
+			Address: "https://example.com",
+		}
+		suite.NoError(suite.db.AddMonitor(context.Background(), mon))
+	}
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	down := func(id uint, at time.Time) *monitor.HttpResponse {
+		return &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{
+			MonitorID: id, ResponseTime: at, Result: monitor.ResultDown, Reason: monitor.ReasonTimeout,
+		}}
+	}
+	up := func(id uint, at time.Time) *monitor.HttpResponse {
+		return &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{
+			MonitorID: id, ResponseTime: at, Result: monitor.ResultUp,
+		}}
+	}
+
+	// Monitor 1 is down for 10 minutes, monitor 2 goes down and stays down
+	var closed []*monitor.Incident
+	for _, result := range []*monitor.HttpResponse{
+		down(1, start), down(1, start.Add(time.Minute)), up(1, start.Add(10*time.Minute)),
+		down(2, start.Add(20*time.Minute)),
+	} {
+		incident, err := suite.db.UpdateIncident(context.Background(), result)
+		suite.NoError(err)
+		if incident != nil {
+			closed = append(closed, incident)
+		}
+	}
+	suite.Require().Len(closed, 1)
+	suite.Equal(uint(1), closed[0].MonitorID)
+	suite.Equal(10*time.Minute, closed[0].Duration(start.Add(time.Hour)))
+
+	open, err := suite.db.GetOpenIncidents(context.Background())
+	suite.NoError(err)
+	suite.Require().Len(open, 1)
+	suite.Equal(uint(2), open[0].MonitorID)
+	suite.Equal(monitor.ReasonTimeout, open[0].Reason)
+
+	now := start.Add(time.Hour)
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return now }}
+	overview, err := clockDb.GetOverview(context.Background(), start, 10)
+	suite.NoError(err)
+	suite.Equal(2, overview.Counts[monitor.ResultUp])
+	suite.Require().Len(overview.Worst, 2)
+	suite.Equal(uint(2), overview.Worst[0].MonitorID)
+	suite.Equal(40*time.Minute, overview.Worst[0].Downtime)
+	suite.Equal(10*time.Minute, overview.Worst[1].Downtime)
+	suite.Len(overview.OpenIncidents, 1)
+}
+
+func (suite *GormDbTestSuite) TestRebuildIncidents() {
+	ctx := context.Background()
+	mon := &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP, Enabled: true, Interval: time.Minute},
+		Address:     "https://example.com",
+	}
+	suite.NoError(suite.db.AddMonitor(ctx, mon))
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, result := range []monitor.Result{
+		monitor.ResultUp, monitor.ResultDown, monitor.ResultDown, monitor.ResultWarn, monitor.ResultDown,
+	} {
+		suite.NoError(suite.db.SaveResult(ctx, &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{
+			MonitorID: 1, ResponseTime: start.Add(time.Duration(i) * time.Minute), Result: result, Reason: monitor.ReasonTimeout,
+		}}))
+	}
+	// A stale incident is replaced
+	suite.NoError(suite.db.Create(&monitor.Incident{MonitorID: 1, StartedAt: start.Add(-time.Hour)}).Error)
+
+	suite.NoError(suite.db.RebuildIncidents(ctx, 1))
+
+	var incidents []monitor.Incident
+	suite.NoError(suite.db.Where("monitor_id = ?", 1).Order("started_at").Find(&incidents).Error)
+	suite.Require().Len(incidents, 2)
+	suite.True(start.Add(time.Minute).Equal(incidents[0].StartedAt))
+	suite.Require().NotNil(incidents[0].EndedAt)
+	suite.Equal(2*time.Minute, incidents[0].Duration(start))
+	suite.Equal(monitor.ReasonTimeout, incidents[0].Reason)
+	suite.True(incidents[1].IsOpen())
+
+	suite.ErrorIs(suite.db.RebuildIncidents(ctx, 99), ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestGetMonitorsByOwner() {
+	ctx := context.Background()
+	suite.NoError(suite.db.AddMonitor(ctx, &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 2, Type: monitor.TypeTCP, OwnerTeam: "payments"},
+		Host:        "example.com",
+		Ports:       []int{22},
+	}))
+	suite.NoError(suite.db.AddMonitor(ctx, &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 1, Type: monitor.TypeHTTP, OwnerEmail: "payments"},
+		Address:     "https://example.com",
+	}))
+	suite.NoError(suite.db.AddMonitor(ctx, &monitor.HttpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 3, Type: monitor.TypeHTTP, OwnerTeam: "search"},
+		Address:     "https://example.com",
+	}))
+
+	monitors, err := suite.db.GetMonitorsByOwner(ctx, "payments")
+	suite.NoError(err)
+	suite.Require().Len(monitors, 2)
+	suite.Equal(uint(1), monitors[0].GetBase().ID)
+	suite.Equal(uint(2), monitors[1].GetBase().ID)
+	suite.Equal(monitor.TypeTCP, monitors[1].GetType())
+}
+
+func (suite *GormDbTestSuite) TestGetDownMonitors() {
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for id, result := range map[uint]monitor.Result{1: monitor.ResultUp, 2: monitor.ResultDown} {
+		mon := &monitor.HttpMonitor{
+			BaseMonitor: monitor.BaseMonitor{
+				ID:         id,
+				Type:       monitor.TypeHTTP,
+				Enabled:    true,
+				Interval:   time.Minute,
+				LastResult: result,
+			},
+			Address: "https://example.com",
+		}
+		if result == monitor.ResultDown {
+			mon.ConsecutiveFailures = 3
+		}
+		suite.NoError(suite.db.AddMonitor(ctx, mon))
+	}
+	_, err := suite.db.UpdateIncident(ctx, &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{
+		MonitorID: 2, ResponseTime: start, Result: monitor.ResultDown, Reason: monitor.ReasonConnRefused, ErrorMsg: "refused",
+	}})
+	suite.NoError(err)
 
-	err := suite.db.Lock(context.Background(), mon)
+	clockDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return start.Add(15 * time.Minute) }}
+	down, err := clockDb.GetDownMonitors(ctx)
+	suite.NoError(err)
+	suite.Require().Len(down, 1)
+	suite.Equal(uint(2), down[0].MonitorID)
+	suite.Equal(monitor.TypeHTTP, down[0].Type)
+	suite.True(start.Equal(down[0].DownSince))
+	suite.Equal(15*time.Minute, down[0].Downtime)
+	suite.Equal(monitor.ReasonConnRefused, down[0].Reason)
+	suite.Equal("refused", down[0].ErrorMsg)
+	suite.Equal(3, down[0].ConsecutiveFailures)
+}
+
+func (suite *GormDbTestSuite) TestGetEnabledMonitorsByType_UnknownType() {
+
+
+	_, err := suite.db.GetEnabledMonitorsByType(context.Background(), monitor.TypeUnknown)
 	suite.Error(err)
+	suite.Equal("unknown type: Unknown", err.Error())
 }
 
 func (suite *GormDbTestSuite) TestUnlock_Error() {
@@ -228,6 +889,213 @@ func (suite *GormDbTestSuite) TestUnlock_Error() {
 	suite.Error(err)
 }
 
+func (suite *GormDbTestSuite) TestForceUnlock() {
+	ctx := context.Background()
+	mon := &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{
+			Type:     monitor.TypeTCP,
+			Enabled:  true,
+			Interval: time.Minute,
+		},
+		Host:  "localhost",
+		Ports: []int{22},
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+	claimed, err := suite.db.GetMonitorsToRun(ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(claimed, 1)
+
+	suite.NoError(suite.db.ForceUnlock(ctx, mon.ID))
+
+	var locked bool
+	suite.Require().NoError(suite.db.Table("tcp_monitors").Select("is_monitoring").Where("id = ?", mon.ID).Scan(&locked).Error)
+	suite.False(locked)
+
+	suite.ErrorIs(suite.db.ForceUnlock(ctx, 999), ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestSaveRuntimeState() {
+	ctx := context.Background()
+	mon := &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{Type: monitor.TypeTCP, Interval: time.Minute},
+		Host:        "localhost",
+		Ports:       []int{22},
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+
+	mon.LastResult = monitor.ResultDown
+	mon.ConsecutiveFailures = 2
+	suite.NoError(suite.db.SaveRuntimeState(ctx, mon))
+
+	found, err := suite.db.GetMonitor(ctx, mon.ID)
+	suite.Require().NoError(err)
+	suite.Equal(monitor.ResultDown, found.GetBase().LastResult)
+	suite.Equal(2, found.GetBase().ConsecutiveFailures)
+	suite.False(found.GetBase().IsMonitoring)
+}
+
+func (suite *GormDbTestSuite) TestInTransaction_GetMonitorForUpdate() {
+	ctx := context.Background()
+	mon := &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{Type: monitor.TypeTCP, Enabled: true, Interval: time.Minute},
+		Host:        "localhost",
+		Ports:       []int{22},
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+
+	// A failure rolls back every write of the transaction
+	failed := errors.New("failed")
+	err := suite.db.InTransaction(ctx, func(tx Database) error {
+		locked, err := tx.GetMonitorForUpdate(ctx, mon.ID)
+		suite.Require().NoError(err)
+		locked.GetBase().LastResult = monitor.ResultDown
+		suite.Require().NoError(tx.SaveRuntimeState(ctx, locked))
+		return failed
+	})
+	suite.ErrorIs(err, failed)
+	found, err := suite.db.GetMonitor(ctx, mon.ID)
+	suite.Require().NoError(err)
+	suite.Equal(monitor.ResultUnknown, found.GetBase().LastResult)
+
+	claimed, err := suite.db.GetMonitorsToRun(ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(claimed, 1)
+	_, err = suite.db.GetMonitorForUpdate(ctx, mon.ID)
+	suite.ErrorIs(err, ErrMonitorBusy)
+	_, err = suite.db.GetMonitorForUpdate(ctx, 999)
+	suite.ErrorIs(err, ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestGetDependencyGraph() {
+	ctx := context.Background()
+	database := &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{Type: monitor.TypeTCP, Interval: time.Minute},
+		Host:        "localhost",
+		Ports:       []int{5432},
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, database))
+	api := &monitor.HttpMonitor{
+		BaseMonitor:   monitor.BaseMonitor{Type: monitor.TypeHTTP, Interval: time.Minute, DependsOn: []uint{database.ID}},
+		Address:       "http://localhost",
+		RequestMethod: "GET",
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, api))
+	database.LastResult = monitor.ResultDown
+	suite.Require().NoError(suite.db.SaveRuntimeState(ctx, database))
+
+	graph, err := suite.db.GetDependencyGraph(ctx)
+	suite.Require().NoError(err)
+	suite.Equal(map[uint]DependencyNode{
+		database.ID: {LastResult: monitor.ResultDown},
+		api.ID:      {DependsOn: []uint{database.ID}},
+	}, graph)
+}
+
+func (suite *GormDbTestSuite) TestSnoozeMonitor() {
+	ctx := context.Background()
+	mon := &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{Type: monitor.TypeTCP, Interval: time.Minute},
+		Host:        "localhost",
+		Ports:       []int{22},
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+
+	until := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	suite.NoError(suite.db.SnoozeMonitor(ctx, mon.ID, until))
+
+	found, err := suite.db.GetMonitor(ctx, mon.ID)
+	suite.Require().NoError(err)
+	suite.True(until.Equal(found.GetBase().SnoozeUntil))
+
+	// Syncing the monitor keeps the snooze
+	suite.Require().NoError(suite.db.UpsertMonitor(ctx, mon))
+	found, err = suite.db.GetMonitor(ctx, mon.ID)
+	suite.Require().NoError(err)
+	suite.True(until.Equal(found.GetBase().SnoozeUntil))
+
+	suite.ErrorIs(suite.db.SnoozeMonitor(ctx, 999, until), ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestGetMonitor() {
+	ctx := context.Background()
+	mon := &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{Type: monitor.TypeTCP, Interval: time.Minute},
+		Host:        "localhost",
+		Ports:       []int{22},
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+
+	found, err := suite.db.GetMonitor(ctx, mon.ID)
+	suite.Require().NoError(err)
+	suite.Equal([]int{22}, found.(*monitor.TcpMonitor).Ports)
+
+	_, err = suite.db.GetMonitor(ctx, 999)
+	suite.ErrorIs(err, ErrMonitorNotFound)
+}
+
+func (suite *GormDbTestSuite) TestSetEnabledByTag() {
+	ctx := context.Background()
+	for id, tags := range map[uint]map[string]string{
+		1: {"region": "eu", "team": "web"},
+		2: {"region": "us"},
+		3: nil,
+	} {
+		mon := &monitor.HttpMonitor{
+			BaseMonitor: monitor.BaseMonitor{ID: id, Type: monitor.TypeHTTP, Enabled: true, Interval: time.Minute, Tags: tags},
+			Address:     "https://example.com",
+		}
+		suite.Require().NoError(suite.db.AddMonitor(ctx, mon))
+	}
+	suite.Require().NoError(suite.db.AddMonitor(ctx, &monitor.TcpMonitor{
+		BaseMonitor: monitor.BaseMonitor{ID: 4, Enabled: true, Interval: time.Minute, Tags: map[string]string{"region": "eu"}},
+		Host:        "localhost",
+		Ports:       []int{22},
+	}))
+
+	affected, err := suite.db.SetEnabledByTag(ctx, map[string]string{"region": "eu"}, false)
+	suite.NoError(err)
+	suite.Equal(int64(2), affected)
+
+	monitors, err := suite.db.GetEnabledMonitorsByType(ctx, monitor.TypeHTTP)
+	suite.NoError(err)
+	var enabled []uint
+	for _, mon := range monitors {
+		enabled = append(enabled, mon.GetBase().ID)
+	}
+	suite.ElementsMatch([]uint{2, 3}, enabled)
+
+	_, err = suite.db.SetEnabledByTag(ctx, nil, false)
+	suite.Error(err)
+}
+
+func (suite *GormDbTestSuite) TestAcquireLease() {
+	ctx := context.Background()
+	// The local clock is ignored, expiry follows the database's
+	skewedDb := &GormDb{DB: suite.db.DB, now: func() time.Time { return time.Now().Add(time.Hour) }}
+
+	acquired, err := skewedDb.AcquireLease(ctx, "scheduler", "a", 10*time.Second)
+	suite.NoError(err)
+	suite.True(acquired)
+
+	// Held by a until it expires, and renewable by a
+	acquired, err = skewedDb.AcquireLease(ctx, "scheduler", "b", 10*time.Second)
+	suite.NoError(err)
+	suite.False(acquired)
+	acquired, err = skewedDb.AcquireLease(ctx, "scheduler", "a", 10*time.Second)
+	suite.NoError(err)
+	suite.True(acquired)
+
+	suite.NoError(suite.db.Exec("UPDATE leases SET expires_at = now() - interval '1 second'").Error)
+	acquired, err = skewedDb.AcquireLease(ctx, "scheduler", "b", 10*time.Second)
+	suite.NoError(err)
+	suite.True(acquired)
+
+	suite.NoError(skewedDb.ReleaseLease(ctx, "scheduler", "b"))
+	acquired, err = skewedDb.AcquireLease(ctx, "scheduler", "a", 10*time.Second)
+	suite.NoError(err)
+	suite.True(acquired)
+}
+
 func TestGormDbTestSuite(t *testing.T) {
 	suite.Run(t, new(GormDbTestSuite))
 }
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"shraga/internal/monitor"
+
+	"gorm.io/gorm"
+)
+
+// UpdateIncident opens an incident when result is down and its monitor has
+// none open, and closes the open incident when result isn't down. The closed
+// incident is returned, nil when none was.
+func (db *GormDb) UpdateIncident(ctx context.Context, result monitor.MonitorResponser) (*monitor.Incident, error) {
+	base := result.GetBaseMonitorResponse()
+
+	var open monitor.Incident
+	err := db.WithContext(ctx).
+		Where("monitor_id = ? AND ended_at IS NULL", base.MonitorID).
+		First(&open).Error
+	hasOpen := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	switch {
+	case base.Result == monitor.ResultDown && !hasOpen:
+		return nil, db.WithContext(ctx).Create(&monitor.Incident{
+			MonitorID: base.MonitorID,
+			StartedAt: base.ResponseTime,
+			Reason:    base.Reason,
+			ErrorMsg:  base.ErrorMsg,
+		}).Error
+	case base.Result != monitor.ResultDown && hasOpen:
+		err = db.WithContext(ctx).
+			Model(&open).
+			Update("ended_at", base.ResponseTime).Error
+		if err != nil {
+			return nil, err
+		}
+		open.EndedAt = &base.ResponseTime
+		return &open, nil
+	}
+	return nil, nil
+}
+
+// GetOpenIncidents returns every incident still open, oldest first.
+func (db *GormDb) GetOpenIncidents(ctx context.Context) ([]monitor.Incident, error) {
+	var incidents []monitor.Incident
+	err := db.WithContext(ctx).
+		Where("ended_at IS NULL").
+		Order("started_at").
+		Find(&incidents).Error
+	if err != nil {
+		return nil, err
+	}
+	return incidents, nil
+}
+
+// RebuildIncidents replaces the incidents of a monitor with ones
+// reconstructed from its stored results, scanned in time order with the same
+// rules as UpdateIncident. Results already removed by retention leave gaps
+// that can't be recovered.
+func (db *GormDb) RebuildIncidents(ctx context.Context, monitorID uint) error {
+	resultTable, err := db.resultTableOf(ctx, monitorID)
+	if err != nil {
+		return err
+	}
+
+	var results []monitor.BaseMonitorResponse
+	err = db.WithContext(ctx).
+		Table(resultTable).
+		Select("response_time, result, reason, error_msg").
+		Where("monitor_id = ?", monitorID).
+		Order("response_time, id").
+		Scan(&results).Error
+	if err != nil {
+		return err
+	}
+
+	var incidents []monitor.Incident
+	for _, result := range results {
+		open := len(incidents) > 0 && incidents[len(incidents)-1].IsOpen()
+		switch {
+		case result.Result == monitor.ResultDown && !open:
+			incidents = append(incidents, monitor.Incident{
+				MonitorID: monitorID,
+				StartedAt: result.ResponseTime,
+				Reason:    result.Reason,
+				ErrorMsg:  result.ErrorMsg,
+			})
+		case result.Result != monitor.ResultDown && open:
+			endedAt := result.ResponseTime
+			incidents[len(incidents)-1].EndedAt = &endedAt
+		}
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("monitor_id = ?", monitorID).Delete(&monitor.Incident{}).Error; err != nil {
+			return err
+		}
+		if len(incidents) == 0 {
+			return nil
+		}
+		return tx.Create(&incidents).Error
+	})
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Lease is held by one replica at a time until ExpiresAt, e.g. to elect the
+// scheduler among several shraga replicas.
+type Lease struct {
+	Name      string `gorm:"primaryKey"`
+	Holder    string
+	ExpiresAt time.Time
+}
+
+// AcquireLease takes the lease name for holder until ttl from now, or renews
+// it if holder already has it. It reports whether holder has the lease, which
+// it can't while another holder's lease hasn't expired. Expiry is computed
+// with the database clock, which every replica shares, so clock skew between
+// replicas can't hand the lease to two of them.
+func (db *GormDb) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	result := db.WithContext(ctx).Exec(`
+INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, now() + make_interval(secs => ?))
+ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()`,
+		name, holder, ttl.Seconds())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseLease gives up the lease name if holder has it, so another replica
+// can take it over without waiting for it to expire.
+func (db *GormDb) ReleaseLease(ctx context.Context, name, holder string) error {
+	return db.WithContext(ctx).
+		Where("name = ? AND holder = ?", name, holder).
+		Delete(&Lease{}).Error
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"shraga/internal/monitor"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// monitorModel describes how one monitor type is persisted.
+type monitorModel struct {
+	monitorType monitor.MonitorType
+	table       string
+	resultTable string
+	find        func(tx *gorm.DB, now func() time.Time) ([]monitor.Monitorer, error)
+}
+
+// monitorModels lists every persisted monitor type, in scheduling order.
+var monitorModels = []monitorModel{
+	{monitor.TypeHTTP, "http_monitors", "http_responses", findMonitors[monitor.HttpMonitor]},
+	{monitor.TypeFTP, "ftp_monitors", "file_transfer_responses", findMonitors[monitor.FtpMonitor]},
+	{monitor.TypeSFTP, "sftp_monitors", "file_transfer_responses", findMonitors[monitor.SftpMonitor]},
+	{monitor.TypeGRPC, "grpc_monitors", "grpc_responses", findMonitors[monitor.GrpcMonitor]},
+	{monitor.TypeTCP, "tcp_monitors", "tcp_responses", findMonitors[monitor.TcpMonitor]},
+	{monitor.TypeSitemap, "sitemap_monitors", "sitemap_responses", findMonitors[monitor.SitemapMonitor]},
+}
+
+// migrationModels lists every model managed by AutoMigrate.
+var migrationModels = []any{
+	&monitor.HttpMonitor{},
+	&monitor.HttpResponse{},
+	&monitor.FtpMonitor{},
+	&monitor.SftpMonitor{},
+	&monitor.FileTransferResponse{},
+	&monitor.GrpcMonitor{},
+	&monitor.GrpcResponse{},
+	&monitor.TcpMonitor{},
+	&monitor.TcpResponse{},
+	&monitor.SitemapMonitor{},
+	&monitor.SitemapResponse{},
+	&monitor.ResultRollup{},
+	&monitor.Incident{},
+	&Lease{},
+}
+
+// resultModels lists the models of the results of every monitor type.
+var resultModels = []any{
+	&monitor.HttpResponse{},
+	&monitor.FileTransferResponse{},
+	&monitor.GrpcResponse{},
+	&monitor.TcpResponse{},
+	&monitor.SitemapResponse{},
+}
+
+func modelByType(monitorType monitor.MonitorType) (monitorModel, bool) {
+	for _, model := range monitorModels {
+		if model.monitorType == monitorType {
+			return model, true
+		}
+	}
+	return monitorModel{}, false
+}
+
+// resultTableOf returns the table holding the results of monitor id.
+func (db *GormDb) resultTableOf(ctx context.Context, id uint) (string, error) {
+	mon, err := db.GetMonitor(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	model, ok := modelByType(mon.GetType())
+	if !ok {
+		return "", fmt.Errorf("unknown monitor type %s", mon.GetType())
+	}
+	return model.resultTable, nil
+}
+
+// findMonitors loads the monitors of type T matching tx and wires them to the
+// given clock.
+func findMonitors[T any, PT interface {
+	*T
+	monitor.Monitorer
+}](tx *gorm.DB, now func() time.Time) ([]monitor.Monitorer, error) {
+	var monitors []T
+	if err := tx.Find(&monitors).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]monitor.Monitorer, 0, len(monitors))
+	for i := range monitors {
+		mon := PT(&monitors[i])
+		mon.GetBase().Clock = now
+		results = append(results, mon)
+	}
+	return results, nil
+}
+
+// shareMonitorIDs makes every monitor table draw its IDs from one sequence,
+// so a monitor ID identifies a monitor regardless of its type.
+func shareMonitorIDs(tx *gorm.DB) error {
+	if err := tx.Exec("CREATE SEQUENCE IF NOT EXISTS monitor_id_seq").Error; err != nil {
+		return err
+	}
+
+	for _, model := range monitorModels {
+		err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN id SET DEFAULT nextval('monitor_id_seq')", model.table)).Error
+		if err != nil {
+			return err
+		}
+
+		// Move the sequence past IDs handed out before it was shared
+		err = tx.Exec(fmt.Sprintf(
+			"SELECT setval('monitor_id_seq', GREATEST((SELECT last_value FROM monitor_id_seq), (SELECT COALESCE(MAX(id), 1) FROM %s)))",
+			model.table,
+		)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"shraga/internal/monitor"
+	"time"
+)
+
+// Overview summarizes the health of every enabled monitor.
+type Overview struct {
+	Counts        map[monitor.Result]int // Enabled monitors by their latest result
+	Worst         []MonitorDowntime      // Most downtime since the overview window start
+	OpenIncidents []monitor.Incident
+}
+
+// MonitorDowntime is the time a monitor spent down within a window.
+type MonitorDowntime struct {
+	MonitorID uint
+	Downtime  time.Duration
+}
+
+// GetOverview returns the fleet health overview, with up to limit monitors
+// ranked by their downtime since the given time.
+func (db *GormDb) GetOverview(ctx context.Context, since time.Time, limit int) (Overview, error) {
+	overview := Overview{Counts: make(map[monitor.Result]int)}
+
+	for _, model := range monitorModels {
+		var rows []struct {
+			LastResult monitor.Result
+			Count      int
+		}
+		err := db.WithContext(ctx).
+			Table(model.table).
+			Select("last_result, COUNT(*) AS count").
+			Where("enabled = true").
+			Group("last_result").
+			Find(&rows).Error
+		if err != nil {
+			return Overview{}, err
+		}
+
+		for _, row := range rows {
+			overview.Counts[row.LastResult] += row.Count
+		}
+	}
+
+	now := db.now()
+	var worst []struct {
+		MonitorID uint
+		Seconds   float64
+	}
+	err := db.WithContext(ctx).
+		Model(&monitor.Incident{}).
+		Select("monitor_id, SUM(EXTRACT(EPOCH FROM (LEAST(COALESCE(ended_at, @now), @now) - GREATEST(started_at, @since)))) AS seconds",
+			map[string]any{"now": now, "since": since}).
+		Where("COALESCE(ended_at, ?) > ? AND started_at < ?", now, since, now).
+		Group("monitor_id").
+		Order("seconds DESC").
+		Limit(limit).
+		Find(&worst).Error
+	if err != nil {
+		return Overview{}, err
+	}
+
+	for _, row := range worst {
+		overview.Worst = append(overview.Worst, MonitorDowntime{
+			MonitorID: row.MonitorID,
+			Downtime:  time.Duration(row.Seconds * float64(time.Second)),
+		})
+	}
+
+	overview.OpenIncidents, err = db.GetOpenIncidents(ctx)
+	if err != nil {
+		return Overview{}, err
+	}
+	return overview, nil
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"shraga/internal/monitor"
+	"time"
+)
+
+// GetReasonBreakdown counts the results of monitorID between from and to that
+// weren't up, by reason. Only raw results carry a reason, so minutes whose
+// results were rolled up and purged aren't counted.
+func (db *GormDb) GetReasonBreakdown(ctx context.Context, monitorID uint, from, to time.Time) (map[monitor.Reason]int, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: end %s is not after start %s", ErrInvalidRange, to, from)
+	}
+
+	resultTable, err := db.resultTableOf(ctx, monitorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Reason monitor.Reason
+		Count  int
+	}
+	err = db.WithContext(ctx).
+		Table(resultTable).
+		Select("reason, COUNT(*) AS count").
+		Where("monitor_id = ? AND response_time >= ? AND response_time < ? AND result <> ?", monitorID, from, to, monitor.ResultUp).
+		Group("reason").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown := make(map[monitor.Reason]int, len(rows))
+	for _, row := range rows {
+		breakdown[row.Reason] = row.Count
+	}
+	return breakdown, nil
+}
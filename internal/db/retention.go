@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PurgeResults deletes the results and rollups of each monitor that are
+// older than its ResultRetention, or defaultRetention when it has none.
+// Nothing is deleted for monitors whose effective retention is zero. With an
+// Archiver, results are archived before they are deleted.
+func (db *GormDb) PurgeResults(ctx context.Context, defaultRetention time.Duration) error {
+	now := db.now()
+	for _, model := range monitorModels {
+		var monitors []struct {
+			ID              uint
+			ResultRetention int64
+		}
+		err := db.WithContext(ctx).
+			Table(model.table).
+			Select("id", "result_retention").
+			Find(&monitors).Error
+		if err != nil {
+			return err
+		}
+
+		for _, mon := range monitors {
+			retention := time.Duration(mon.ResultRetention)
+			if retention == 0 {
+				retention = defaultRetention
+			}
+			if retention <= 0 {
+				continue
+			}
+
+			cutoff := now.Add(-retention)
+			if db.archiver != nil {
+				if err := db.archiveResults(ctx, model.resultTable, mon.ID, cutoff); err != nil {
+					return fmt.Errorf("monitor %d: %w", mon.ID, err)
+				}
+			}
+			err := db.WithContext(ctx).
+				Exec(fmt.Sprintf("DELETE FROM %s WHERE monitor_id = ? AND response_time < ?", model.resultTable), mon.ID, cutoff).
+				Error
+			if err != nil {
+				return fmt.Errorf("monitor %d: %w", mon.ID, err)
+			}
+
+			err = db.WithContext(ctx).
+				Exec("DELETE FROM result_rollups WHERE monitor_id = ? AND bucket < ?", mon.ID, cutoff).
+				Error
+			if err != nil {
+				return fmt.Errorf("monitor %d: %w", mon.ID, err)
+			}
+		}
+	}
+	return nil
+}
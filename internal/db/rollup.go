@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"shraga/internal/monitor"
+	"time"
+)
+
+// RollupResults aggregates the complete minutes of raw results of every
+// monitor with AggregateResults set, or unset while aggregateByDefault, then
+// purges its raw results older than its RawRetention, or
+// defaultRawRetention when it has none. Only whole minutes are purged, and
+// only after they were rolled up, so recomputing the minutes still held in
+// raw form on each run is safe.
+func (db *GormDb) RollupResults(ctx context.Context, aggregateByDefault bool, defaultRawRetention time.Duration) error {
+	now := db.now()
+	for _, model := range monitorModels {
+		var monitors []struct {
+			ID           uint
+			RawRetention int64
+		}
+		err := db.WithContext(ctx).
+			Table(model.table).
+			Select("id", "raw_retention").
+			Where("aggregate_results = true OR (aggregate_results IS NULL AND ?)", aggregateByDefault).
+			Find(&monitors).Error
+		if err != nil {
+			return err
+		}
+
+		for _, mon := range monitors {
+			if err := db.rollup(ctx, model.resultTable, mon.ID, now.Truncate(time.Minute)); err != nil {
+				return fmt.Errorf("monitor %d: %w", mon.ID, err)
+			}
+
+			rawRetention := time.Duration(mon.RawRetention)
+			if rawRetention == 0 {
+				rawRetention = defaultRawRetention
+			}
+			cutoff := now.Add(-rawRetention).Truncate(time.Minute)
+			err := db.WithContext(ctx).
+				Exec(fmt.Sprintf("DELETE FROM %s WHERE monitor_id = ? AND response_time < ?", model.resultTable), mon.ID, cutoff).
+				Error
+			if err != nil {
+				return fmt.Errorf("monitor %d: %w", mon.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// rollup (re)computes the rollups of monitorID for the minutes before the
+// given one that still have raw results.
+func (db *GormDb) rollup(ctx context.Context, resultTable string, monitorID uint, before time.Time) error {
+	query := fmt.Sprintf(`
+INSERT INTO result_rollups (monitor_id, bucket, count, up_count, down_count, warn_count, min_latency, max_latency, sum_latency)
+SELECT monitor_id, date_trunc('minute', response_time), COUNT(*),
+	COUNT(*) FILTER (WHERE result = ?), COUNT(*) FILTER (WHERE result = ?), COUNT(*) FILTER (WHERE result = ?),
+	MIN(latency), MAX(latency), SUM(latency)
+FROM %s
+WHERE monitor_id = ? AND response_time < ?
+GROUP BY 1, 2
+ON CONFLICT (monitor_id, bucket) DO UPDATE SET
+	count = EXCLUDED.count,
+	up_count = EXCLUDED.up_count,
+	down_count = EXCLUDED.down_count,
+	warn_count = EXCLUDED.warn_count,
+	min_latency = EXCLUDED.min_latency,
+	max_latency = EXCLUDED.max_latency,
+	sum_latency = EXCLUDED.sum_latency`, resultTable)
+
+	return db.WithContext(ctx).
+		Exec(query, int(monitor.ResultUp), int(monitor.ResultDown), int(monitor.ResultWarn), monitorID, before).
+		Error
+}
+
+// GetRollups returns the rollups of monitorID with buckets in [from, to),
+// oldest first.
+func (db *GormDb) GetRollups(ctx context.Context, monitorID uint, from, to time.Time) ([]monitor.ResultRollup, error) {
+	var rollups []monitor.ResultRollup
+	err := db.WithContext(ctx).
+		Where("monitor_id = ? AND bucket >= ? AND bucket < ?", monitorID, from, to).
+		Order("bucket").
+		Find(&rollups).Error
+	if err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SetEnabledByTag enables or disables every monitor carrying all the given
+// tags, and returns how many monitors matched.
+func (db *GormDb) SetEnabledByTag(ctx context.Context, tags map[string]string, enabled bool) (int64, error) {
+	if len(tags) == 0 {
+		return 0, errors.New("at least one tag is required")
+	}
+
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for _, model := range monitorModels {
+		result := db.WithContext(ctx).
+			Table(model.table).
+			Where("NULLIF(tags_json, '')::jsonb @> ?::jsonb", string(tagsJSON)).
+			Update("enabled", enabled)
+		if result.Error != nil {
+			return affected, fmt.Errorf("%s: %w", model.table, result.Error)
+		}
+		affected += result.RowsAffected
+	}
+	return affected, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shraga/internal/monitor"
+	"time"
+)
+
+// maxTimeseriesBuckets bounds the buckets of one timeseries query
+const maxTimeseriesBuckets = 10000
+
+// ErrInvalidRange is returned when a timeseries range or step can't be served.
+var ErrInvalidRange = errors.New("invalid range")
+
+// TimeseriesBucket aggregates the results of a monitor within one step.
+// Buckets without results have a zero Count.
+type TimeseriesBucket struct {
+	Start      time.Time
+	Count      int64
+	UpCount    int64
+	DownCount  int64
+	WarnCount  int64
+	AvgLatency float64 // Milliseconds
+	MaxLatency int64   // Milliseconds
+}
+
+// GetTimeseries returns the results of monitorID between from and to bucketed
+// by step, which must be whole seconds. Buckets are aligned to the Unix epoch
+// and every bucket in the range is returned, including empty ones. Minutes
+// whose raw results were purged after being rolled up are read from their
+// rollups.
+func (db *GormDb) GetTimeseries(ctx context.Context, monitorID uint, from, to time.Time, step time.Duration) ([]TimeseriesBucket, error) {
+	if step < time.Second || step%time.Second != 0 {
+		return nil, fmt.Errorf("%w: step must be a positive number of seconds, got %s", ErrInvalidRange, step)
+	}
+	stepSeconds := int64(step / time.Second)
+	from = time.Unix(from.Unix()/stepSeconds*stepSeconds, 0).UTC()
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: end %s is not after start %s", ErrInvalidRange, to, from)
+	}
+	if to.Sub(from)/step > maxTimeseriesBuckets {
+		return nil, fmt.Errorf("%w: more than %d buckets of %s", ErrInvalidRange, maxTimeseriesBuckets, step)
+	}
+
+	resultTable, err := db.resultTableOf(ctx, monitorID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+WITH buckets AS (
+	SELECT generate_series(@from::timestamptz, @to::timestamptz - interval '1 microsecond', @step * interval '1 second') AS start
+), raw AS (
+	SELECT response_time, result, latency FROM %s
+	WHERE monitor_id = @id AND response_time >= @from AND response_time < @to
+), results AS (
+	SELECT response_time AS time, 1 AS count,
+		(result = @up)::int AS up_count, (result = @down)::int AS down_count, (result = @warn)::int AS warn_count,
+		latency AS sum_latency, latency AS max_latency
+	FROM raw
+	UNION ALL
+	SELECT bucket, count, up_count, down_count, warn_count, sum_latency, max_latency FROM result_rollups
+	WHERE monitor_id = @id AND bucket >= @from AND bucket < @to
+		AND bucket < COALESCE((SELECT MIN(response_time) FROM %s WHERE monitor_id = @id), 'infinity')
+)
+SELECT b.start,
+	COALESCE(SUM(r.count), 0) AS count,
+	COALESCE(SUM(r.up_count), 0) AS up_count,
+	COALESCE(SUM(r.down_count), 0) AS down_count,
+	COALESCE(SUM(r.warn_count), 0) AS warn_count,
+	COALESCE(SUM(r.sum_latency)::float / NULLIF(SUM(r.count), 0), 0) AS avg_latency,
+	COALESCE(MAX(r.max_latency), 0) AS max_latency
+FROM buckets b
+LEFT JOIN results r ON to_timestamp(floor(extract(epoch FROM r.time) / @step) * @step) = b.start
+GROUP BY b.start
+ORDER BY b.start`, resultTable, resultTable)
+
+	var buckets []TimeseriesBucket
+	err = db.WithContext(ctx).Raw(query, map[string]any{
+		"id":   monitorID,
+		"from": from,
+		"to":   to,
+		"step": stepSeconds,
+		"up":   int(monitor.ResultUp),
+		"down": int(monitor.ResultDown),
+		"warn": int(monitor.ResultWarn),
+	}).Scan(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
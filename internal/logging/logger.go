@@ -11,13 +11,17 @@ import (
 var (
 	Logger *zap.Logger
 	once sync.Once
+	// level can be changed at runtime via SetLevel
+	level = zap.NewAtomicLevel()
 )
 
 func init() {
 	Logger = zap.L()
 }
 
-func Initialize(isProduction bool) {
+// Initialize sets up Logger with the production or development preset. format
+// overrides the preset's encoding with "json" or "console" when set.
+func Initialize(isProduction bool, format string) {
 	once.Do(func() {
 		var cfg zap.Config
 		if isProduction {
@@ -32,6 +36,27 @@ func Initialize(isProduction bool) {
 			cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 		}
 
+		if format != "" {
+			cfg.Encoding = format
+		}
+
+		level.SetLevel(cfg.Level.Level())
+		cfg.Level = level
 		Logger = lo.Must(cfg.Build())
 	})
 }
+
+// SetLevel changes the minimum level logged, e.g. "debug" or "warn".
+func SetLevel(text string) error {
+	parsed, err := zapcore.ParseLevel(text)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(parsed)
+	return nil
+}
+
+// Level returns the current minimum level logged.
+func Level() zapcore.Level {
+	return level.Level()
+}
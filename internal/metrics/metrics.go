@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Registry holds every metric exported by shraga.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// SchedulerLag measures how late each check is dispatched relative to its
+	// due time (LastMonitorTime + Interval). Sustained positive lag means the
+	// worker pool is undersized.
+	SchedulerLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "shraga_scheduler_lag_seconds",
+		Help:    "Delay between a monitor becoming due and a worker taking its check.",
+		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300},
+	})
+
+	// CheckDuration measures how long each check takes, by monitor type.
+	CheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shraga_check_duration_seconds",
+		Help:    "Duration of monitor checks.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"type"})
+
+	// HttpResponses counts the status codes received by HTTP monitors.
+	HttpResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shraga_http_responses_total",
+		Help: "HTTP responses received by monitors, by status code.",
+	}, []string{"monitor_id", "status_code"})
+
+	// SchedulerStalled is 1 while the watchdog sees no scheduler ticks.
+	SchedulerStalled = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "shraga_scheduler_stalled",
+		Help: "Whether the scheduler has stopped ticking (1) or not (0).",
+	})
+
+	// ConsecutiveFailures counts the checks in a row each monitor was down.
+	ConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "shraga_consecutive_failures",
+		Help: "Checks in a row a monitor was down, reset by any other result.",
+	}, []string{"monitor_id"})
+
+	// BufferedResults counts the results waiting for the database to recover.
+	BufferedResults = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "shraga_buffered_results",
+		Help: "Results of checks buffered in memory until they can be saved.",
+	})
+
+	// StuckChecks counts the checks abandoned by the watchdog, by monitor type.
+	StuckChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shraga_stuck_checks_total",
+		Help: "Checks abandoned for running past the check timeout.",
+	}, []string{"type"})
+
+	// DroppedNotifications counts the events dropped because the delivery
+	// queue of their notifier was full, by notifier.
+	DroppedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shraga_dropped_notifications_total",
+		Help: "Notifications dropped while their notifier's queue was full.",
+	}, []string{"notifier"})
+
+	// DroppedSinkResults counts the results dropped because the queue of
+	// their result sink was full.
+	DroppedSinkResults = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "shraga_dropped_sink_results_total",
+		Help: "Results dropped while their result sink's queue was full.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SchedulerLag,
+		CheckDuration,
+		HttpResponses,
+		SchedulerStalled,
+		ConsecutiveFailures,
+		BufferedResults,
+		StuckChecks,
+		DroppedNotifications,
+		DroppedSinkResults,
+	)
+}
+
+// ObserveCheckDuration records the duration of a check. When ctx carries a
+// sampled trace span, its IDs are attached as an exemplar so a latency spike
+// links to the trace of the slow check.
+func ObserveCheckDuration(ctx context.Context, monitorType string, d time.Duration) {
+	observer := CheckDuration.WithLabelValues(monitorType)
+
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && spanCtx.IsSampled() {
+		exemplarObserver.ObserveWithExemplar(d.Seconds(), prometheus.Labels{
+			"trace_id": spanCtx.TraceID().String(),
+			"span_id":  spanCtx.SpanID().String(),
+		})
+		return
+	}
+	observer.Observe(d.Seconds())
+}
+
+// SetConsecutiveFailures records how many checks in a row monitorID was down.
+func SetConsecutiveFailures(monitorID uint, failures int) {
+	ConsecutiveFailures.WithLabelValues(strconv.FormatUint(uint64(monitorID), 10)).Set(float64(failures))
+}
+
+// Handler returns an http.Handler serving the registered metrics. With
+// openMetrics, scrapers accepting OpenMetrics get it, including the units of
+// the metrics; the others get the Prometheus text format. Exemplars are only
+// exposed in the OpenMetrics format.
+func Handler(openMetrics bool) http.Handler {
+	text := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if !openMetrics {
+		return text
+	}
+	return &openMetricsHandler{gatherer: Registry, fallback: text}
+}
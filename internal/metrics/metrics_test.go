@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestObserveCheckDuration_Exemplar(t *testing.T) {
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+
+	ObserveCheckDuration(ctx, "exemplar-test", 300*time.Millisecond)
+
+	var metric dto.Metric
+	require.NoError(t, CheckDuration.WithLabelValues("exemplar-test").(prometheus.Metric).Write(&metric))
+	var labels map[string]string
+	for _, bucket := range metric.Histogram.Bucket {
+		if bucket.Exemplar != nil {
+			labels = map[string]string{}
+			for _, label := range bucket.Exemplar.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			break
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"trace_id": spanCtx.TraceID().String(),
+		"span_id":  spanCtx.SpanID().String(),
+	}, labels)
+}
+
+func TestObserveCheckDuration_NoSpan(t *testing.T) {
+	ObserveCheckDuration(context.Background(), "no-span-test", 300*time.Millisecond)
+
+	var metric dto.Metric
+	require.NoError(t, CheckDuration.WithLabelValues("no-span-test").(prometheus.Metric).Write(&metric))
+	assert.Equal(t, uint64(1), metric.Histogram.GetSampleCount())
+	for _, bucket := range metric.Histogram.Bucket {
+		assert.Nil(t, bucket.Exemplar)
+	}
+}
+
+func TestHandler_OpenMetrics(t *testing.T) {
+	SchedulerLag.Observe(1)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	rec := httptest.NewRecorder()
+	Handler(true).ServeHTTP(rec, req)
+
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/openmetrics-text")
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE shraga_scheduler_lag_seconds histogram\n")
+	assert.Contains(t, body, "# UNIT shraga_scheduler_lag_seconds seconds\n")
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+}
+
+func TestHandler_PrometheusText(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	rec := httptest.NewRecorder()
+	Handler(false).ServeHTTP(rec, req)
+
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.NotContains(t, rec.Body.String(), "# EOF")
+
+	// Scrapers not asking for OpenMetrics get the Prometheus text format
+	req.Header.Del("Accept")
+	rec = httptest.NewRecorder()
+	Handler(true).ServeHTTP(rec, req)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// units are the base units announced by the OpenMetrics `# UNIT` line, for
+// metrics whose name ends with them.
+var units = []string{"seconds", "bytes", "ratio"}
+
+// openMetricsHandler serves the gathered metrics in the OpenMetrics format to
+// scrapers accepting it, and leaves the others to fallback.
+type openMetricsHandler struct {
+	gatherer prometheus.Gatherer
+	fallback http.Handler
+}
+
+func (h *openMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	if format.FormatType() != expfmt.TypeOpenMetrics {
+		h.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	families, err := h.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		http.Error(w, "failed to gather metrics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(format))
+	for _, family := range families {
+		setUnit(family)
+		if _, err := expfmt.MetricFamilyToOpenMetrics(w, family, expfmt.WithUnit()); err != nil {
+			return
+		}
+	}
+	_, _ = expfmt.FinalizeOpenMetrics(w)
+}
+
+// setUnit sets the unit of family from the suffix of its name, ignoring the
+// suffix of counters.
+func setUnit(family *dto.MetricFamily) {
+	name := strings.TrimSuffix(family.GetName(), "_total")
+	for _, unit := range units {
+		if strings.HasSuffix(name, "_"+unit) {
+			family.Unit = &unit
+			return
+		}
+	}
+}
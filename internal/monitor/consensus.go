@@ -0,0 +1,34 @@
+package monitor
+
+// Consensus combines the latest results of the same logical monitor checked
+// from several agents, keyed by agent, into one state:
+//   - every agent up: up
+//   - a strict majority up: warn, with ReasonPartialOutage
+//   - otherwise: down, with ReasonPartialOutage unless every agent is down
+//
+// Warn counts as up, since the target answered. Unknown results are ignored,
+// and only unknown results give ResultUnknown.
+func Consensus(results map[string]Result) (Result, Reason) {
+	var up, down int
+	for _, result := range results {
+		switch result {
+		case ResultUp, ResultWarn:
+			up++
+		case ResultDown:
+			down++
+		}
+	}
+
+	switch {
+	case up+down == 0:
+		return ResultUnknown, ReasonNone
+	case down == 0:
+		return ResultUp, ReasonNone
+	case up > down:
+		return ResultWarn, ReasonPartialOutage
+	case up == 0:
+		return ResultDown, ReasonNone
+	default:
+		return ResultDown, ReasonPartialOutage
+	}
+}
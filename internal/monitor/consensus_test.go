@@ -0,0 +1,31 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsensus(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]Result
+		result  Result
+		reason  Reason
+	}{
+		{"no results", nil, ResultUnknown, ReasonNone},
+		{"all up", map[string]Result{"eu": ResultUp, "us": ResultUp, "ap": ResultWarn}, ResultUp, ReasonNone},
+		{"single region down", map[string]Result{"eu": ResultUp, "us": ResultUp, "ap": ResultDown}, ResultWarn, ReasonPartialOutage},
+		{"split", map[string]Result{"eu": ResultUp, "us": ResultDown}, ResultDown, ReasonPartialOutage},
+		{"all down", map[string]Result{"eu": ResultDown, "us": ResultDown}, ResultDown, ReasonNone},
+		{"unknown ignored", map[string]Result{"eu": ResultUp, "us": ResultUnknown}, ResultUp, ReasonNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, reason := Consensus(tt.results)
+			assert.Equal(t, tt.result, result)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"shraga/internal/logging"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bounds the lookup refreshing an expired entry, so a slow DNS server falls
+// back to the cached addresses quickly
+const staleDNSLookupTimeout = 2 * time.Second
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsCache caches host lookups of HTTP monitors for ttl. Entries that expired
+// are kept, and used when refreshing them fails.
+type dnsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]dnsEntry
+	lookup  func(ctx context.Context, host string) ([]string, error)
+	now     func() time.Time
+}
+
+var sharedDNSCache = newDNSCache()
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{
+		entries: make(map[string]dnsEntry),
+		lookup:  net.DefaultResolver.LookupHost,
+		now:     time.Now,
+	}
+}
+
+// SetDNSCacheTTL enables caching of the hosts HTTP monitors resolve for ttl.
+// Zero, the default, disables caching.
+func SetDNSCacheTTL(ttl time.Duration) {
+	sharedDNSCache.mu.Lock()
+	defer sharedDNSCache.mu.Unlock()
+
+	sharedDNSCache.ttl = ttl
+	clear(sharedDNSCache.entries)
+}
+
+// resolve returns the addresses of host and whether they are stale, i.e.
+// came from the cache because looking them up failed.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, bool, error) {
+	c.mu.Lock()
+	entry, cached := c.entries[host]
+	now := c.now()
+	c.mu.Unlock()
+
+	if cached && now.Before(entry.expires) {
+		return entry.addrs, false, nil
+	}
+
+	lookupCtx := ctx
+	if cached {
+		var cancel context.CancelFunc
+		lookupCtx, cancel = context.WithTimeout(ctx, staleDNSLookupTimeout)
+		defer cancel()
+	}
+
+	addrs, err := c.lookup(lookupCtx, host)
+	if err != nil {
+		if cached {
+			logging.Logger.Sugar().Warnf("DNS lookup of %s failed, using cached addresses: %v", host, err)
+			return entry.addrs, true, nil
+		}
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	if c.ttl > 0 {
+		c.entries[host] = dnsEntry{addrs: addrs, expires: c.now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return addrs, false, nil
+}
+
+func (c *dnsCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl > 0
+}
+
+// staleDNSKey marks a request context whose dial fell back to stale cached
+// addresses.
+type staleDNSKey struct{}
+
+// dialContext wraps dial to resolve hosts through the cache when it is
+// enabled.
+func (c *dnsCache) dialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || !c.enabled() || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		addrs, stale, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if stale {
+			if flag, ok := ctx.Value(staleDNSKey{}).(*atomic.Bool); ok {
+				flag.Store(true)
+			}
+		}
+
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		if err == nil {
+			err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDnsCache_resolve(t *testing.T) {
+	now := time.Now()
+	lookups := 0
+	var lookupErr error
+	cache := newDNSCache()
+	cache.ttl = time.Minute
+	cache.now = func() time.Time { return now }
+	cache.lookup = func(_ context.Context, host string) ([]string, error) {
+		lookups++
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+
+	addrs, stale, err := cache.resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+	assert.False(t, stale)
+
+	// Served from the cache until the entry expires
+	_, _, err = cache.resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 1, lookups)
+
+	// Expired entries are used when the lookup fails
+	now = now.Add(2 * time.Minute)
+	lookupErr = &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}
+	addrs, stale, err = cache.resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+	assert.True(t, stale)
+	assert.Equal(t, 2, lookups)
+
+	_, _, err = cache.resolve(context.Background(), "other.example.com")
+	assert.ErrorIs(t, err, lookupErr)
+}
+
+func TestDnsCache_dialContext(t *testing.T) {
+	cache := newDNSCache()
+	cache.lookup = func(context.Context, string) ([]string, error) {
+		return []string{"10.0.0.1", "127.0.0.1"}, nil
+	}
+
+	var dialed []string
+	dial := cache.dialContext(func(_ context.Context, _, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return nil, &net.OpError{Op: "dial", Err: assert.AnError}
+	})
+
+	// Disabled, the address is dialed as is
+	dial(context.Background(), "tcp", "example.com:80")
+	assert.Equal(t, []string{"example.com:80"}, dialed)
+
+	cache.ttl = time.Minute
+	dialed = nil
+	_, err := dial(context.Background(), "tcp", "example.com:80")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"10.0.0.1:80", "127.0.0.1:80"}, dialed)
+}
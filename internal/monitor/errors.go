@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// classifyError maps a connection or request error to the Reason describing
+// its cause, or ReasonNone when it isn't recognized.
+func classifyError(err error) Reason {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ReasonDNS
+	}
+
+	if isTLSError(err) {
+		return ReasonTLS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ReasonConnRefused
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ReasonTimeout
+	}
+
+	return ReasonNone
+}
+
+func isTLSError(err error) bool {
+	var (
+		verificationErr *tls.CertificateVerificationError
+		recordErr       tls.RecordHeaderError
+		alertErr        tls.AlertError
+		unknownAuthErr  x509.UnknownAuthorityError
+		invalidErr      x509.CertificateInvalidError
+		hostnameErr     x509.HostnameError
+	)
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr)
+}
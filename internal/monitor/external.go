@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxExternalClockSkew is how far in the future an external result may be
+// timestamped, for probes whose clock runs ahead.
+const maxExternalClockSkew = time.Minute
+
+// ExternalResult is the result of a check run by an external probe, e.g. a
+// synthetic check at a CDN edge, reported to the API.
+type ExternalResult struct {
+	Result    Result    `json:"result"`
+	LatencyMs int64     `json:"latencyMs"`
+	Timestamp time.Time `json:"timestamp"` // Defaults to the time it is received
+	Error     string    `json:"error"`
+}
+
+// Validate rejects results that are unknown, have a negative latency or are
+// timestamped in the future.
+func (er *ExternalResult) Validate(now time.Time) error {
+	if er.Result == ResultUnknown {
+		return errors.New("result must be up, warn or down")
+	}
+	if er.LatencyMs < 0 {
+		return errors.New("latency must not be negative")
+	}
+	if er.Timestamp.After(now.Add(maxExternalClockSkew)) {
+		return fmt.Errorf("timestamp %s is in the future", er.Timestamp.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Response returns the result as a response of monitor mon, to be stored
+// alongside the results of its own checks.
+func (er *ExternalResult) Response(mon Monitorer) (MonitorResponser, error) {
+	base := BaseMonitorResponse{
+		MonitorID:    mon.GetBase().ID,
+		ResponseTime: er.Timestamp,
+		Result:       er.Result,
+		ErrorMsg:     er.Error,
+	}
+	if base.ResponseTime.IsZero() {
+		base.ResponseTime = mon.GetBase().Now()
+	}
+	return newResponse(mon, base, er.LatencyMs)
+}
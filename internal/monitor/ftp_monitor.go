@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"shraga/internal/logging"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultFileTransferTimeout = 30 * time.Second
+	maxFileTransferTimeout     = 5 * time.Minute
+	minFileTransferTimeout     = 1 * time.Second
+)
+
+// FileTransferConfig holds the connection and check settings shared by the
+// FTP and SFTP monitors.
+type FileTransferConfig struct {
+	Address    string // host[:port]
+	Username   string
+	Password   Secret
+	FilePath   string        // When set, the file must exist
+	ListDir    string        // When set, the directory must be listable
+	TimeoutInt int64         `gorm:"column:timeout"`
+	Timeout    time.Duration `gorm:"-"`
+}
+
+func (c *FileTransferConfig) GetAddress() string {
+	return c.Address
+}
+
+func (c *FileTransferConfig) GetTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultFileTransferTimeout
+	}
+	return c.Timeout
+}
+
+func (c *FileTransferConfig) beforeSave() error {
+	if c.Timeout == 0 {
+		c.Timeout = defaultFileTransferTimeout
+	} else if c.Timeout > maxFileTransferTimeout {
+		c.Timeout = maxFileTransferTimeout
+	} else if c.Timeout < minFileTransferTimeout {
+		c.Timeout = minFileTransferTimeout
+	}
+	c.TimeoutInt = int64(c.Timeout)
+	return validateTarget(hostOf(c.Address))
+}
+
+func (c *FileTransferConfig) afterFind() {
+	c.Timeout = time.Duration(c.TimeoutInt)
+	if c.Timeout == 0 {
+		c.Timeout = defaultFileTransferTimeout
+	}
+}
+
+// hostPort returns the address with defaultPort added when it has none.
+func (c *FileTransferConfig) hostPort(defaultPort string) string {
+	if _, _, err := net.SplitHostPort(c.Address); err == nil {
+		return c.Address
+	}
+	return net.JoinHostPort(c.Address, defaultPort)
+}
+
+type FileTransferResponse struct {
+	BaseMonitorResponse
+	Latency int64
+}
+
+func (fr *FileTransferResponse) GetBaseMonitorResponse() *BaseMonitorResponse {
+	return &fr.BaseMonitorResponse
+}
+
+func (fr *FileTransferResponse) GetLatency() time.Duration {
+	return time.Duration(fr.Latency) * time.Millisecond
+}
+
+type FtpMonitor struct {
+	BaseMonitor
+	FileTransferConfig
+	UseExplicitTLS bool // Upgrade the control connection with AUTH TLS
+}
+
+func (fm *FtpMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	fm.Type = TypeFTP
+	err = fm.BaseMonitor.BeforeSave(tx)
+	if err != nil {
+		return
+	}
+	return fm.FileTransferConfig.beforeSave()
+}
+
+func (fm *FtpMonitor) AfterFind(tx *gorm.DB) (err error) {
+	err = fm.BaseMonitor.AfterFind(tx)
+	if err != nil {
+		return
+	}
+	fm.FileTransferConfig.afterFind()
+	return nil
+}
+
+func (fm *FtpMonitor) Monitor(ctx context.Context) MonitorResponser {
+	logging.Logger.Sugar().Infof("Start monitoring: %d", fm.ID)
+
+	monitorResult := &FileTransferResponse{
+		BaseMonitorResponse: BaseMonitorResponse{
+			MonitorID:    fm.ID,
+			Result:       ResultDown,
+			ResponseTime: fm.Now(),
+		},
+	}
+
+	opts := []ftp.DialOption{
+		ftp.DialWithDialer(*newDialer()),
+		ftp.DialWithContext(ctx),
+		ftp.DialWithTimeout(fm.Timeout),
+	}
+	if fm.UseExplicitTLS {
+		host, _, _ := net.SplitHostPort(fm.hostPort("21"))
+		opts = append(opts, ftp.DialWithExplicitTLS(&tls.Config{ServerName: host}))
+	}
+
+	startTime := time.Now()
+	conn, err := ftp.Dial(fm.hostPort("21"), opts...)
+	if err != nil {
+		monitorResult.Reason = classifyError(err)
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	defer func() {
+		if quitErr := conn.Quit(); quitErr != nil {
+			logging.Logger.Sugar().Warn("Error closing FTP connection", quitErr)
+		}
+	}()
+
+	user, password := fm.Username, string(fm.Password)
+	if user == "" {
+		user, password = "anonymous", "anonymous"
+	}
+	if err := conn.Login(user, password); err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+
+	if fm.ListDir != "" {
+		if _, err := conn.List(fm.ListDir); err != nil {
+			monitorResult.ErrorMsg = err.Error()
+			return monitorResult
+		}
+	}
+
+	if fm.FilePath != "" {
+		if _, err := conn.FileSize(fm.FilePath); err != nil {
+			monitorResult.ErrorMsg = err.Error()
+			return monitorResult
+		}
+	}
+
+	monitorResult.Latency = time.Since(startTime).Milliseconds()
+	monitorResult.Result = ResultUp
+	return monitorResult
+}
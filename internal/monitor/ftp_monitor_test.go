@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// closedAddress returns a local address nothing is listening on.
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+func TestFtpMonitor_BeforeSave(t *testing.T) {
+	fm := &FtpMonitor{
+		FileTransferConfig: FileTransferConfig{Address: "ftp.example.com"},
+	}
+
+	err := fm.BeforeSave(&gorm.DB{})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeFTP, fm.Type)
+	assert.Equal(t, int64(defaultFileTransferTimeout), fm.TimeoutInt)
+}
+
+func TestFtpMonitor_Monitor_ConnectionRefused(t *testing.T) {
+	fm := &FtpMonitor{
+		FileTransferConfig: FileTransferConfig{
+			Address: closedAddress(t),
+			Timeout: 2 * time.Second,
+		},
+	}
+
+	response := fm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.NotEmpty(t, response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestSftpMonitor_BeforeSave_InvalidKey(t *testing.T) {
+	sm := &SftpMonitor{
+		FileTransferConfig: FileTransferConfig{Address: "sftp.example.com"},
+		PrivateKey:         "not a key",
+	}
+
+	err := sm.BeforeSave(&gorm.DB{})
+	assert.Error(t, err)
+}
+
+func TestSftpMonitor_Monitor_ConnectionRefused(t *testing.T) {
+	sm := &SftpMonitor{
+		FileTransferConfig: FileTransferConfig{
+			Address:  closedAddress(t),
+			Username: "user",
+			Password: "password",
+			Timeout:  2 * time.Second,
+		},
+	}
+
+	response := sm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Contains(t, response.GetBaseMonitorResponse().ErrorMsg, "connection refused")
+}
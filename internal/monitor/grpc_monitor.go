@@ -0,0 +1,308 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"shraga/internal/logging"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultGrpcTimeout = 30 * time.Second
+	maxGrpcTimeout     = 5 * time.Minute
+	minGrpcTimeout     = 1 * time.Second
+)
+
+type GrpcResponse struct {
+	BaseMonitorResponse
+	Latency    int64
+	StatusCode string // gRPC status code name, e.g. "OK" or "Unavailable"
+}
+
+func (gr *GrpcResponse) GetBaseMonitorResponse() *BaseMonitorResponse {
+	return &gr.BaseMonitorResponse
+}
+
+func (gr *GrpcResponse) GetLatency() time.Duration {
+	return time.Duration(gr.Latency) * time.Millisecond
+}
+
+// GrpcMonitor invokes a unary gRPC method, resolved through server
+// reflection, and asserts on its JSON encoded response.
+type GrpcMonitor struct {
+	BaseMonitor
+	Address                string // host:port
+	UseTLS                 bool
+	Method                 string              // Fully qualified, e.g. "package.Service/Method"
+	RequestJSON            string              // Request message in protobuf JSON form
+	JsonPathAssertions     []JsonPathAssertion `gorm:"-"`
+	JsonPathAssertionsJSON string              `json:"-"`
+	TimeoutInt             int64               `gorm:"column:timeout"`
+	Timeout                time.Duration       `gorm:"-"`
+}
+
+func (gm *GrpcMonitor) GetAddress() string {
+	return gm.Address
+}
+
+func (gm *GrpcMonitor) GetTimeout() time.Duration {
+	if gm.Timeout <= 0 {
+		return defaultGrpcTimeout
+	}
+	return gm.Timeout
+}
+
+func (gm *GrpcMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	gm.Type = TypeGRPC
+	err = gm.BaseMonitor.BeforeSave(tx)
+	if err != nil {
+		return
+	}
+
+	if _, _, err = gm.splitMethod(); err != nil {
+		return
+	}
+
+	if err = validateTarget(hostOf(gm.Address)); err != nil {
+		return
+	}
+
+	if gm.JsonPathAssertions != nil {
+		for _, assertion := range gm.JsonPathAssertions {
+			if err = assertion.validate(); err != nil {
+				return
+			}
+		}
+
+		gm.JsonPathAssertionsJSON, err = marshalColumn("json_path_assertions_json", gm.JsonPathAssertions)
+		if err != nil {
+			return
+		}
+	}
+
+	if gm.Timeout == 0 {
+		gm.Timeout = defaultGrpcTimeout
+	} else if gm.Timeout > maxGrpcTimeout {
+		gm.Timeout = maxGrpcTimeout
+	} else if gm.Timeout < minGrpcTimeout {
+		gm.Timeout = minGrpcTimeout
+	}
+	gm.TimeoutInt = int64(gm.Timeout)
+	return nil
+}
+
+func (gm *GrpcMonitor) AfterFind(tx *gorm.DB) (err error) {
+	err = gm.BaseMonitor.AfterFind(tx)
+	if err != nil {
+		return
+	}
+
+	if gm.JsonPathAssertionsJSON != "" {
+		if err := unmarshalColumn(gm.ID, "json_path_assertions_json", gm.JsonPathAssertionsJSON, &gm.JsonPathAssertions); err != nil {
+			return err
+		}
+	}
+
+	gm.Timeout = time.Duration(gm.TimeoutInt)
+	if gm.Timeout == 0 {
+		gm.Timeout = defaultGrpcTimeout
+	}
+	return nil
+}
+
+func (gm *GrpcMonitor) Monitor(ctx context.Context) MonitorResponser {
+	logging.Logger.Sugar().Infof("Start monitoring: %d", gm.ID)
+
+	monitorResult := &GrpcResponse{
+		BaseMonitorResponse: BaseMonitorResponse{
+			MonitorID:    gm.ID,
+			Result:       ResultDown,
+			ResponseTime: gm.Now(),
+		},
+	}
+
+	service, method, err := gm.splitMethod()
+	if err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gm.Timeout)
+	defer cancel()
+
+	creds := insecure.NewCredentials()
+	if gm.UseTLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(gm.Address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return newDialer().DialContext(ctx, "tcp", address)
+		}),
+	)
+	if err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	defer conn.Close()
+
+	startTime := time.Now()
+	methodDesc, err := resolveMethod(ctx, conn, service, method)
+	if err != nil {
+		monitorResult.Reason = classifyError(err)
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		monitorResult.ErrorMsg = fmt.Sprintf("method %s is not unary", gm.Method)
+		return monitorResult
+	}
+
+	request := dynamicpb.NewMessage(methodDesc.Input())
+	if gm.RequestJSON != "" {
+		if err := protojson.Unmarshal([]byte(gm.RequestJSON), request); err != nil {
+			monitorResult.ErrorMsg = fmt.Sprintf("invalid request JSON: %v", err)
+			return monitorResult
+		}
+	}
+
+	response := dynamicpb.NewMessage(methodDesc.Output())
+	err = conn.Invoke(ctx, "/"+service+"/"+method, request, response)
+	monitorResult.Latency = time.Since(startTime).Milliseconds()
+
+	code := status.Code(err)
+	monitorResult.StatusCode = code.String()
+	monitorResult.Result = grpcResult(code)
+	if err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		if code == codes.DeadlineExceeded {
+			monitorResult.Reason = ReasonTimeout
+		}
+		return monitorResult
+	}
+
+	body, err := protojson.Marshal(response)
+	if err != nil {
+		monitorResult.Result = ResultDown
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	if err := runJsonPathAssertions(gm.JsonPathAssertions, body); err != nil {
+		monitorResult.Result = ResultDown
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+
+	return monitorResult
+}
+
+// splitMethod splits Method into its fully qualified service and method names.
+func (gm *GrpcMonitor) splitMethod() (string, string, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(gm.Method, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return "", "", fmt.Errorf("invalid method %q, expected \"package.Service/Method\"", gm.Method)
+	}
+	return service, method, nil
+}
+
+// grpcResult maps the status code of a call to a check result. Throttling
+// means the server is alive but struggling, anything else but OK is down.
+func grpcResult(code codes.Code) Result {
+	switch code {
+	case codes.OK:
+		return ResultUp
+	case codes.ResourceExhausted:
+		return ResultWarn
+	default:
+		return ResultDown
+	}
+}
+
+// resolveMethod looks up the descriptor of service's method through the
+// server reflection service.
+func resolveMethod(ctx context.Context, conn *grpc.ClientConn, service, method string) (protoreflect.MethodDescriptor, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	fileSet := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	request := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	// Fetch the service's file and, one request at a time, any dependency
+	// the server didn't send along with it
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			return nil, status.Error(codes.Code(errResp.ErrorCode), errResp.ErrorMessage)
+		}
+
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, file); err != nil {
+				return nil, err
+			}
+			if !seen[file.GetName()] {
+				seen[file.GetName()] = true
+				fileSet.File = append(fileSet.File, file)
+			}
+		}
+
+		request = nil
+		for _, file := range fileSet.File {
+			for _, dep := range file.GetDependency() {
+				if !seen[dep] {
+					request = &reflectionpb.ServerReflectionRequest{
+						MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+					}
+					break
+				}
+			}
+		}
+	}
+
+	files, err := protodesc.NewFiles(fileSet)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", service, err)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, errors.New("method " + method + " not found in service " + service)
+	}
+	return methodDesc, nil
+}
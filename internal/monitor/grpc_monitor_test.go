@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"gorm.io/gorm"
+)
+
+// startGrpcServer serves the health service, with reflection, on a local port.
+func startGrpcServer(t *testing.T) (string, *health.Server) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	return l.Addr().String(), healthServer
+}
+
+func TestGrpcMonitor_BeforeSave(t *testing.T) {
+	gm := &GrpcMonitor{Method: "grpc.health.v1.Health/Check"}
+
+	err := gm.BeforeSave(&gorm.DB{})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeGRPC, gm.Type)
+	assert.Equal(t, int64(defaultGrpcTimeout), gm.TimeoutInt)
+}
+
+func TestGrpcMonitor_BeforeSave_InvalidMethod(t *testing.T) {
+	gm := &GrpcMonitor{Method: "Check"}
+
+	err := gm.BeforeSave(&gorm.DB{})
+	assert.ErrorContains(t, err, "invalid method")
+}
+
+func TestGrpcMonitor_Monitor_Success(t *testing.T) {
+	address, _ := startGrpcServer(t)
+
+	gm := &GrpcMonitor{
+		Address:            address,
+		Method:             "grpc.health.v1.Health/Check",
+		RequestJSON:        `{"service": ""}`,
+		JsonPathAssertions: []JsonPathAssertion{{Path: "$.status", Expected: "SERVING"}},
+		Timeout:            5 * time.Second,
+	}
+
+	response := gm.Monitor(context.Background())
+
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result, response.GetBaseMonitorResponse().ErrorMsg)
+	assert.Equal(t, "OK", response.(*GrpcResponse).StatusCode)
+}
+
+func TestGrpcMonitor_Monitor_AssertionFails(t *testing.T) {
+	address, healthServer := startGrpcServer(t)
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	gm := &GrpcMonitor{
+		Address:            address,
+		Method:             "grpc.health.v1.Health/Check",
+		JsonPathAssertions: []JsonPathAssertion{{Path: "$.status", Expected: "SERVING"}},
+		Timeout:            5 * time.Second,
+	}
+
+	response := gm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, `jsonpath $.status: got "NOT_SERVING", expected "SERVING"`, response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestGrpcMonitor_Monitor_StatusCode(t *testing.T) {
+	address, _ := startGrpcServer(t)
+
+	gm := &GrpcMonitor{
+		Address:     address,
+		Method:      "grpc.health.v1.Health/Check",
+		RequestJSON: `{"service": "unknown"}`,
+		Timeout:     5 * time.Second,
+	}
+
+	response := gm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, "NotFound", response.(*GrpcResponse).StatusCode)
+}
+
+func TestGrpcMonitor_Monitor_UnknownMethod(t *testing.T) {
+	address, _ := startGrpcServer(t)
+
+	gm := &GrpcMonitor{
+		Address: address,
+		Method:  "grpc.health.v1.Health/Missing",
+		Timeout: 5 * time.Second,
+	}
+
+	response := gm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Contains(t, response.GetBaseMonitorResponse().ErrorMsg, "method Missing not found")
+}
@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"mime"
+	"shraga/internal/logging"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// decodeBody converts body to UTF-8 according to the charset of contentType.
+// Bodies without a charset, in UTF-8 or in a charset that can't be decoded
+// are returned as is.
+func decodeBody(body []byte, contentType string) []byte {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return body
+	}
+	charset := strings.ToLower(params["charset"])
+	if charset == "" || charset == "utf-8" || charset == "utf8" {
+		return body
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		logging.Logger.Sugar().Warnf("unknown charset %q, comparing the raw body", charset)
+		return body
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		logging.Logger.Sugar().Warnf("failed to decode body from %s, comparing the raw body: %v", charset, err)
+		return body
+	}
+	return decoded
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+func (hm *HttpMonitor) validatePreflight() error {
+	if hm.PreflightCheck && hm.PreflightOrigin == "" {
+		return errors.New("preflight check requires an origin")
+	}
+	return nil
+}
+
+// checkPreflight sends the CORS preflight a browser would send before the
+// monitored request, and verifies it is allowed.
+func (hm *HttpMonitor) checkPreflight(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, hm.Address, nil)
+	if err != nil {
+		return err
+	}
+	method := hm.RequestMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	req.Header.Set("Origin", hm.PreflightOrigin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if len(hm.ReqHeaders) > 0 {
+		names := lo.Map(lo.Keys(hm.ReqHeaders), func(name string, _ int) string { return strings.ToLower(name) })
+		slices.Sort(names)
+		req.Header.Set("Access-Control-Request-Headers", strings.Join(names, ","))
+	}
+
+	client := &http.Client{Transport: hm.transport()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("preflight failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("preflight responded %d", resp.StatusCode)
+	}
+
+	allowOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	if allowOrigin != "*" && allowOrigin != hm.PreflightOrigin {
+		return fmt.Errorf("preflight doesn't allow origin %s: Access-Control-Allow-Origin is %q", hm.PreflightOrigin, allowOrigin)
+	}
+	if !corsListAllows(resp.Header.Get("Access-Control-Allow-Methods"), method) {
+		return fmt.Errorf("preflight doesn't allow method %s", method)
+	}
+
+	names := lo.Keys(hm.ExpectedCORSHeaders)
+	slices.Sort(names)
+	for _, name := range names {
+		got, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return fmt.Errorf("preflight is missing header %s", name)
+		}
+		if expected := hm.ExpectedCORSHeaders[name]; expected != "" && strings.Join(got, ", ") != expected {
+			return fmt.Errorf("preflight header %s: got %q, expected %q", name, strings.Join(got, ", "), expected)
+		}
+	}
+	return nil
+}
+
+// corsListAllows reports whether the comma separated list of an
+// Access-Control-Allow-* header contains value or the wildcard.
+func corsListAllows(list, value string) bool {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Behaviors of the http:// variant of an address, recorded in
+// HttpResponse.Downgrade
+const (
+	DowngradeRedirect  = "redirect"  // Redirected to https://
+	DowngradeRefused   = "refused"   // Failed without a response
+	DowngradePlaintext = "plaintext" // Served content over plain HTTP
+)
+
+func (hm *HttpMonitor) validateDowngradeCheck() error {
+	if !hm.DowngradeCheck {
+		return nil
+	}
+	parsedURL, err := url.Parse(hm.Address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if parsedURL.Scheme != "https" {
+		return errors.New("downgrade check requires an https address")
+	}
+	if hm.DowngradePort < 0 || hm.DowngradePort > 65535 {
+		return fmt.Errorf("invalid downgrade port %d", hm.DowngradePort)
+	}
+	return nil
+}
+
+// checkDowngrade requests the http:// variant of Address, returning how it
+// behaved and, when it served plaintext content, a description.
+func (hm *HttpMonitor) checkDowngrade(ctx context.Context) (string, string) {
+	plainURL, err := url.Parse(hm.Address)
+	if err != nil {
+		return DowngradeRefused, ""
+	}
+	plainURL.Scheme = "http"
+	// The port of Address serves TLS, plain HTTP is served on another
+	port := hm.DowngradePort
+	if port == 0 {
+		port = 80
+	}
+	plainURL.Host = net.JoinHostPort(plainURL.Hostname(), strconv.Itoa(port))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, plainURL.String(), nil)
+	if err != nil {
+		return DowngradeRefused, ""
+	}
+	// Credentials mustn't go out in plaintext, whatever the server does
+	for key, value := range hm.ReqHeaders {
+		if !IsCredentialHeader(key) {
+			req.Header.Set(key, value)
+		}
+	}
+
+	// Redirects are followed until one leads to https://
+	client := &http.Client{
+		Transport: hm.transport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme == "https" {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > hm.maxRedirects() {
+				return errTooManyRedirects
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return DowngradeRefused, ""
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+
+	if location, err := resp.Location(); err == nil && location.Scheme == "https" {
+		return DowngradeRedirect, ""
+	}
+	return DowngradePlaintext, fmt.Sprintf("%s served plaintext content with status %d", resp.Request.URL, resp.StatusCode)
+}
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// resultExpressionCostLimit bounds the evaluation cost of a ResultExpression,
+// so that an expensive one can't hog a worker.
+const resultExpressionCostLimit = 1_000_000
+
+var (
+	// resultExpressionEnv declares the variables a ResultExpression can use
+	resultExpressionEnv = sync.OnceValues(func() (*cel.Env, error) {
+		return cel.NewEnv(
+			cel.Variable("status", cel.IntType),
+			cel.Variable("latency", cel.DurationType),
+			cel.Variable("body", cel.StringType),
+			cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+			cel.Variable("ssl", cel.MapType(cel.StringType, cel.DynType)),
+		)
+	})
+	// Compiled ResultExpression programs, by expression
+	resultPrograms sync.Map
+)
+
+// Results a ResultExpression may evaluate to besides a bool
+var expressionResults = map[string]Result{
+	"up":   ResultUp,
+	"warn": ResultWarn,
+	"down": ResultDown,
+}
+
+func (hm *HttpMonitor) validateResultExpression() error {
+	if hm.ResultExpression == "" {
+		return nil
+	}
+	_, err := resultProgram(hm.ResultExpression)
+	return err
+}
+
+// resultProgram compiles expr, which must evaluate to a bool or a string.
+func resultProgram(expr string) (cel.Program, error) {
+	if prg, ok := resultPrograms.Load(expr); ok {
+		return prg.(cel.Program), nil
+	}
+
+	env, err := resultExpressionEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expr)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("invalid result expression: %w", issues.Err())
+	}
+	if outputType := ast.OutputType(); !outputType.IsExactType(cel.BoolType) && !outputType.IsExactType(cel.StringType) {
+		return nil, fmt.Errorf("result expression must evaluate to a bool or a string, got %s", outputType)
+	}
+
+	prg, err := env.Program(ast, cel.CostLimit(resultExpressionCostLimit), cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return nil, fmt.Errorf("invalid result expression: %w", err)
+	}
+	resultPrograms.Store(expr, prg)
+	return prg, nil
+}
+
+// evalResultExpression evaluates ResultExpression against the response.
+// true and "up" are up, false and "down" are down, and "warn" is a warning.
+func (hm *HttpMonitor) evalResultExpression(ctx context.Context, resp *http.Response, body string, result *HttpResponse) (Result, error) {
+	prg, err := resultProgram(hm.ResultExpression)
+	if err != nil {
+		return ResultDown, err
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for name, values := range resp.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	out, _, err := prg.ContextEval(ctx, map[string]any{
+		"status":  resp.StatusCode,
+		"latency": time.Duration(result.Latency) * time.Millisecond,
+		"body":    body,
+		"headers": headers,
+		"ssl": map[string]any{
+			"valid":       result.SslResp.Valid,
+			"expiry":      result.SslResp.Expiry,
+			"issuer":      result.SslResp.Issuer,
+			"fingerprint": result.SslResp.Fingerprint,
+		},
+	})
+	if err != nil {
+		return ResultDown, fmt.Errorf("failed to evaluate result expression: %w", err)
+	}
+
+	switch value := out.Value().(type) {
+	case bool:
+		if value {
+			return ResultUp, nil
+		}
+		return ResultDown, nil
+	case string:
+		if r, ok := expressionResults[value]; ok {
+			return r, nil
+		}
+		return ResultDown, fmt.Errorf("result expression evaluated to %q, must be up, warn or down", value)
+	}
+	return ResultDown, fmt.Errorf("result expression evaluated to unexpected %T", out.Value())
+}
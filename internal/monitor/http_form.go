@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// FormFile is a file uploaded with a multipart form request.
+type FormFile struct {
+	Field       string
+	FileName    string
+	ContentType string // Defaults to application/octet-stream
+	Content     string
+}
+
+func (f FormFile) validate() error {
+	if f.Field == "" {
+		return errors.New("form file field name is required")
+	}
+	if f.FileName == "" {
+		return fmt.Errorf("form file %s: file name is required", f.Field)
+	}
+	return nil
+}
+
+// isMultipart reports whether the form must be sent as multipart/form-data.
+func (hm *HttpMonitor) isMultipart() bool {
+	if len(hm.FormFiles) > 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(hm.ReqContentType)
+	return mediaType == "multipart/form-data"
+}
+
+func (hm *HttpMonitor) validateForm() error {
+	if len(hm.FormFields) == 0 && len(hm.FormFiles) == 0 {
+		return nil
+	}
+	if hm.ReqBody != "" {
+		return errors.New("request body and form fields are mutually exclusive")
+	}
+	for _, file := range hm.FormFiles {
+		if err := file.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestBody returns the body to send and its Content-Type, which is empty
+// when the configured one should be used as is.
+func (hm *HttpMonitor) requestBody() (io.Reader, string, error) {
+	if len(hm.FormFields) == 0 && len(hm.FormFiles) == 0 {
+		if len(hm.ReqBody) > 0 {
+			return strings.NewReader(hm.ReqBody), hm.ReqContentType, nil
+		}
+		return nil, "", nil
+	}
+
+	if !hm.isMultipart() {
+		values := url.Values{}
+		for key, value := range hm.FormFields {
+			values.Set(key, value)
+		}
+		return strings.NewReader(values.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	// Write fields in a stable order so requests are reproducible
+	keys := make([]string, 0, len(hm.FormFields))
+	for key := range hm.FormFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writer.WriteField(key, hm.FormFields[key]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, file := range hm.FormFiles {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     file.Field,
+			"filename": file.FileName,
+		}))
+		header.Set("Content-Type", contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := io.WriteString(part, file.Content); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, writer.FormDataContentType(), nil
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Formats HttpMonitor.ExpectedFormat can assert, with the Accept header sent
+// to negotiate them
+var formatMediaTypes = map[string]string{
+	"json": "application/json",
+	"xml":  "application/xml",
+}
+
+func (hm *HttpMonitor) validateExpectedFormat() error {
+	if hm.ExpectedFormat == "" {
+		return nil
+	}
+	if _, ok := formatMediaTypes[hm.ExpectedFormat]; !ok {
+		return fmt.Errorf("unknown expected format %q, must be json or xml", hm.ExpectedFormat)
+	}
+	return nil
+}
+
+// checkFormat reports whether body parses as ExpectedFormat.
+func (hm *HttpMonitor) checkFormat(body []byte) error {
+	switch hm.ExpectedFormat {
+	case "json":
+		if !json.Valid(body) {
+			return errors.New("body is not valid JSON")
+		}
+	case "xml":
+		if err := parseXML(body); err != nil {
+			return fmt.Errorf("body is not valid XML: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseXML reads body to the end, requiring a root element.
+func parseXML(body []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	hasRoot := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			hasRoot = true
+		}
+	}
+	if !hasRoot {
+		return errors.New("no root element")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Ways HttpMonitor.ResponseMatchMode compares the body to ExpectedResponse
+const (
+	MatchExact       = "exact"
+	MatchContains    = "contains"
+	MatchNotContains = "not_contains"
+)
+
+func (hm *HttpMonitor) validateResponseMatchMode() error {
+	switch hm.ResponseMatchMode {
+	case "", MatchExact, MatchContains, MatchNotContains:
+		return nil
+	}
+	return fmt.Errorf("unknown response match mode %q, must be exact, contains or not_contains", hm.ResponseMatchMode)
+}
+
+// checkResponse compares the decoded body to ExpectedResponse as
+// ResponseMatchMode asks, an exact match by default.
+func (hm *HttpMonitor) checkResponse(body string) error {
+	switch hm.ResponseMatchMode {
+	case MatchContains:
+		if !strings.Contains(body, hm.ExpectedResponse) {
+			return fmt.Errorf("response does not contain %q", hm.ExpectedResponse)
+		}
+	case MatchNotContains:
+		if strings.Contains(body, hm.ExpectedResponse) {
+			return fmt.Errorf("response contains %q", hm.ExpectedResponse)
+		}
+	default:
+		if body != hm.ExpectedResponse {
+			return fmt.Errorf("response is not as expected: %s", body)
+		}
+	}
+	return nil
+}
+
+// compileResponseRegex compiles ResponseRegex, when set.
+func (hm *HttpMonitor) compileResponseRegex() (err error) {
+	hm.responseRegex = nil
+	if hm.ResponseRegex == "" {
+		return nil
+	}
+	hm.responseRegex, err = regexp.Compile(hm.ResponseRegex)
+	if err != nil {
+		return fmt.Errorf("invalid response regex: %w", err)
+	}
+	return nil
+}
+
+// checkResponseRegex reports whether the decoded body matches ResponseRegex.
+func (hm *HttpMonitor) checkResponseRegex(body string) error {
+	if hm.responseRegex == nil {
+		// Monitors that weren't saved or loaded aren't compiled yet
+		if err := hm.compileResponseRegex(); err != nil {
+			return err
+		}
+	}
+	if !hm.responseRegex.MatchString(body) {
+		return fmt.Errorf("response does not match %q", hm.ResponseRegex)
+	}
+	return nil
+}
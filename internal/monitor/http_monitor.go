@@ -2,15 +2,25 @@ package monitor
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"regexp"
 	"shraga/internal/logging"
+	"shraga/internal/metrics"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/samber/lo"
@@ -21,6 +31,8 @@ const (
 	defaultHttpClientTimeout = 30 * time.Second
 	maxHttpClientTimeout     = 5 * time.Minute
 	minHttpClientTimeout     = 1 * time.Second
+	// Unread body left beyond this is dropped with its connection
+	maxDrainBytes = 4 << 10
 )
 
 type HttpResponse struct {
@@ -28,13 +40,96 @@ type HttpResponse struct {
 	SslResp         SSLDetails
 	Latency         int64
 	DataValid       bool
+	StatusCode      int
 	StatusCodeValid bool
+	RedirectChain   RedirectChain
+	// Bytes in the body, or its Content-Length when the body wasn't read
+	BodySize int64
+	// SHA-256 of the body, when TrackBodyHash is set
+	BodyHash string
+	// Every check that failed or warned, ErrorMsg describing the first one
+	FailedChecks FailedChecks
+	// SSL expiry threshold, in days, the certificate crossed since the
+	// previous check
+	SSLExpiryThreshold int `gorm:"-"`
+	// How the http:// variant of the address behaved, when DowngradeCheck is set
+	Downgrade string
+	// Protocol the response was served over, e.g. HTTP/2.0
+	Protocol string
+}
+
+// Names of the checks listed in HttpResponse.FailedChecks
+const (
+	CheckStatus      = "status"
+	CheckBody        = "body"
+	CheckTrailers    = "trailers"
+	CheckEmptyBody   = "empty_body"
+	CheckResponse    = "response"
+	CheckRegex       = "regex"
+	CheckJsonPath    = "jsonpath"
+	CheckFormat      = "format"
+	CheckReference   = "reference"
+	CheckPreflight   = "preflight"
+	CheckValidator   = "validator"
+	CheckCertificate = "certificate"
+	CheckBodyHash    = "body_hash"
+	CheckSSLExpiry   = "ssl_expiry"
+	CheckLatency     = "latency"
+	CheckBodySize    = "body_size"
+	CheckExpression  = "expression"
+	CheckDNS         = "dns"
+	CheckDowngrade   = "downgrade"
+	CheckHTTPVersion = "http_version"
+)
+
+// FailedChecks stores the names of the checks that didn't pass.
+type FailedChecks []string
+
+// Valuer and Scanner implementation for FailedChecks
+func (fc FailedChecks) Value() (driver.Value, error) {
+	return json.Marshal(fc)
+}
+
+func (fc *FailedChecks) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal FailedChecks value: %v", value)
+	}
+
+	return json.Unmarshal(bytes, fc)
+}
+
+// fail records a failed check, describing it in ErrorMsg if it is the first.
+func (hr *HttpResponse) fail(check, msg string) {
+	hr.FailedChecks = append(hr.FailedChecks, check)
+	if hr.ErrorMsg == "" {
+		hr.ErrorMsg = msg
+	}
+}
+
+// warn records a check that only degrades the result. The first warning of a
+// check that otherwise passed sets the reason and error.
+func (hr *HttpResponse) warn(check string, reason Reason, msg string) {
+	first := hr.Result == ResultUp
+	hr.FailedChecks = append(hr.FailedChecks, check)
+	if !first {
+		return
+	}
+	hr.Result = ResultWarn
+	hr.Reason = reason
+	hr.ErrorMsg = msg
 }
 
 // SSLDetails stores SSL-specific information
 type SSLDetails struct {
-	Valid  bool
-	Expiry time.Time
+	Valid       bool
+	Expiry      time.Time // Earliest expiry across the chain
+	Fingerprint string    // SHA-256 of the leaf certificate
+	Issuer      string
+	Error       string `json:",omitempty"` // Why the chain failed verification
+	// Subject and hex serial number of the leaf certificate
+	Subject      string `json:",omitempty"`
+	SerialNumber string `json:",omitempty"`
 }
 
 // Valuer and Scanner implementation for SSLDetails
@@ -55,25 +150,165 @@ func (hr *HttpResponse) GetBaseMonitorResponse() *BaseMonitorResponse {
 	return &hr.BaseMonitorResponse
 }
 
+func (hr *HttpResponse) GetLatency() time.Duration {
+	return time.Duration(hr.Latency) * time.Millisecond
+}
+
+func (hr *HttpResponse) GetSSLExpiryThreshold() int {
+	return hr.SSLExpiryThreshold
+}
+
 type HttpMonitor struct {
 	BaseMonitor
-	Address               string
-	ValidStatusCodes      []int  `gorm:"-"`
-	ValidStatusCodesJSON  string `json:"-"`
-	ShouldWarnOnSSLExpiry bool
-	ShouldCheckSSL        bool
-	ExpectedResponse      string
-	ShouldCheckResponse   bool
-	ReqBody               string
-	ReqContentType        string
-	ReqHeaders            map[string]string `gorm:"-"`
-	ReqHeadersJSON        string
-	RequestMethod         string
-	ReqTimeoutInt         int64         `gorm:"column:req_timeout"`
-	ReqTimeout            time.Duration `gorm:"-"`
+	Address                string
+	ValidStatusCodes       []int  `gorm:"-"` // Any 2xx code is valid when empty
+	ValidStatusCodesJSON   string `json:"-"`
+	ShouldWarnOnSSLExpiry  bool
+	ShouldCheckSSL         bool
+	ExpectedResponse       string
+	ResponseMatchMode      string // exact, the default, contains or not_contains
+	ShouldCheckResponse    bool
+	ExpectEmptyBody        bool                // The body must be empty, e.g. for 204 No Content
+	JsonPathAssertions     []JsonPathAssertion `gorm:"-"`
+	JsonPathAssertionsJSON string              `json:"-"`
+	ReqBody                string
+	ReqContentType         string
+	ReqHeaders             map[string]string `gorm:"-"`
+	ReqHeadersJSON         string
+	RequestMethod          string
+	ReqTimeoutInt          int64         `gorm:"column:req_timeout"`
+	ReqTimeout             time.Duration `gorm:"-"`
+	FollowRedirects        *bool         // Follows redirects unless set to false
+	MaxRedirects           int           // Defaults to 10 when unset
+	MaxConnsPerHost        int           // Overrides the shared transport's limit when set
+	// Resend the method and body when following 301, 302 and 303 redirects,
+	// instead of switching to GET as browsers do. 307 and 308 always keep them.
+	PreserveMethodOnRedirect bool
+	// Bounds reading the body once headers are received; zero leaves it to ReqTimeout
+	BodyReadTimeoutInt int64         `gorm:"column:body_read_timeout"`
+	BodyReadTimeout    time.Duration `gorm:"-"`
+	// Expected latency band, a check answering faster or slower is a warning.
+	// Zero leaves that side of the band open.
+	LatencyMinInt int64         `gorm:"column:latency_min"`
+	LatencyMin    time.Duration `gorm:"-"`
+	LatencyMaxInt int64         `gorm:"column:latency_max"`
+	LatencyMax    time.Duration `gorm:"-"`
+	// Form fields sent url-encoded, or as multipart/form-data when files are
+	// attached or ReqContentType asks for it. Mutually exclusive with ReqBody.
+	FormFields     map[string]string `gorm:"-"`
+	FormFieldsJSON string            `json:"-"`
+	FormFiles      []FormFile        `gorm:"-"`
+	FormFilesJSON  string            `json:"-"`
+	// Trailers the response must end with, e.g. grpc-status for gRPC-web
+	ExpectedTrailers     map[string]string `gorm:"-"`
+	ExpectedTrailersJSON string            `json:"-"`
+	// Certificate fingerprints that may replace the current one without a warning
+	AllowedCertFingerprints     []string `gorm:"-"`
+	AllowedCertFingerprintsJSON string   `json:"-"`
+	LastCertFingerprint         string
+	// Days before the certificate expires to notify at, each once, defaulting
+	// to 30, 14, 7 and 1. ShouldWarnOnSSLExpiry warns from the earliest one.
+	SSLExpiryThresholds     []int  `gorm:"-"`
+	SSLExpiryThresholdsJSON string `json:"-"`
+	SSLExpiryNotified       int    // The latest threshold notified, zero for none
+	// Warn when the body hash changes from the previous check, e.g. to catch
+	// tampering with static content. Changing to one of ExpectedBodyHashes, a
+	// known release, doesn't warn.
+	TrackBodyHash          bool
+	ExpectedBodyHashes     []string `gorm:"-"`
+	ExpectedBodyHashesJSON string   `json:"-"`
+	LastBodyHash           string
+	// Format the body must parse as, "json" or "xml". The matching Accept
+	// header is sent unless ReqHeaders sets one.
+	ExpectedFormat string
+	// Send a CORS preflight from PreflightOrigin before the request. It must
+	// allow the origin and method, and return ExpectedCORSHeaders; an empty
+	// expected value only requires the header.
+	PreflightCheck          bool
+	PreflightOrigin         string
+	ExpectedCORSHeaders     map[string]string `gorm:"-"`
+	ExpectedCORSHeadersJSON string            `json:"-"`
+	// Endpoint whose body this one's is compared to, e.g. a canary or another
+	// region. Diverging by more than ReferenceTolerance, the fraction of lines
+	// that differ, is a warning, or fails the check with ReferenceMismatchDown.
+	ReferenceURL          string
+	ReferenceTolerance    float64
+	ReferenceMismatchDown bool
+	// Executable the response body is piped to; exit status 0 means valid
+	ValidatorCommand  string
+	ValidatorArgs     []string `gorm:"-"`
+	ValidatorArgsJSON string   `json:"-"`
+	// CEL expression deciding the result from the response's status, latency,
+	// body, headers and ssl. It evaluates to true or "up", "warn", or false or
+	// "down", on top of the other checks.
+	ResultExpression string
+	// Warn when the body size differs from its moving average by more than
+	// this fraction, e.g. 0.5 for 50%. Zero disables the check.
+	BodySizeDeviation float64
+	BodySizeBaseline  float64
+	// Send a throwaway request before the measured one, so a cold start, e.g.
+	// of a serverless endpoint, isn't counted in the latency
+	WarmupRequest bool
+	// A 429 Too Many Requests is a warning rather than down, and with
+	// HonorRetryAfter its Retry-After, up to an hour, defers the next check
+	RateLimitWarn   bool
+	HonorRetryAfter bool
+	// Request the http:// variant of an https:// Address too. It must redirect
+	// to https:// or fail; serving plaintext content is a warning. The variant
+	// is requested on DowngradePort, 80 when unset, whatever the port of
+	// Address, which serves TLS. Credential headers aren't sent to it.
+	DowngradeCheck bool
+	DowngradePort  int
+	// HTTP version the request must be sent over, "1.1", "2" or "3". Failing
+	// to negotiate it fails the check. Empty negotiates any.
+	ForceHTTPVersion string
+	// Regular expression the body must match, compiled into responseRegex
+	ResponseRegex string
+	responseRegex *regexp.Regexp `gorm:"-"`
+	// Inclusive ranges of valid status codes, e.g. [200, 299], on top of
+	// ValidStatusCodes
+	ValidStatusRanges     [][2]int `gorm:"-"`
+	ValidStatusRangesJSON string   `json:"-"`
+	// Credentials sent as basic auth when both are set, unless ReqHeaders has
+	// an Authorization header. The password is redacted in JSON and logs.
+	BasicAuthUsername string
+	BasicAuthPassword Secret
+	// How long before the certificate expires ShouldWarnOnSSLExpiry warns,
+	// defaulting to the earliest of SSLExpiryThresholds
+	SslWarnThresholdInt int64         `gorm:"column:ssl_warn_threshold"`
+	SslWarnThreshold    time.Duration `gorm:"-"`
+	// PEM client certificate and key presented for mutual TLS, both or
+	// neither set
+	ClientCertPEM string
+	ClientKeyPEM  Secret
+	// Roots trusted instead of the system ones, for tests against servers
+	// with their own certificates
+	trustedRoots *x509.CertPool
+}
+
+func (hm *HttpMonitor) GetAddress() string {
+	return hm.Address
+}
+
+// GetTimeout allows ReqTimeout for each sequential phase of a check: the
+// warmup request, the request itself and the validator.
+func (hm *HttpMonitor) GetTimeout() time.Duration {
+	timeout := hm.ReqTimeout
+	if timeout <= 0 {
+		timeout = defaultHttpClientTimeout
+	}
+	phases := 1
+	if hm.WarmupRequest {
+		phases++
+	}
+	if hm.ValidatorCommand != "" {
+		phases++
+	}
+	return time.Duration(phases) * timeout
 }
 
 func (hm *HttpMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	hm.Type = TypeHTTP
 	err = hm.BaseMonitor.BeforeSave(tx)
 	if err != nil {
 		return
@@ -81,20 +316,146 @@ func (hm *HttpMonitor) BeforeSave(tx *gorm.DB) (err error) {
 
 	// Serialize ValidStatusCodes to JSON
 	if hm.ValidStatusCodes != nil {
-		validCodesJSON, err := json.Marshal(hm.ValidStatusCodes)
+		hm.ValidStatusCodesJSON, err = marshalColumn("valid_status_codes_json", hm.ValidStatusCodes)
 		if err != nil {
-			return err
+			return
+		}
+	}
+
+	if hm.ValidStatusRanges != nil {
+		for _, statusRange := range hm.ValidStatusRanges {
+			if statusRange[0] < 100 || statusRange[1] > 599 || statusRange[0] > statusRange[1] {
+				return fmt.Errorf("invalid status code range %d-%d", statusRange[0], statusRange[1])
+			}
+		}
+
+		hm.ValidStatusRangesJSON, err = marshalColumn("valid_status_ranges_json", hm.ValidStatusRanges)
+		if err != nil {
+			return
+		}
+	}
+
+	if hm.JsonPathAssertions != nil {
+		for _, assertion := range hm.JsonPathAssertions {
+			if err = assertion.validate(); err != nil {
+				return
+			}
+		}
+
+		hm.JsonPathAssertionsJSON, err = marshalColumn("json_path_assertions_json", hm.JsonPathAssertions)
+		if err != nil {
+			return
+		}
+	}
+
+	if err = hm.validateTarget(); err != nil {
+		return
+	}
+
+	if err = hm.validatePreflight(); err != nil {
+		return
+	}
+
+	if err = hm.validateDowngradeCheck(); err != nil {
+		return
+	}
+
+	if err = hm.validateForceHTTPVersion(); err != nil {
+		return
+	}
+
+	if hm.ExpectedCORSHeaders != nil {
+		hm.ExpectedCORSHeadersJSON, err = marshalColumn("expected_cors_headers_json", hm.ExpectedCORSHeaders)
+		if err != nil {
+			return
+		}
+	}
+
+	if err = hm.validateResponseMatchMode(); err != nil {
+		return
+	}
+
+	if err = hm.compileResponseRegex(); err != nil {
+		return
+	}
+
+	if err = hm.validateClientCert(); err != nil {
+		return
+	}
+
+	if err = hm.validateExpectedFormat(); err != nil {
+		return
+	}
+
+	if err = hm.validateValidatorCommand(); err != nil {
+		return
+	}
+
+	if err = hm.validateResultExpression(); err != nil {
+		return
+	}
+
+	if hm.SSLExpiryThresholds != nil {
+		if err = validateSSLExpiryThresholds(hm.SSLExpiryThresholds); err != nil {
+			return
+		}
+		hm.SSLExpiryThresholdsJSON, err = marshalColumn("ssl_expiry_thresholds_json", hm.SSLExpiryThresholds)
+		if err != nil {
+			return
+		}
+	}
+
+	if err = hm.validateForm(); err != nil {
+		return
+	}
+
+	if hm.FormFields != nil {
+		hm.FormFieldsJSON, err = marshalColumn("form_fields_json", hm.FormFields)
+		if err != nil {
+			return
+		}
+	}
+
+	if hm.FormFiles != nil {
+		hm.FormFilesJSON, err = marshalColumn("form_files_json", hm.FormFiles)
+		if err != nil {
+			return
+		}
+	}
+
+	if hm.ExpectedTrailers != nil {
+		hm.ExpectedTrailersJSON, err = marshalColumn("expected_trailers_json", hm.ExpectedTrailers)
+		if err != nil {
+			return
+		}
+	}
+
+	if hm.ExpectedBodyHashes != nil {
+		hm.ExpectedBodyHashesJSON, err = marshalColumn("expected_body_hashes_json", hm.ExpectedBodyHashes)
+		if err != nil {
+			return
+		}
+	}
+
+	if hm.ValidatorArgs != nil {
+		hm.ValidatorArgsJSON, err = marshalColumn("validator_args_json", hm.ValidatorArgs)
+		if err != nil {
+			return
+		}
+	}
+
+	if hm.AllowedCertFingerprints != nil {
+		hm.AllowedCertFingerprintsJSON, err = marshalColumn("allowed_cert_fingerprints_json", hm.AllowedCertFingerprints)
+		if err != nil {
+			return
 		}
-		hm.ValidStatusCodesJSON = string(validCodesJSON)
 	}
 
-	var headersJSON []byte
 	if hm.ReqHeaders != nil {
-		headersJSON, err = json.Marshal(hm.ReqHeaders)
+		hm.ReqHeadersJSON, err = marshalColumn("req_headers_json", hm.ReqHeaders)
 		if err != nil {
 			return
 		}
-		hm.ReqHeadersJSON = string(headersJSON)
 	}
 
 	if hm.ReqTimeout == 0 {
@@ -106,6 +467,39 @@ func (hm *HttpMonitor) BeforeSave(tx *gorm.DB) (err error) {
 	}
 	hm.ReqTimeoutInt = int64(hm.ReqTimeout)
 
+	if hm.BodyReadTimeout < 0 {
+		hm.BodyReadTimeout = 0
+	}
+	hm.BodyReadTimeoutInt = int64(hm.BodyReadTimeout)
+
+	if hm.SslWarnThreshold < 0 {
+		return errors.New("SSL warn threshold must not be negative")
+	}
+	hm.SslWarnThresholdInt = int64(hm.SslWarnThreshold)
+
+	if hm.LatencyMin < 0 || hm.LatencyMax < 0 {
+		return errors.New("latency band can't be negative")
+	}
+	if hm.LatencyMax > 0 && hm.LatencyMin > hm.LatencyMax {
+		return fmt.Errorf("latency min %s is above latency max %s", hm.LatencyMin, hm.LatencyMax)
+	}
+	hm.LatencyMinInt = int64(hm.LatencyMin)
+	hm.LatencyMaxInt = int64(hm.LatencyMax)
+
+	if hm.ReferenceTolerance < 0 || hm.ReferenceTolerance > 1 {
+		return fmt.Errorf("reference tolerance must be between 0 and 1, got %v", hm.ReferenceTolerance)
+	}
+
+	if hm.BodySizeDeviation < 0 {
+		return fmt.Errorf("body size deviation can't be negative, got %v", hm.BodySizeDeviation)
+	}
+
+	// An empty expectation only passes empty bodies, which ExpectEmptyBody
+	// states explicitly
+	if hm.ShouldCheckResponse && hm.ExpectedResponse == "" && len(hm.JsonPathAssertions) == 0 {
+		return errors.New("checking the response requires an expected response or JSONPath assertions; use ExpectEmptyBody for an empty body")
+	}
+
 	return nil
 }
 
@@ -117,19 +511,75 @@ func (hm *HttpMonitor) AfterFind(tx *gorm.DB) (err error) {
 
 	// Deserialize ValidStatusCodes from JSON
 	if hm.ValidStatusCodesJSON != "" {
-		var validCodes []int
-		if err := json.Unmarshal([]byte(hm.ValidStatusCodesJSON), &validCodes); err != nil {
+		if err := unmarshalColumn(hm.ID, "valid_status_codes_json", hm.ValidStatusCodesJSON, &hm.ValidStatusCodes); err != nil {
+			return err
+		}
+	}
+
+	if hm.ValidStatusRangesJSON != "" {
+		if err := unmarshalColumn(hm.ID, "valid_status_ranges_json", hm.ValidStatusRangesJSON, &hm.ValidStatusRanges); err != nil {
+			return err
+		}
+	}
+
+	if hm.JsonPathAssertionsJSON != "" {
+		if err := unmarshalColumn(hm.ID, "json_path_assertions_json", hm.JsonPathAssertionsJSON, &hm.JsonPathAssertions); err != nil {
+			return err
+		}
+	}
+
+	if hm.FormFieldsJSON != "" {
+		if err := unmarshalColumn(hm.ID, "form_fields_json", hm.FormFieldsJSON, &hm.FormFields); err != nil {
+			return err
+		}
+	}
+
+	if hm.FormFilesJSON != "" {
+		if err := unmarshalColumn(hm.ID, "form_files_json", hm.FormFilesJSON, &hm.FormFiles); err != nil {
+			return err
+		}
+	}
+
+	if hm.ExpectedTrailersJSON != "" {
+		if err := unmarshalColumn(hm.ID, "expected_trailers_json", hm.ExpectedTrailersJSON, &hm.ExpectedTrailers); err != nil {
+			return err
+		}
+	}
+
+	if hm.ExpectedCORSHeadersJSON != "" {
+		if err := unmarshalColumn(hm.ID, "expected_cors_headers_json", hm.ExpectedCORSHeadersJSON, &hm.ExpectedCORSHeaders); err != nil {
+			return err
+		}
+	}
+
+	if hm.ExpectedBodyHashesJSON != "" {
+		if err := unmarshalColumn(hm.ID, "expected_body_hashes_json", hm.ExpectedBodyHashesJSON, &hm.ExpectedBodyHashes); err != nil {
+			return err
+		}
+	}
+
+	if hm.ValidatorArgsJSON != "" {
+		if err := unmarshalColumn(hm.ID, "validator_args_json", hm.ValidatorArgsJSON, &hm.ValidatorArgs); err != nil {
+			return err
+		}
+	}
+
+	if hm.SSLExpiryThresholdsJSON != "" {
+		if err := unmarshalColumn(hm.ID, "ssl_expiry_thresholds_json", hm.SSLExpiryThresholdsJSON, &hm.SSLExpiryThresholds); err != nil {
+			return err
+		}
+	}
+
+	if hm.AllowedCertFingerprintsJSON != "" {
+		if err := unmarshalColumn(hm.ID, "allowed_cert_fingerprints_json", hm.AllowedCertFingerprintsJSON, &hm.AllowedCertFingerprints); err != nil {
 			return err
 		}
-		hm.ValidStatusCodes = validCodes
 	}
 
 	if hm.ReqHeadersJSON != "" {
-		var headers map[string]string
-		if err := json.Unmarshal([]byte(hm.ReqHeadersJSON), &headers); err != nil {
+		if err := unmarshalColumn(hm.ID, "req_headers_json", hm.ReqHeadersJSON, &hm.ReqHeaders); err != nil {
 			return err
 		}
-		hm.ReqHeaders = headers
 	}
 
 	hm.ReqTimeout = time.Duration(hm.ReqTimeoutInt)
@@ -138,6 +588,14 @@ func (hm *HttpMonitor) AfterFind(tx *gorm.DB) (err error) {
 	} else if hm.ReqTimeout < minHttpClientTimeout {
 		hm.ReqTimeout = minHttpClientTimeout
 	}
+	hm.BodyReadTimeout = time.Duration(hm.BodyReadTimeoutInt)
+	hm.SslWarnThreshold = time.Duration(hm.SslWarnThresholdInt)
+	hm.LatencyMin = time.Duration(hm.LatencyMinInt)
+	hm.LatencyMax = time.Duration(hm.LatencyMaxInt)
+
+	if err := hm.compileResponseRegex(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -149,83 +607,365 @@ func (hm *HttpMonitor) Monitor(ctx context.Context) MonitorResponser {
 		BaseMonitorResponse: BaseMonitorResponse{
 			MonitorID:    hm.ID,
 			Result:       ResultDown,
-			ResponseTime: now(),
+			ResponseTime: hm.Now(),
 		},
 		SslResp: SSLDetails{},
 	}
 
-	var body io.Reader
-	if len(hm.ReqBody) > 0 {
-		body = strings.NewReader(hm.ReqBody)
+	// Bounds the whole request, and is cancelled early to abort a body read
+	// that exceeds BodyReadTimeout
+	reqTimeout := hm.ReqTimeout
+	if reqTimeout <= 0 {
+		reqTimeout = defaultHttpClientTimeout
 	}
+	reqCtx, cancelReq := context.WithTimeout(ctx, reqTimeout)
+	defer cancelReq()
+	var staleDNS atomic.Bool
+	reqCtx = context.WithValue(reqCtx, staleDNSKey{}, &staleDNS)
 
-	req, err := http.NewRequestWithContext(ctx, hm.RequestMethod, hm.Address, body)
+	req, err := hm.newRequest(reqCtx)
 	if err != nil {
 		monitorResult.ErrorMsg = err.Error()
 		return monitorResult
 	}
 
-	// Set Content-Type if request body is provided
-	if hm.ReqBody != "" && hm.ReqContentType != "" {
-		req.Header.Set("Content-Type", hm.ReqContentType)
+	checkSSL := hm.ShouldCheckSSL || hm.ShouldWarnOnSSLExpiry
+	if checkSSL && req.URL.Scheme == "https" {
+		monitorResult.SslResp = hm.CheckSSL(ctx)
 	}
 
-	// Add custom headers
-	for key, value := range hm.ReqHeaders {
-		req.Header.Set(key, value)
+	if hm.PreflightCheck {
+		if err := hm.checkPreflight(reqCtx); err != nil {
+			monitorResult.fail(CheckPreflight, err.Error())
+		}
 	}
 
-	if hm.ShouldCheckSSL || hm.ShouldWarnOnSSLExpiry {
-		monitorResult.SslResp = hm.checkSSL()
+	var downgradeMsg string
+	if hm.DowngradeCheck {
+		monitorResult.Downgrade, downgradeMsg = hm.checkDowngrade(reqCtx)
 	}
 
-	client := &http.Client{Timeout: time.Duration(hm.ReqTimeout)}
+	var warmupErr error
+	if hm.WarmupRequest {
+		warmupErr = hm.warmup(ctx, reqTimeout)
+	}
+
+	// The client only carries the per-check redirect policy, connections
+	// are pooled by the shared transport
+	client := &http.Client{
+		Transport:     hm.roundTripper(),
+		CheckRedirect: hm.checkRedirect(monitorResult),
+	}
 
-	startTime := now()
+	startTime := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		if errors.Is(err, errTooManyRedirects) {
+			monitorResult.Reason = ReasonRedirectLoop
+			monitorResult.ErrorMsg = fmt.Sprintf("redirect loop: more than %d redirects", hm.maxRedirects())
+			return monitorResult
+		}
+		monitorResult.Reason = classifyError(err)
 		monitorResult.ErrorMsg = err.Error()
+		if warmupErr != nil {
+			monitorResult.ErrorMsg += fmt.Sprintf(" (warmup request also failed: %s)", warmupErr)
+		}
 		return monitorResult
 	}
 
-	monitorResult.Latency = time.Since(startTime).Milliseconds()
-	monitorResult.StatusCodeValid = lo.Contains(hm.ValidStatusCodes, resp.StatusCode)
-	if !monitorResult.StatusCodeValid {
-		monitorResult.Result = ResultDown
-		return monitorResult
-	}
-
+	// Drain a little and close the body on every path, so the connection can
+	// return to the pool
 	defer func() {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
 		if closeErr := resp.Body.Close(); closeErr != nil {
 			logging.Logger.Sugar().Warn("Error closing response body", closeErr)
 		}
 	}()
 
-	if hm.ShouldCheckResponse {
-		respBody, err := io.ReadAll(resp.Body)
+	monitorResult.Latency = time.Since(startTime).Milliseconds()
+	monitorResult.StatusCode = resp.StatusCode
+	monitorResult.Protocol = resp.Proto
+	if err := hm.checkHTTPVersion(resp); err != nil {
+		monitorResult.fail(CheckHTTPVersion, err.Error())
+	}
+
+	var certChange string
+	if checkSSL {
+		// Redirects, e.g. upgrading http:// to https://, may end on another
+		// endpoint than Address, whose certificate is the one served
+		final := resp.Request.URL
+		redirected := final.Scheme != req.URL.Scheme || final.Host != req.URL.Host
+		if redirected && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+			chain := resp.TLS.PeerCertificates
+			if len(resp.TLS.VerifiedChains) > 0 {
+				chain = resp.TLS.VerifiedChains[0]
+			}
+			monitorResult.SslResp = certificateDetails(chain)
+		}
+		certChange = hm.trackCertificate(monitorResult.SslResp)
+	}
+	metrics.HttpResponses.WithLabelValues(strconv.FormatUint(uint64(hm.ID), 10), strconv.Itoa(resp.StatusCode)).Inc()
+	monitorResult.StatusCodeValid = hm.statusCodeValid(resp.StatusCode)
+	// Rate limiting says nothing of the body, so it isn't checked
+	if resp.StatusCode == http.StatusTooManyRequests && !monitorResult.StatusCodeValid {
+		hm.rateLimited(resp, monitorResult)
+		return monitorResult
+	}
+	if !monitorResult.StatusCodeValid {
+		monitorResult.fail(CheckStatus, fmt.Sprintf("unexpected status code: %d", resp.StatusCode))
+	}
+
+	monitorResult.BodySize = resp.ContentLength
+	var referenceMismatch string
+	var expressionWarn bool
+	if hm.ShouldCheckResponse || hm.ResponseRegex != "" || hm.ExpectEmptyBody || len(hm.JsonPathAssertions) > 0 || hm.ExpectedFormat != "" || hm.ReferenceURL != "" || hm.TrackBodyHash || hm.ValidatorCommand != "" || hm.BodySizeDeviation > 0 || len(hm.ExpectedTrailers) > 0 || hm.ResultExpression != "" {
+		respBody, err := hm.readBody(resp.Body, cancelReq)
 		if err != nil {
-			monitorResult.ErrorMsg = err.Error()
+			if errors.Is(err, errBodyReadTimeout) {
+				monitorResult.Reason = ReasonBodyTimeout
+			}
+			monitorResult.fail(CheckBody, err.Error())
 			return monitorResult
 		}
+		monitorResult.BodySize = int64(len(respBody))
 
-		gotResp := string(respBody)
-		if gotResp != hm.ExpectedResponse {
-			monitorResult.ErrorMsg = fmt.Sprintf("response is not as expected: %s", gotResp)
-			return monitorResult
+		// Trailers are only populated once the body was read to the end
+		if err := hm.checkTrailers(resp.Trailer); err != nil {
+			monitorResult.fail(CheckTrailers, err.Error())
+		}
+
+		if hm.TrackBodyHash {
+			hash := sha256.Sum256(respBody)
+			monitorResult.BodyHash = hex.EncodeToString(hash[:])
+		}
+
+		gotResp := string(decodeBody(respBody, resp.Header.Get("Content-Type")))
+		if hm.ExpectEmptyBody && len(respBody) > 0 {
+			monitorResult.fail(CheckEmptyBody, fmt.Sprintf("expected an empty body, got: %s", gotResp))
+		}
+
+		if hm.ShouldCheckResponse {
+			if err := hm.checkResponse(gotResp); err != nil {
+				monitorResult.fail(CheckResponse, err.Error())
+			}
+		}
+
+		if hm.ResponseRegex != "" {
+			if err := hm.checkResponseRegex(gotResp); err != nil {
+				monitorResult.fail(CheckRegex, err.Error())
+			}
+		}
+
+		if err := hm.checkJsonPaths(respBody); err != nil {
+			monitorResult.fail(CheckJsonPath, err.Error())
+		}
+
+		if err := hm.checkFormat(respBody); err != nil {
+			monitorResult.fail(CheckFormat, err.Error())
+		}
+
+		if hm.ReferenceURL != "" {
+			msg, err := hm.checkReference(reqCtx, respBody)
+			if err != nil {
+				// The reference being unavailable says nothing of this endpoint
+				referenceMismatch = err.Error()
+			} else if msg != "" && hm.ReferenceMismatchDown {
+				monitorResult.fail(CheckReference, msg)
+			} else {
+				referenceMismatch = msg
+			}
+		}
+
+		if hm.ValidatorCommand != "" {
+			if err := hm.runValidator(ctx, respBody); err != nil {
+				if monitorResult.Reason == ReasonNone {
+					monitorResult.Reason = ReasonValidatorFailed
+				}
+				monitorResult.fail(CheckValidator, err.Error())
+			}
+		}
+
+		if hm.ResultExpression != "" {
+			result, err := hm.evalResultExpression(ctx, resp, gotResp, monitorResult)
+			if err != nil {
+				monitorResult.fail(CheckExpression, err.Error())
+			} else if result == ResultDown {
+				monitorResult.fail(CheckExpression, "result expression evaluated to down")
+			} else {
+				expressionWarn = result == ResultWarn
+			}
 		}
 	}
 
-	if hm.ShouldWarnOnSSLExpiry && monitorResult.SslResp.Expiry.Sub(now()) < (30*24*time.Hour) {
-		monitorResult.Result = ResultWarn
+	if len(monitorResult.FailedChecks) > 0 {
+		// Warnings are moot once the check failed, but still listed
+		monitorResult.Result = ResultDown
 	} else {
 		monitorResult.Result = ResultUp
 	}
 
+	if certChange != "" {
+		monitorResult.warn(CheckCertificate, ReasonCertChanged, certChange)
+	}
+	// Error pages would be reported as tampering
+	if hm.TrackBodyHash && monitorResult.StatusCodeValid {
+		if msg := hm.trackBodyHash(monitorResult.BodyHash); msg != "" {
+			monitorResult.warn(CheckBodyHash, ReasonBodyChanged, msg)
+		}
+	}
+	if hm.ShouldWarnOnSSLExpiry {
+		if msg := hm.sslExpiryWarning(monitorResult.SslResp.Expiry); msg != "" {
+			monitorResult.warn(CheckSSLExpiry, ReasonNone, msg)
+		}
+		monitorResult.SSLExpiryThreshold = hm.trackSSLExpiry(monitorResult.SslResp.Expiry)
+	}
+	if referenceMismatch != "" {
+		monitorResult.warn(CheckReference, ReasonNone, referenceMismatch)
+	}
+	if downgradeMsg != "" {
+		monitorResult.warn(CheckDowngrade, ReasonNone, downgradeMsg)
+	}
+	if expressionWarn {
+		monitorResult.warn(CheckExpression, ReasonNone, "result expression evaluated to warn")
+	}
+	if msg := hm.checkLatency(time.Duration(monitorResult.Latency) * time.Millisecond); msg != "" {
+		monitorResult.warn(CheckLatency, ReasonNone, msg)
+	}
+	// Error pages would skew the body size baseline
+	if hm.BodySizeDeviation > 0 && monitorResult.StatusCodeValid {
+		if msg := hm.trackBodySize(monitorResult.BodySize); msg != "" {
+			monitorResult.warn(CheckBodySize, ReasonNone, msg)
+		}
+	}
+	if staleDNS.Load() {
+		monitorResult.warn(CheckDNS, ReasonDNS, "DNS lookup failed, connected using cached addresses")
+	}
+
 	return monitorResult
 }
 
-// checkSSL validates the SSL certificate and fetches its expiry date.
-func (hm *HttpMonitor) checkSSL() SSLDetails {
+// newRequest builds the monitored request, with its body and headers.
+func (hm *HttpMonitor) newRequest(ctx context.Context) (*http.Request, error) {
+	body, contentType, err := hm.requestBody()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, hm.RequestMethod, hm.Address, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set Content-Type if request body is provided
+	if body != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if hm.ExpectedFormat != "" {
+		req.Header.Set("Accept", formatMediaTypes[hm.ExpectedFormat])
+	}
+
+	// Add custom headers
+	for key, value := range hm.ReqHeaders {
+		req.Header.Set(key, value)
+	}
+
+	// An explicit Authorization header wins
+	if hm.BasicAuthUsername != "" && hm.BasicAuthPassword != "" && req.Header.Get("Authorization") == "" {
+		req.SetBasicAuth(hm.BasicAuthUsername, string(hm.BasicAuthPassword))
+	}
+	return req, nil
+}
+
+// validateTarget rejects an Address or ReferenceURL whose host isn't an
+// allowed target.
+func (hm *HttpMonitor) validateTarget() error {
+	parsedURL, err := url.Parse(hm.Address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if err := validateTarget(parsedURL.Hostname()); err != nil {
+		return err
+	}
+
+	if hm.ReferenceURL == "" {
+		return nil
+	}
+	referenceURL, err := url.Parse(hm.ReferenceURL)
+	if err != nil {
+		return fmt.Errorf("invalid reference URL: %w", err)
+	}
+	return validateTarget(referenceURL.Hostname())
+}
+
+// statusCodeValid reports whether code is one of ValidStatusCodes or within
+// one of ValidStatusRanges, or any 2xx code when neither is configured.
+func (hm *HttpMonitor) statusCodeValid(code int) bool {
+	if len(hm.ValidStatusCodes) == 0 && len(hm.ValidStatusRanges) == 0 {
+		return code >= 200 && code < 300
+	}
+	if lo.Contains(hm.ValidStatusCodes, code) {
+		return true
+	}
+	for _, statusRange := range hm.ValidStatusRanges {
+		if code >= statusRange[0] && code <= statusRange[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTrailers compares the received trailers to ExpectedTrailers.
+func (hm *HttpMonitor) checkTrailers(trailer http.Header) error {
+	names := lo.Keys(hm.ExpectedTrailers)
+	slices.Sort(names)
+	for _, name := range names {
+		if got := trailer.Get(name); got != hm.ExpectedTrailers[name] {
+			return fmt.Errorf("trailer %s: got %q, expected %q", name, got, hm.ExpectedTrailers[name])
+		}
+	}
+	return nil
+}
+
+// checkLatency describes how latency falls outside the expected band, if it
+// does.
+func (hm *HttpMonitor) checkLatency(latency time.Duration) string {
+	if hm.LatencyMin > 0 && latency < hm.LatencyMin {
+		return fmt.Sprintf("latency %s is below the expected minimum %s", latency, hm.LatencyMin)
+	}
+	if hm.LatencyMax > 0 && latency > hm.LatencyMax {
+		return fmt.Sprintf("latency %s is above the expected maximum %s", latency, hm.LatencyMax)
+	}
+	return ""
+}
+
+var errBodyReadTimeout = errors.New("body read timed out")
+
+// readBody reads body, calling cancel to abort the request when the read
+// takes longer than BodyReadTimeout.
+func (hm *HttpMonitor) readBody(body io.Reader, cancel context.CancelFunc) ([]byte, error) {
+	if hm.BodyReadTimeout <= 0 {
+		return io.ReadAll(body)
+	}
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(hm.BodyReadTimeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	respBody, err := io.ReadAll(body)
+	if err != nil && timedOut.Load() {
+		return nil, fmt.Errorf("%w after %s", errBodyReadTimeout, hm.BodyReadTimeout)
+	}
+	return respBody, err
+}
+
+// CheckSSL verifies the certificate chain served at Address against the
+// trusted roots and the address hostname, and fetches its expiry date. It
+// gives up once ReqTimeout elapses or ctx is done.
+func (hm *HttpMonitor) CheckSSL(ctx context.Context) SSLDetails {
 	sslDetails := SSLDetails{}
 
 	// Parse the URL to extract the hostname
@@ -233,6 +973,7 @@ func (hm *HttpMonitor) checkSSL() SSLDetails {
 	if err != nil {
 		logging.Logger.Sugar().Errorf("Failed to parse URL: %v", err)
 		sslDetails.Valid = false
+		sslDetails.Error = fmt.Sprintf("invalid address: %s", err)
 		return sslDetails
 	}
 
@@ -242,22 +983,156 @@ func (hm *HttpMonitor) checkSSL() SSLDetails {
 		hostname += ":443" // Add the default port if it's not already present
 	}
 
-	conn, err := tls.Dial("tcp", hostname, &tls.Config{})
+	// The chain is verified below rather than by the handshake, so that an
+	// invalid one is still described
+	tlsConfig := &tls.Config{ServerName: parsedURL.Hostname(), InsecureSkipVerify: true}
+	if clientConfig := clientTLSConfig(hm.transportKey()); clientConfig != nil {
+		tlsConfig.Certificates = clientConfig.Certificates
+	}
+	// Connecting and the handshake are bounded like a request
+	timeout := hm.ReqTimeout
+	if timeout <= 0 {
+		timeout = defaultHttpClientTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &tls.Dialer{NetDialer: newDialer(), Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", hostname)
 	if err != nil {
 		logging.Logger.Sugar().Errorf("Failed to establish SSL connection: %v", err)
 		sslDetails.Valid = false
+		sslDetails.Error = err.Error()
 		return sslDetails
 	}
 	defer conn.Close()
 
 	// Retrieve the certificate chain
-	cert := conn.ConnectionState().PeerCertificates[0]
-	sslDetails.Valid = true
-	sslDetails.Expiry = cert.NotAfter
-
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		sslDetails.Error = "no certificate presented"
+		return sslDetails
+	}
+	chain, err := verifyChain(certs, parsedURL.Hostname(), hm.rootCAs())
+	sslDetails = certificateDetails(chain)
+	if err != nil {
+		sslDetails.Valid = false
+		sslDetails.Error = err.Error()
+	}
 	return sslDetails
 }
 
+// rootCAs returns the roots the monitored requests trust, nil for the system
+// roots.
+func (hm *HttpMonitor) rootCAs() *x509.CertPool {
+	if tlsConfig := hm.transport().TLSClientConfig; tlsConfig != nil {
+		return tlsConfig.RootCAs
+	}
+	return nil
+}
+
+// verifyChain verifies the leaf of certs for serverName, the rest being
+// intermediates, and returns the verified chain up to the root. certs are
+// returned as is when verification fails.
+func verifyChain(certs []*x509.Certificate, serverName string, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         roots,
+	})
+	if err != nil {
+		return certs, err
+	}
+	return chains[0], nil
+}
+
+// certificateDetails describes chain, leaf first, as valid. It expires with
+// the earliest of its certificates.
+func certificateDetails(chain []*x509.Certificate) SSLDetails {
+	leaf := chain[0]
+	expiry := leaf.NotAfter
+	for _, cert := range chain[1:] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	fingerprint := sha256.Sum256(leaf.Raw)
+	return SSLDetails{
+		Valid:        true,
+		Expiry:       expiry,
+		Fingerprint:  hex.EncodeToString(fingerprint[:]),
+		Issuer:       leaf.Issuer.String(),
+		Subject:      leaf.Subject.String(),
+		SerialNumber: leaf.SerialNumber.Text(16),
+	}
+}
+
+// trackCertificate remembers the certificate fingerprint seen by this check
+// and describes the change when it unexpectedly differs from the previous one.
+func (hm *HttpMonitor) trackCertificate(ssl SSLDetails) string {
+	if ssl.Fingerprint == "" {
+		return ""
+	}
+
+	previous := hm.LastCertFingerprint
+	hm.LastCertFingerprint = ssl.Fingerprint
+	if previous == "" || previous == ssl.Fingerprint || lo.Contains(hm.AllowedCertFingerprints, ssl.Fingerprint) {
+		return ""
+	}
+
+	return fmt.Sprintf("certificate changed from %s to %s (issuer: %s)", previous, ssl.Fingerprint, ssl.Issuer)
+}
+
+// trackBodyHash remembers the body hash seen by this check and describes the
+// change when it unexpectedly differs from the previous one.
+func (hm *HttpMonitor) trackBodyHash(hash string) string {
+	if hash == "" {
+		return ""
+	}
+
+	previous := hm.LastBodyHash
+	hm.LastBodyHash = hash
+	if previous == "" || previous == hash || lo.Contains(hm.ExpectedBodyHashes, hash) {
+		return ""
+	}
+
+	return fmt.Sprintf("body changed from %s to %s", previous, hash)
+}
+
+// bodySizeSmoothing is the weight of each new body size in the baseline
+const bodySizeSmoothing = 0.2
+
+// trackBodySize folds size into the body size baseline and describes the
+// anomaly when it deviates from the previous baseline by more than
+// BodySizeDeviation.
+func (hm *HttpMonitor) trackBodySize(size int64) string {
+	baseline := hm.BodySizeBaseline
+	if baseline <= 0 {
+		hm.BodySizeBaseline = float64(size)
+		return ""
+	}
+	hm.BodySizeBaseline = baseline*(1-bodySizeSmoothing) + float64(size)*bodySizeSmoothing
+
+	deviation := math.Abs(float64(size)-baseline) / baseline
+	if deviation <= hm.BodySizeDeviation {
+		return ""
+	}
+	return fmt.Sprintf("body size %d bytes deviates %.0f%% from the baseline of %.0f bytes", size, deviation*100, baseline)
+}
+
+// RuntimeState returns the check state to persist after each run.
+func (hm *HttpMonitor) RuntimeState() map[string]any {
+	state := hm.BaseMonitor.RuntimeState()
+	state["last_cert_fingerprint"] = hm.LastCertFingerprint
+	state["body_size_baseline"] = hm.BodySizeBaseline
+	state["last_body_hash"] = hm.LastBodyHash
+	state["ssl_expiry_notified"] = hm.SSLExpiryNotified
+	return state
+}
+
 func (hm *HttpMonitor) IsEnabled() bool {
 	return hm.Enabled
 }
@@ -2,11 +2,31 @@ package monitor
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -67,6 +87,29 @@ func TestHttpMonitor_Monitor_Success(t *testing.T) {
 	assert.Equal(t, "", response.GetBaseMonitorResponse().ErrorMsg)
 }
 
+func TestHttpMonitor_Monitor_UsesClock(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	simulated := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	hm := &HttpMonitor{
+		BaseMonitor: BaseMonitor{
+			Clock: func() time.Time { return simulated },
+		},
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, simulated, response.GetBaseMonitorResponse().ResponseTime)
+}
+
 func TestHttpMonitor_Monitor_Failure_StatusCode(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -86,6 +129,7 @@ func TestHttpMonitor_Monitor_Failure_StatusCode(t *testing.T) {
 	assert.NotNil(t, response)
 	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
 	assert.False(t, response.(*HttpResponse).StatusCodeValid)
+	assert.Equal(t, http.StatusInternalServerError, response.(*HttpResponse).StatusCode)
 }
 
 func TestHttpMonitor_Monitor_Failure_ResponseBody(t *testing.T) {
@@ -112,6 +156,247 @@ func TestHttpMonitor_Monitor_Failure_ResponseBody(t *testing.T) {
 	assert.Equal(t, "response is not as expected: Unexpected response", response.GetBaseMonitorResponse().ErrorMsg)
 }
 
+func TestHttpMonitor_Monitor_ResponseMatchMode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("All systems operational"))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		mode     string
+		expected string
+		errorMsg string
+	}{
+		{"", "All systems operational", ""},
+		{MatchExact, "operational", "response is not as expected: All systems operational"},
+		{MatchContains, "operational", ""},
+		{MatchContains, "error", `response does not contain "error"`},
+		{MatchNotContains, "error", ""},
+		{MatchNotContains, "systems", `response contains "systems"`},
+	}
+	for _, tt := range tests {
+		hm := &HttpMonitor{
+			Address:             ts.URL,
+			RequestMethod:       http.MethodGet,
+			ShouldCheckResponse: true,
+			ExpectedResponse:    tt.expected,
+			ResponseMatchMode:   tt.mode,
+			ReqTimeout:          5 * time.Second,
+		}
+		response := hm.Monitor(context.Background()).GetBaseMonitorResponse()
+		assert.Equal(t, tt.errorMsg, response.ErrorMsg, tt.mode)
+		if tt.errorMsg == "" {
+			assert.Equal(t, ResultUp, response.Result, tt.mode)
+		} else {
+			assert.Equal(t, ResultDown, response.Result, tt.mode)
+		}
+	}
+}
+
+func TestHttpMonitor_validateResponseMatchMode(t *testing.T) {
+	hm := &HttpMonitor{ResponseMatchMode: "regex"}
+	assert.EqualError(t, hm.validateResponseMatchMode(), `unknown response match mode "regex", must be exact, contains or not_contains`)
+}
+
+func TestHttpMonitor_Monitor_ResponseRegex(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status" : "ok"}`))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:       ts.URL,
+		RequestMethod: http.MethodGet,
+		ResponseRegex: `"status"\s*:\s*"ok"`,
+		ReqTimeout:    5 * time.Second,
+	}
+	assert.NoError(t, hm.BeforeSave(nil))
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+
+	hm.ResponseRegex = `"status"\s*:\s*"degraded"`
+	assert.NoError(t, hm.BeforeSave(nil))
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, FailedChecks{CheckRegex}, response.FailedChecks)
+	assert.Equal(t, `response does not match "\"status\"\\s*:\\s*\"degraded\""`, response.ErrorMsg)
+
+	hm.ResponseRegex = "(unclosed"
+	assert.ErrorContains(t, hm.BeforeSave(nil), "invalid response regex")
+}
+
+func TestHttpMonitor_Monitor_JsonPathArrayFilter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[{"service":"db","status":"ok"},{"service":"cache","status":"degraded"}]`))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+		JsonPathAssertions: []JsonPathAssertion{
+			{Path: `$[?(@.service=="db")].status`, Expected: "ok"},
+		},
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+
+	hm.JsonPathAssertions = []JsonPathAssertion{
+		{Path: `$[?(@.service=="cache")].status`, Expected: "ok"},
+	}
+
+	response = hm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, `jsonpath $[?(@.service=="cache")].status: got "degraded", expected "ok"`, response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestHttpMonitor_BeforeSave_InvalidJsonPath(t *testing.T) {
+	hm := &HttpMonitor{
+		JsonPathAssertions: []JsonPathAssertion{{Path: "$[?(@.service==", Expected: "ok"}},
+	}
+
+	err := hm.BeforeSave(&gorm.DB{})
+	assert.Error(t, err)
+}
+
+func TestHttpMonitor_Monitor_RedirectLoop(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, ts.URL+"/loop", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+		MaxRedirects:     3,
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, ReasonRedirectLoop, response.GetBaseMonitorResponse().Reason)
+	loopHop := RedirectHop{URL: ts.URL + "/loop", Method: http.MethodGet, StatusCode: http.StatusFound, Location: ts.URL + "/loop"}
+	assert.Equal(t, RedirectChain{
+		{URL: ts.URL, Method: http.MethodGet, StatusCode: http.StatusFound, Location: ts.URL + "/loop"},
+		loopHop, loopHop, loopHop,
+	}, response.(*HttpResponse).RedirectChain)
+}
+
+func TestHttpMonitor_Monitor_RedirectChain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/secure", http.StatusMovedPermanently)
+		case "/secure":
+			http.Redirect(w, r, "/www", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL + "/",
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, RedirectChain{
+		{URL: ts.URL + "/", Method: http.MethodGet, StatusCode: http.StatusMovedPermanently, Location: "/secure"},
+		{URL: ts.URL + "/secure", Method: http.MethodGet, StatusCode: http.StatusFound, Location: "/www"},
+	}, response.(*HttpResponse).RedirectChain)
+}
+
+func TestHttpMonitor_Monitor_FollowsRedirectsByDefault(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{Address: ts.URL + "/", RequestMethod: http.MethodGet, ReqTimeout: 5 * time.Second}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestHttpMonitor_Monitor_PreserveMethodOnRedirect(t *testing.T) {
+	var gotMethod, gotBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/done", http.StatusSeeOther)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotBody = r.Method, string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL + "/",
+		RequestMethod:    http.MethodPost,
+		ReqBody:          "ping",
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+	assert.Equal(t, http.MethodGet, gotMethod)
+	assert.Equal(t, http.MethodPost, response.RedirectChain[0].Method)
+
+	hm.PreserveMethodOnRedirect = true
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+	assert.Equal(t, http.MethodPost, gotMethod)
+	assert.Equal(t, "ping", gotBody)
+}
+
+func TestRedirectChain_Scan_LegacyURLs(t *testing.T) {
+	var chain RedirectChain
+	err := chain.Scan([]byte(`["https://example.com", "https://www.example.com"]`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, RedirectChain{{URL: "https://example.com"}, {URL: "https://www.example.com"}}, chain)
+}
+
+func TestHttpMonitor_Monitor_RedirectNotFollowed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusMovedPermanently)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{301},
+		ReqTimeout:       5 * time.Second,
+		FollowRedirects:  lo.ToPtr(false),
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+	assert.Empty(t, response.(*HttpResponse).RedirectChain)
+}
+
 func TestHttpMonitor_Monitor_Failure_Timeout(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(6 * time.Second)
@@ -132,24 +417,259 @@ func TestHttpMonitor_Monitor_Failure_Timeout(t *testing.T) {
 	assert.NotNil(t, response)
 	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
 	assert.Contains(t, response.GetBaseMonitorResponse().ErrorMsg, "context deadline exceeded")
+	assert.Equal(t, ReasonTimeout, response.GetBaseMonitorResponse().Reason)
 }
 
-func TestHttpMonitor_checkSSL_Valid(t *testing.T) {
+func TestHttpMonitor_Monitor_Failure_ConnRefused(t *testing.T) {
+	hm := &HttpMonitor{
+		Address:          "http://" + closedAddress(t),
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       2 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, ReasonConnRefused, response.GetBaseMonitorResponse().Reason)
+}
+
+func TestHttpMonitor_Monitor_Failure_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       2 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, ReasonTLS, response.GetBaseMonitorResponse().Reason)
+}
+
+func TestClassifyError_DNS(t *testing.T) {
+	err := &url.Error{Op: "Get", URL: "http://nowhere.invalid", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true},
+	}}
+
+	assert.Equal(t, ReasonDNS, classifyError(err))
+}
+
+// rootsOf returns the roots trusting the certificate of server.
+func rootsOf(server *httptest.Server) *x509.CertPool {
+	return server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+}
+
+func TestHttpMonitor_Monitor_SSLAfterRedirect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	upgrade := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusMovedPermanently))
+	defer upgrade.Close()
+
+	hm := &HttpMonitor{
+		Address:        upgrade.URL,
+		RequestMethod:  http.MethodGet,
+		ReqTimeout:     2 * time.Second,
+		ShouldCheckSSL: true,
+		trustedRoots:   rootsOf(target),
+	}
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+	assert.True(t, response.SslResp.Valid)
+	assert.Equal(t, target.Certificate().NotAfter, response.SslResp.Expiry)
+	assert.Equal(t, hm.LastCertFingerprint, response.SslResp.Fingerprint)
+}
+
+func TestHttpMonitor_CheckSSL_Valid(t *testing.T) {
 	hm := &HttpMonitor{
 		Address: "https://google.com",
 	}
 
-	sslDetails := hm.checkSSL()
+	sslDetails := hm.CheckSSL(context.Background())
 	assert.True(t, sslDetails.Valid)
 	assert.True(t, sslDetails.Expiry.After(time.Now()))
 }
 
-func TestHttpMonitor_checkSSL_Invalid(t *testing.T) {
+// newHungTLSServer returns the address of a listener accepting connections
+// and never answering the TLS handshake.
+func newHungTLSServer(t *testing.T) string {
+	listener := lo.Must(net.Listen("tcp", "127.0.0.1:0"))
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestHttpMonitor_CheckSSL_HungHandshake(t *testing.T) {
+	hm := &HttpMonitor{Address: "https://" + newHungTLSServer(t), ReqTimeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	sslDetails := hm.CheckSSL(context.Background())
+	assert.False(t, sslDetails.Valid)
+	assert.NotEmpty(t, sslDetails.Error)
+	assert.Less(t, time.Since(start), 2*time.Second, "the handshake should be bounded by ReqTimeout")
+
+	// Cancelling ctx stops it sooner
+	hm.ReqTimeout = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	sslDetails = hm.CheckSSL(ctx)
+	assert.False(t, sslDetails.Valid)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestHttpMonitor_CheckSSL_VerifiesChain(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+
+	hm := &HttpMonitor{Address: target.URL, trustedRoots: rootsOf(target)}
+
+	sslDetails := hm.CheckSSL(context.Background())
+	assert.True(t, sslDetails.Valid)
+	assert.Empty(t, sslDetails.Error)
+	assert.Equal(t, target.Certificate().NotAfter, sslDetails.Expiry)
+
+	// The test certificate isn't issued for localhost
+	hm.Address = "https://localhost:" + targetURL.Port()
+	sslDetails = hm.CheckSSL(context.Background())
+	assert.False(t, sslDetails.Valid)
+	assert.Contains(t, sslDetails.Error, "localhost")
+	assert.Equal(t, target.Certificate().NotAfter, sslDetails.Expiry)
+
+	untrusted := &HttpMonitor{Address: target.URL}
+	sslDetails = untrusted.CheckSSL(context.Background())
+	assert.False(t, sslDetails.Valid)
+	assert.Contains(t, sslDetails.Error, "unknown authority")
+}
+
+// newTestCert issues a certificate for name, signed by parent or self-signed
+// when parent is nil.
+func newTestCert(t *testing.T, name string, isCA bool, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{name},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestCertificateDetails_EarliestExpiry(t *testing.T) {
+	now := time.Now()
+	root, rootKey := newTestCert(t, "root", true, now.Add(10*365*24*time.Hour), nil, nil)
+	intermediate, intermediateKey := newTestCert(t, "intermediate", true, now.Add(5*24*time.Hour), root, rootKey)
+	leaf, _ := newTestCert(t, "example.com", false, now.Add(90*24*time.Hour), intermediate, intermediateKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	chain, err := verifyChain([]*x509.Certificate{leaf, intermediate}, "example.com", roots)
+	assert.NoError(t, err)
+	assert.Len(t, chain, 3)
+	sslDetails := certificateDetails(chain)
+	assert.Equal(t, intermediate.NotAfter, sslDetails.Expiry)
+	assert.Equal(t, "CN=intermediate", sslDetails.Issuer)
+	assert.Equal(t, "CN=example.com", sslDetails.Subject)
+	assert.Equal(t, leaf.SerialNumber.Text(16), sslDetails.SerialNumber)
+
+	value, err := sslDetails.Value()
+	assert.NoError(t, err)
+	var scanned SSLDetails
+	assert.NoError(t, scanned.Scan(value))
+	assert.Equal(t, sslDetails.Subject, scanned.Subject)
+	assert.Equal(t, sslDetails.SerialNumber, scanned.SerialNumber)
+	assert.Equal(t, sslDetails.Issuer, scanned.Issuer)
+
+	_, err = verifyChain([]*x509.Certificate{leaf, intermediate}, "example.org", roots)
+	assert.Error(t, err)
+}
+
+func TestHttpMonitor_Monitor_ClientCert(t *testing.T) {
+	ca, caKey := newTestCert(t, "client ca", true, time.Now().Add(time.Hour), nil, nil)
+	cert, key := newTestCert(t, "client", false, time.Now().Add(time.Hour), ca, caKey)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	var subject atomic.Value
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject.Store(r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		BaseMonitor:    BaseMonitor{Interval: time.Minute},
+		Address:        ts.URL,
+		RequestMethod:  http.MethodGet,
+		ReqTimeout:     2 * time.Second,
+		ShouldCheckSSL: true,
+		ClientCertPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+		ClientKeyPEM:   Secret(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+	hm.transport().TLSClientConfig.RootCAs = ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+	assert.Equal(t, "client", subject.Load())
+	assert.True(t, response.SslResp.Valid, response.SslResp.Error)
+
+	hm.ClientKeyPEM = "not a key"
+	assert.ErrorContains(t, hm.BeforeSave(&gorm.DB{}), "invalid client certificate")
+	hm.ClientKeyPEM = ""
+	assert.EqualError(t, hm.BeforeSave(&gorm.DB{}), "client certificate and key must be set together")
+}
+
+func TestHttpMonitor_CheckSSL_Invalid(t *testing.T) {
 	hm := &HttpMonitor{
 		Address: "https://invalid-url",
 	}
 
-	sslDetails := hm.checkSSL()
+	sslDetails := hm.CheckSSL(context.Background())
 	assert.False(t, sslDetails.Valid)
 }
 
@@ -174,3 +694,1040 @@ func TestHttpMonitor_AfterFind_TimeoutValidation(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, maxHttpClientTimeout, hm.ReqTimeout)
 }
+
+func TestHttpMonitor_trackCertificate(t *testing.T) {
+	hm := &HttpMonitor{AllowedCertFingerprints: []string{"rotated"}}
+
+	// The first certificate seen is the baseline
+	assert.Empty(t, hm.trackCertificate(SSLDetails{Fingerprint: "original"}))
+	assert.Empty(t, hm.trackCertificate(SSLDetails{Fingerprint: "original"}))
+
+	change := hm.trackCertificate(SSLDetails{Fingerprint: "unexpected", Issuer: "CN=Evil CA"})
+	assert.Equal(t, "certificate changed from original to unexpected (issuer: CN=Evil CA)", change)
+	assert.Equal(t, "unexpected", hm.LastCertFingerprint)
+
+	// Whitelisted rotations don't warn
+	assert.Empty(t, hm.trackCertificate(SSLDetails{Fingerprint: "rotated"}))
+	assert.Equal(t, "rotated", hm.RuntimeState()["last_cert_fingerprint"])
+}
+
+func TestHttpMonitor_Monitor_ValidatorCommand(t *testing.T) {
+	grep, err := exec.LookPath("grep")
+	if err != nil {
+		t.Skip("grep not available")
+	}
+	SetAllowedValidatorCommands([]string{grep})
+	defer SetAllowedValidatorCommands(nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("status: degraded"))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+		ValidatorCommand: grep,
+		ValidatorArgs:    []string{"-q", "degraded"},
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+
+	hm.ValidatorArgs = []string{"-q", "healthy"}
+	response = hm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, ReasonValidatorFailed, response.GetBaseMonitorResponse().Reason)
+	assert.Equal(t, "validator exited with code 1", response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestHttpMonitor_BeforeSave_ValidatorNotAllowed(t *testing.T) {
+	hm := &HttpMonitor{ValidatorCommand: "/bin/rm"}
+
+	err := hm.BeforeSave(&gorm.DB{})
+	assert.EqualError(t, err, `validator command "/bin/rm" is not allowed`)
+}
+
+func TestHttpMonitor_Monitor_FormUrlEncoded(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" || r.PostFormValue("user") != "shraga" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodPost,
+		ValidStatusCodes: []int{200},
+		FormFields:       map[string]string{"user": "shraga"},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+}
+
+func TestHttpMonitor_Monitor_FormMultipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil || r.FormValue("user") != "shraga" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("upload")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		if header.Filename != "report.txt" || string(content) != "hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodPost,
+		ValidStatusCodes: []int{200},
+		FormFields:       map[string]string{"user": "shraga"},
+		FormFiles:        []FormFile{{Field: "upload", FileName: "report.txt", Content: "hello"}},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+}
+
+func TestHttpMonitor_BeforeSave_FormWithBody(t *testing.T) {
+	hm := &HttpMonitor{
+		ReqBody:    "raw",
+		FormFields: map[string]string{"user": "shraga"},
+	}
+
+	err := hm.BeforeSave(&gorm.DB{})
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
+
+func TestHttpMonitor_Monitor_ExpectEmptyBody(t *testing.T) {
+	body := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ExpectEmptyBody:  true,
+		ReqTimeout:       5 * time.Second,
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+
+	body = "unexpected"
+	response = hm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, "expected an empty body, got: unexpected", response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestHttpMonitor_Monitor_BodyReadTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Trickle the body slower than the monitor allows
+		select {
+		case <-time.After(3 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("late"))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:             ts.URL,
+		RequestMethod:       http.MethodGet,
+		ValidStatusCodes:    []int{200},
+		ShouldCheckResponse: true,
+		ExpectedResponse:    "late",
+		ReqTimeout:          10 * time.Second,
+		BodyReadTimeout:     100 * time.Millisecond,
+	}
+
+	response := hm.Monitor(context.Background())
+
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, ReasonBodyTimeout, response.GetBaseMonitorResponse().Reason)
+	assert.Equal(t, "body read timed out after 100ms", response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestHttpMonitor_transport(t *testing.T) {
+	SetTransportLimits(TransportLimits{MaxIdleConns: 10, MaxIdleConnsPerHost: 1, MaxConnsPerHost: 4})
+	t.Cleanup(func() { SetTransportLimits(TransportLimits{MaxIdleConns: 100, MaxIdleConnsPerHost: 2}) })
+
+	shared := (&HttpMonitor{}).transport()
+	assert.Same(t, shared, (&HttpMonitor{}).transport())
+	assert.Equal(t, 10, shared.MaxIdleConns)
+	assert.Equal(t, 1, shared.MaxIdleConnsPerHost)
+	assert.Equal(t, 4, shared.MaxConnsPerHost)
+
+	limited := (&HttpMonitor{MaxConnsPerHost: 1}).transport()
+	assert.NotSame(t, shared, limited)
+	assert.Equal(t, 1, limited.MaxConnsPerHost)
+}
+
+func TestHttpMonitor_Monitor_ReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ResultUp, hm.Monitor(context.Background()).GetBaseMonitorResponse().Result)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestHttpMonitor_Monitor_ReusesConnectionsOnInvalidStatus(t *testing.T) {
+	var conns atomic.Int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("internal error"))
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+	}
+
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, ResultDown, hm.Monitor(context.Background()).GetBaseMonitorResponse().Result)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestHttpMonitor_Monitor_LatencyBand(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+		LatencyMin:       10 * time.Millisecond,
+		LatencyMax:       time.Second,
+	}
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+
+	hm.LatencyMin = 500 * time.Millisecond
+	response = hm.Monitor(context.Background())
+	assert.Equal(t, ResultWarn, response.GetBaseMonitorResponse().Result)
+	assert.Contains(t, response.GetBaseMonitorResponse().ErrorMsg, "below the expected minimum 500ms")
+
+	hm.LatencyMin = 0
+	hm.LatencyMax = 10 * time.Millisecond
+	response = hm.Monitor(context.Background())
+	assert.Equal(t, ResultWarn, response.GetBaseMonitorResponse().Result)
+	assert.Contains(t, response.GetBaseMonitorResponse().ErrorMsg, "above the expected maximum 10ms")
+}
+
+func TestHttpMonitor_BeforeSave_LatencyBand(t *testing.T) {
+	hm := &HttpMonitor{LatencyMin: time.Second, LatencyMax: 2 * time.Second}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, int64(time.Second), hm.LatencyMinInt)
+	assert.Equal(t, int64(2*time.Second), hm.LatencyMaxInt)
+
+	hm.LatencyMin = 3 * time.Second
+	assert.ErrorContains(t, hm.BeforeSave(&gorm.DB{}), "above latency max")
+}
+
+func TestHttpMonitor_BeforeSave_EmptyExpectation(t *testing.T) {
+	hm := &HttpMonitor{ShouldCheckResponse: true}
+	assert.ErrorContains(t, hm.BeforeSave(&gorm.DB{}), "requires an expected response or JSONPath assertions")
+
+	hm.JsonPathAssertions = []JsonPathAssertion{{Path: "$.status", Expected: "ok"}}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+
+	hm = &HttpMonitor{ShouldCheckResponse: true, ExpectedResponse: "OK"}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+}
+
+func TestHttpMonitor_trackBodySize(t *testing.T) {
+	hm := &HttpMonitor{BodySizeDeviation: 0.5}
+
+	assert.Empty(t, hm.trackBodySize(50000))
+	assert.Equal(t, 50000.0, hm.BodySizeBaseline)
+	assert.Empty(t, hm.trackBodySize(45000))
+	assert.Equal(t, 49000.0, hm.BodySizeBaseline)
+
+	assert.Equal(t, "body size 200 bytes deviates 100% from the baseline of 49000 bytes", hm.trackBodySize(200))
+	assert.Equal(t, 39240.0, hm.BodySizeBaseline)
+}
+
+func TestHttpMonitor_Monitor_BodySizeAnomaly(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:           ts.URL,
+		RequestMethod:     http.MethodGet,
+		ValidStatusCodes:  []int{200},
+		ReqTimeout:        5 * time.Second,
+		BodySizeDeviation: 0.5,
+	}
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+	assert.Equal(t, int64(1000), response.BodySize)
+
+	body = ""
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultWarn, response.Result)
+	assert.Equal(t, int64(0), response.BodySize)
+	assert.Contains(t, response.ErrorMsg, "deviates 100%")
+}
+
+func TestHttpMonitor_statusCodeValid(t *testing.T) {
+	hm := &HttpMonitor{}
+	assert.True(t, hm.statusCodeValid(200))
+	assert.True(t, hm.statusCodeValid(204))
+	assert.False(t, hm.statusCodeValid(301))
+	assert.False(t, hm.statusCodeValid(500))
+
+	hm.ValidStatusCodes = []int{301}
+	assert.False(t, hm.statusCodeValid(200))
+	assert.True(t, hm.statusCodeValid(301))
+
+	hm.ValidStatusRanges = [][2]int{{400, 404}}
+	assert.True(t, hm.statusCodeValid(301))
+	assert.True(t, hm.statusCodeValid(400))
+	assert.True(t, hm.statusCodeValid(404))
+	assert.False(t, hm.statusCodeValid(405))
+	assert.False(t, hm.statusCodeValid(200))
+}
+
+func TestHttpMonitor_BeforeSave_ValidStatusRanges(t *testing.T) {
+	hm := &HttpMonitor{Address: "http://localhost", RequestMethod: http.MethodGet, ValidStatusRanges: [][2]int{{200, 299}, {404, 404}}}
+	assert.NoError(t, hm.BeforeSave(nil))
+	assert.Equal(t, "[[200,299],[404,404]]", hm.ValidStatusRangesJSON)
+
+	found := &HttpMonitor{ValidStatusRangesJSON: hm.ValidStatusRangesJSON}
+	assert.NoError(t, found.AfterFind(nil))
+	assert.Equal(t, hm.ValidStatusRanges, found.ValidStatusRanges)
+
+	hm.ValidStatusRanges = [][2]int{{299, 200}}
+	assert.EqualError(t, hm.BeforeSave(nil), "invalid status code range 299-200")
+}
+
+func TestHttpMonitor_Monitor_ExpectedTrailers(t *testing.T) {
+	status := "0"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data"))
+		w.Header().Set("Grpc-Status", status)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:          ts.URL,
+		RequestMethod:    http.MethodGet,
+		ValidStatusCodes: []int{200},
+		ReqTimeout:       5 * time.Second,
+		ExpectedTrailers: map[string]string{"grpc-status": "0"},
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result)
+
+	status = "13"
+	response = hm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Equal(t, `trailer grpc-status: got "13", expected "0"`, response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestHttpMonitor_Monitor_Charset(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=ISO-8859-1")
+		// "café" in Latin-1
+		w.Write([]byte{'c', 'a', 'f', 0xe9})
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:             ts.URL,
+		RequestMethod:       http.MethodGet,
+		ValidStatusCodes:    []int{200},
+		ReqTimeout:          5 * time.Second,
+		ShouldCheckResponse: true,
+		ExpectedResponse:    "café",
+	}
+
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result, response.GetBaseMonitorResponse().ErrorMsg)
+}
+
+func TestDecodeBody(t *testing.T) {
+	assert.Equal(t, []byte("café"), decodeBody([]byte{'c', 'a', 'f', 0xe9}, "text/html; charset=windows-1252"))
+	assert.Equal(t, []byte("café"), decodeBody([]byte("café"), "text/html; charset=utf-8"))
+	assert.Equal(t, []byte("café"), decodeBody([]byte("café"), "text/html"))
+	// Unknown charsets are compared as is
+	assert.Equal(t, []byte{0xe9}, decodeBody([]byte{0xe9}, "text/html; charset=x-unknown"))
+}
+
+func TestHttpMonitor_Monitor_FailedChecks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "down"}`))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:             ts.URL,
+		RequestMethod:       http.MethodGet,
+		ValidStatusCodes:    []int{200},
+		ReqTimeout:          5 * time.Second,
+		ShouldCheckResponse: true,
+		ExpectedResponse:    `{"status": "up"}`,
+		JsonPathAssertions:  []JsonPathAssertion{{Path: "$.status", Expected: "up"}},
+		LatencyMin:          time.Hour,
+	}
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, FailedChecks{CheckStatus, CheckResponse, CheckJsonPath, CheckLatency}, response.FailedChecks)
+	assert.Equal(t, "unexpected status code: 500", response.ErrorMsg)
+}
+
+func TestHttpMonitor_Monitor_ExpectedFormat(t *testing.T) {
+	xmlBroken := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Accept") == "application/xml" && xmlBroken:
+			w.Write([]byte(`{"status": "up"}`))
+		case r.Header.Get("Accept") == "application/xml":
+			w.Write([]byte(`<status>up</status>`))
+		default:
+			w.Write([]byte(`{"status": "up"}`))
+		}
+	}))
+	defer ts.Close()
+
+	for _, format := range []string{"json", "xml"} {
+		hm := &HttpMonitor{
+			Address:        ts.URL,
+			RequestMethod:  http.MethodGet,
+			ReqTimeout:     5 * time.Second,
+			ExpectedFormat: format,
+		}
+		response := hm.Monitor(context.Background())
+		assert.Equal(t, ResultUp, response.GetBaseMonitorResponse().Result, format)
+	}
+
+	xmlBroken = true
+	hm := &HttpMonitor{
+		Address:        ts.URL,
+		RequestMethod:  http.MethodGet,
+		ReqTimeout:     5 * time.Second,
+		ExpectedFormat: "xml",
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, FailedChecks{CheckFormat}, response.FailedChecks)
+}
+
+func TestHttpMonitor_checkFormat(t *testing.T) {
+	hm := &HttpMonitor{ExpectedFormat: "xml"}
+	assert.NoError(t, hm.checkFormat([]byte(`<?xml version="1.0"?><a><b/></a>`)))
+	assert.Error(t, hm.checkFormat([]byte(`<a><b></a>`)))
+	assert.Error(t, hm.checkFormat([]byte(`plain text`)))
+
+	hm.ExpectedFormat = "json"
+	assert.NoError(t, hm.checkFormat([]byte(`[1, 2]`)))
+	assert.Error(t, hm.checkFormat([]byte(`<a/>`)))
+
+	hm.ExpectedFormat = "yaml"
+	assert.Error(t, hm.validateExpectedFormat())
+}
+
+func TestHttpMonitor_Monitor_ReferenceURL(t *testing.T) {
+	body := "a\nb\nc\nd"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reference" {
+			w.Write([]byte("a\nb\nc\nd"))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:            ts.URL,
+		RequestMethod:      http.MethodGet,
+		ReqTimeout:         5 * time.Second,
+		ReferenceURL:       ts.URL + "/reference",
+		ReferenceTolerance: 0.3,
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+
+	// One line of four differs, within the tolerance
+	body = "a\nb\nc\nstale"
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+
+	body = "a\nstale\nstale\nstale"
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultWarn, response.Result)
+	assert.Equal(t, FailedChecks{CheckReference}, response.FailedChecks)
+	assert.Equal(t, "body differs from "+ts.URL+"/reference by 75% of lines", response.ErrorMsg)
+
+	hm.ReferenceMismatchDown = true
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+
+	// An unavailable reference only warns
+	hm.ReferenceURL = ts.URL + "/missing"
+	body = "a\nb\nc\nd"
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	})
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultWarn, response.Result)
+	assert.Equal(t, "failed to fetch reference: reference responded 404", response.ErrorMsg)
+}
+
+func TestBodyDifference(t *testing.T) {
+	assert.Equal(t, 0.0, bodyDifference([]byte("a\nb"), []byte("a\nb")))
+	assert.Equal(t, 0.0, bodyDifference([]byte("a\nb"), []byte("b\na")))
+	assert.Equal(t, 1.0, bodyDifference([]byte("a\nb"), []byte("c\nd")))
+	assert.Equal(t, 0.5, bodyDifference([]byte("a\nb"), []byte("a\nc")))
+}
+
+func TestHttpMonitor_Monitor_Preflight(t *testing.T) {
+	allowOrigin := "https://app.example.com"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			assert.Equal(t, "POST", r.Header.Get("Access-Control-Request-Method"))
+			assert.Equal(t, "x-api-key", r.Header.Get("Access-Control-Request-Headers"))
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:             ts.URL,
+		RequestMethod:       http.MethodPost,
+		ReqHeaders:          map[string]string{"X-Api-Key": "secret"},
+		ReqTimeout:          5 * time.Second,
+		PreflightCheck:      true,
+		PreflightOrigin:     "https://app.example.com",
+		ExpectedCORSHeaders: map[string]string{"Access-Control-Max-Age": ""},
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+
+	hm.ExpectedCORSHeaders["Access-Control-Allow-Credentials"] = "true"
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, FailedChecks{CheckPreflight}, response.FailedChecks)
+	assert.Equal(t, "preflight is missing header Access-Control-Allow-Credentials", response.ErrorMsg)
+
+	delete(hm.ExpectedCORSHeaders, "Access-Control-Allow-Credentials")
+	allowOrigin = "https://other.example.com"
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Contains(t, response.ErrorMsg, "preflight doesn't allow origin https://app.example.com")
+
+	hm.PreflightOrigin = ""
+	assert.Error(t, hm.BeforeSave(&gorm.DB{}))
+}
+
+func TestHttpMonitor_Monitor_BodyHash(t *testing.T) {
+	body := "v1"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:       ts.URL,
+		RequestMethod: http.MethodGet,
+		ReqTimeout:    5 * time.Second,
+		TrackBodyHash: true,
+	}
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+	assert.Equal(t, response.BodyHash, hm.LastBodyHash)
+	firstHash := response.BodyHash
+
+	body = "v2"
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultWarn, response.Result)
+	assert.Equal(t, ReasonBodyChanged, response.Reason)
+	assert.Equal(t, "body changed from "+firstHash+" to "+response.BodyHash, response.ErrorMsg)
+
+	// Unchanged since the previous check
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+
+	// A known release doesn't warn
+	body = "v3"
+	hash := sha256.Sum256([]byte(body))
+	hm.ExpectedBodyHashes = []string{hex.EncodeToString(hash[:])}
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+}
+
+func TestHttpMonitor_BeforeSave_ResultExpression(t *testing.T) {
+	hm := &HttpMonitor{ResultExpression: `status == 200 && body.contains("ok")`}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+
+	hm.ResultExpression = `status ==`
+	assert.ErrorContains(t, hm.BeforeSave(&gorm.DB{}), "invalid result expression")
+
+	hm.ResultExpression = `status`
+	assert.ErrorContains(t, hm.BeforeSave(&gorm.DB{}), "must evaluate to a bool or a string, got int")
+}
+
+func TestHttpMonitor_Monitor_ResultExpression(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "2")
+		w.Write([]byte(`{"status": "degraded"}`))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		expression string
+		result     Result
+		errorMsg   string
+	}{
+		{`status == 200 && headers["X-Version"] == "2"`, ResultUp, ""},
+		{`body.contains("degraded") ? "warn" : "up"`, ResultWarn, "result expression evaluated to warn"},
+		{`latency > duration("1h")`, ResultDown, "result expression evaluated to down"},
+		{`"maybe"`, ResultDown, `result expression evaluated to "maybe", must be up, warn or down`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			hm := &HttpMonitor{
+				Address:          ts.URL,
+				RequestMethod:    http.MethodGet,
+				ReqTimeout:       5 * time.Second,
+				ResultExpression: tt.expression,
+			}
+
+			response := hm.Monitor(context.Background()).(*HttpResponse)
+			assert.Equal(t, tt.result, response.Result)
+			assert.Equal(t, tt.errorMsg, response.ErrorMsg)
+		})
+	}
+}
+
+func TestHttpMonitor_Monitor_WarmupRequest(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		if requests.Add(1) == 1 {
+			// Cold start
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:       ts.URL,
+		RequestMethod: http.MethodGet,
+		ReqHeaders:    map[string]string{"X-Api-Key": "secret"},
+		ReqTimeout:    5 * time.Second,
+		WarmupRequest: true,
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Less(t, response.Latency, int64(200))
+}
+
+func TestHttpMonitor_Monitor_WarmupRequestFailed(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Drop the warmup's connection
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:       ts.URL,
+		RequestMethod: http.MethodGet,
+		ReqTimeout:    5 * time.Second,
+		WarmupRequest: true,
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+
+	ts.Close()
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Contains(t, response.ErrorMsg, "warmup request also failed")
+}
+
+func TestHttpMonitor_sslExpiryWarning(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	hm := &HttpMonitor{BaseMonitor: BaseMonitor{Clock: func() time.Time { return now }}}
+
+	assert.Empty(t, hm.sslExpiryWarning(now.Add(40*24*time.Hour)))
+	assert.Equal(t, "certificate expires in 72h0m0s (at 2020-01-04T12:00:00Z)", hm.sslExpiryWarning(now.Add(72*time.Hour)))
+	assert.Equal(t, "certificate expired at 2019-12-31T12:00:00Z", hm.sslExpiryWarning(now.Add(-24*time.Hour)))
+	// No certificate was checked, e.g. as the connection failed
+	assert.Empty(t, hm.sslExpiryWarning(time.Time{}))
+}
+
+func TestHttpMonitor_trackSSLExpiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	hm := &HttpMonitor{BaseMonitor: BaseMonitor{Clock: func() time.Time { return now }}}
+
+	assert.Equal(t, 0, hm.trackSSLExpiry(now.Add(40*24*time.Hour)))
+	assert.Equal(t, 30, hm.trackSSLExpiry(now.Add(29*24*time.Hour)))
+	assert.Equal(t, 0, hm.trackSSLExpiry(now.Add(28*24*time.Hour)), "threshold already notified")
+	assert.Equal(t, 14, hm.trackSSLExpiry(now.Add(13*24*time.Hour)))
+	// Crossing several thresholds at once notifies the latest
+	assert.Equal(t, 1, hm.trackSSLExpiry(now.Add(12*time.Hour)))
+	assert.Equal(t, 0, hm.trackSSLExpiry(now.Add(time.Hour)))
+	assert.Equal(t, 1, hm.SSLExpiryNotified)
+
+	// A renewed certificate starts over
+	assert.Equal(t, 0, hm.trackSSLExpiry(now.Add(90*24*time.Hour)))
+	assert.Equal(t, 0, hm.SSLExpiryNotified)
+
+	hm.SSLExpiryThresholds = []int{3, 10}
+	assert.Equal(t, 10, hm.trackSSLExpiry(now.Add(5*24*time.Hour)))
+	assert.Equal(t, 3, hm.trackSSLExpiry(now.Add(2*24*time.Hour)))
+
+	hm.Address = "https://example.com"
+	hm.RequestMethod = http.MethodGet
+	hm.ReqTimeout = 5 * time.Second
+	hm.Interval = time.Minute
+	hm.SSLExpiryThresholds = []int{0}
+	assert.EqualError(t, hm.BeforeSave(&gorm.DB{}), "SSL expiry thresholds must be positive days")
+}
+
+func TestHttpMonitor_sslWarnThreshold(t *testing.T) {
+	hm := &HttpMonitor{}
+	assert.Equal(t, 30*24*time.Hour, hm.sslWarnThreshold())
+
+	hm.SSLExpiryThresholds = []int{7, 60}
+	assert.Equal(t, 60*24*time.Hour, hm.sslWarnThreshold())
+
+	hm.SslWarnThreshold = 7 * 24 * time.Hour
+	assert.Equal(t, 7*24*time.Hour, hm.sslWarnThreshold())
+
+	hm.Address = "https://example.com"
+	hm.RequestMethod = http.MethodGet
+	hm.Interval = time.Minute
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, int64(7*24*time.Hour), hm.SslWarnThresholdInt)
+
+	found := &HttpMonitor{SslWarnThresholdInt: hm.SslWarnThresholdInt}
+	assert.NoError(t, found.AfterFind(&gorm.DB{}))
+	assert.Equal(t, 7*24*time.Hour, found.SslWarnThreshold)
+
+	hm.SslWarnThreshold = -time.Hour
+	assert.EqualError(t, hm.BeforeSave(&gorm.DB{}), "SSL warn threshold must not be negative")
+}
+
+func TestHttpMonitor_checkDowngrade(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "credentials must not be sent in plaintext")
+		assert.Empty(t, r.Header.Get("X-Api-Key"), "credentials must not be sent in plaintext")
+		assert.Equal(t, "text/html", r.Header.Get("Accept"))
+		switch r.URL.Path {
+		case "/upgrade":
+			http.Redirect(w, r, "/upgrade/", http.StatusFound)
+		case "/upgrade/":
+			http.Redirect(w, r, "https://example.com/", http.StatusMovedPermanently)
+		default:
+			w.Write([]byte("plaintext"))
+		}
+	}))
+	defer ts.Close()
+	port := ts.Listener.Addr().(*net.TCPAddr).Port
+	headers := map[string]string{"Authorization": "Bearer secret", "X-Api-Key": "secret", "Accept": "text/html"}
+
+	tests := []struct {
+		path     string
+		behavior string
+		errorMsg string
+	}{
+		{"/upgrade", DowngradeRedirect, ""},
+		{"/", DowngradePlaintext, ts.URL + "/ served plaintext content with status 200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// The TLS port of the address isn't probed
+			hm := &HttpMonitor{Address: "https://127.0.0.1:8443" + tt.path, ReqHeaders: headers, DowngradeCheck: true, DowngradePort: port}
+			behavior, msg := hm.checkDowngrade(context.Background())
+			assert.Equal(t, tt.behavior, behavior)
+			assert.Equal(t, tt.errorMsg, msg)
+		})
+	}
+
+	ts.Close()
+	hm := &HttpMonitor{Address: "https://127.0.0.1", DowngradeCheck: true, DowngradePort: port}
+	behavior, msg := hm.checkDowngrade(context.Background())
+	assert.Equal(t, DowngradeRefused, behavior)
+	assert.Empty(t, msg)
+
+	hm.Address = "http://127.0.0.1"
+	assert.EqualError(t, hm.validateDowngradeCheck(), "downgrade check requires an https address")
+	hm.Address, hm.DowngradePort = "https://127.0.0.1", 70000
+	assert.EqualError(t, hm.validateDowngradeCheck(), "invalid downgrade port 70000")
+}
+
+func TestHttpMonitor_Monitor_RateLimited(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("slow down"))
+	}))
+	defer ts.Close()
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	hm := &HttpMonitor{
+		BaseMonitor:         BaseMonitor{Clock: func() time.Time { return now }},
+		Address:             ts.URL,
+		RequestMethod:       http.MethodGet,
+		ReqTimeout:          5 * time.Second,
+		ShouldCheckResponse: true,
+		ExpectedResponse:    "ok",
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, ReasonRateLimited, response.Reason)
+	assert.Equal(t, "rate limited: 429 Too Many Requests, retry after 2m0s", response.ErrorMsg)
+	assert.Equal(t, FailedChecks{CheckStatus}, response.FailedChecks, "the body isn't checked")
+	assert.True(t, hm.DeferUntil.IsZero())
+
+	hm.RateLimitWarn = true
+	hm.HonorRetryAfter = true
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultWarn, response.Result)
+	assert.Equal(t, now.Add(2*time.Minute), hm.DeferUntil)
+
+	// Unless 429 is expected
+	hm.ValidStatusCodes = []int{http.StatusTooManyRequests}
+	hm.ShouldCheckResponse = false
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"Wed, 01 Jan 2020 12:05:00 GMT", 5 * time.Minute, true},
+		{"Wed, 01 Jan 2020 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		delay, ok := parseRetryAfter(tt.value, now)
+		assert.Equal(t, tt.delay, delay, tt.value)
+		assert.Equal(t, tt.ok, ok, tt.value)
+	}
+}
+
+func TestHttpMonitor_Monitor_ForceHTTPVersion(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	legacy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer legacy.Close()
+
+	tests := []struct {
+		version  string
+		server   *httptest.Server
+		result   Result
+		protocol string
+	}{
+		{"", ts, ResultUp, "HTTP/2.0"},
+		{HTTPVersion1, ts, ResultUp, "HTTP/1.1"},
+		{HTTPVersion2, ts, ResultUp, "HTTP/2.0"},
+		{HTTPVersion2, legacy, ResultDown, "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		hm := &HttpMonitor{
+			Address:          tt.server.URL,
+			RequestMethod:    http.MethodGet,
+			ReqTimeout:       2 * time.Second,
+			ForceHTTPVersion: tt.version,
+			trustedRoots:     rootsOf(tt.server),
+		}
+
+		response := hm.Monitor(context.Background()).(*HttpResponse)
+		assert.Equal(t, tt.result, response.Result, tt.version)
+		assert.Equal(t, tt.protocol, response.Protocol, tt.version)
+		if tt.result == ResultDown {
+			assert.Equal(t, FailedChecks{CheckHTTPVersion}, response.FailedChecks)
+			assert.Equal(t, "negotiated HTTP/1.1 instead of the forced HTTP/2", response.ErrorMsg)
+		}
+	}
+}
+
+func TestHttpMonitor_validateForceHTTPVersion(t *testing.T) {
+	hm := &HttpMonitor{Address: "http://example.com", ForceHTTPVersion: HTTPVersion1}
+	assert.NoError(t, hm.validateForceHTTPVersion())
+
+	hm.ForceHTTPVersion = HTTPVersion3
+	assert.EqualError(t, hm.validateForceHTTPVersion(), "forcing HTTP/3 requires an https address")
+
+	hm.Address = "https://example.com"
+	assert.NoError(t, hm.validateForceHTTPVersion())
+
+	hm.ForceHTTPVersion = "2.0"
+	assert.EqualError(t, hm.validateForceHTTPVersion(), `invalid HTTP version "2.0", must be 1.1, 2 or 3`)
+}
+
+func TestHttpMonitor_Monitor_ForceHTTP3(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http3.Server{
+		Handler:   ts.Config.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(ts.TLS),
+	}
+	go server.Serve(conn)
+	defer server.Close()
+
+	hm := &HttpMonitor{
+		Address:          "https://" + conn.LocalAddr().String(),
+		RequestMethod:    http.MethodGet,
+		ReqTimeout:       2 * time.Second,
+		ForceHTTPVersion: HTTPVersion3,
+		trustedRoots:     rootsOf(ts),
+	}
+
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+	assert.Equal(t, "HTTP/3.0", response.Protocol)
+
+	// A server without HTTP/3 fails the check
+	hm.Address = ts.URL
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+}
+
+func TestHttpMonitor_Monitor_BasicAuth(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if user, password, ok := r.BasicAuth(); !ok || user != "shraga" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hm := &HttpMonitor{
+		Address:           ts.URL,
+		RequestMethod:     http.MethodGet,
+		ReqTimeout:        5 * time.Second,
+		BasicAuthUsername: "shraga",
+		BasicAuthPassword: "s3cret",
+	}
+	response := hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultUp, response.Result)
+
+	// The password doesn't leak into JSON or logs
+	data, err := json.Marshal(hm)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, Redacted, fields["BasicAuthPassword"])
+	assert.NotContains(t, fmt.Sprintf("%+v", hm), "s3cret")
+
+	// An explicit Authorization header wins
+	hm.ReqHeaders = map[string]string{"Authorization": "Bearer token"}
+	response = hm.Monitor(context.Background()).(*HttpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, "Bearer token", authorization)
+
+	// Both credentials are required
+	hm.ReqHeaders = nil
+	hm.BasicAuthPassword = ""
+	hm.Monitor(context.Background())
+	assert.Empty(t, authorization)
+}
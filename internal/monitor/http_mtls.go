@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// validateClientCert rejects a client certificate and key that don't form a
+// valid PEM pair. Both or neither must be set.
+func (hm *HttpMonitor) validateClientCert() error {
+	if hm.ClientCertPEM == "" && hm.ClientKeyPEM == "" {
+		return nil
+	}
+	if hm.ClientCertPEM == "" || hm.ClientKeyPEM == "" {
+		return errors.New("client certificate and key must be set together")
+	}
+	if _, err := tls.X509KeyPair([]byte(hm.ClientCertPEM), []byte(hm.ClientKeyPEM)); err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return nil
+}
+
+// clientTLSConfig returns the TLS config presenting the client certificate of
+// key, nil when it has none or it's invalid.
+func clientTLSConfig(key transportKey) *tls.Config {
+	if key.clientCertPEM == "" {
+		return nil
+	}
+	cert, err := tls.X509KeyPair([]byte(key.clientCertPEM), []byte(key.clientKeyPEM))
+	if err != nil {
+		return nil
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}
+}
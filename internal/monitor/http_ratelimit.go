@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter bounds how long a Retry-After defers the next check, so that
+// a misbehaving endpoint can't pause its monitor indefinitely
+const maxRetryAfter = time.Hour
+
+// rateLimited records a 429 response in result, as a warning when
+// RateLimitWarn is set, and defers the next check by its Retry-After when
+// HonorRetryAfter is set.
+func (hm *HttpMonitor) rateLimited(resp *http.Response, result *HttpResponse) {
+	msg := "rate limited: 429 Too Many Requests"
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), hm.Now())
+	if ok {
+		retryAfter = min(retryAfter, maxRetryAfter)
+		msg += fmt.Sprintf(", retry after %s", retryAfter)
+		if hm.HonorRetryAfter {
+			hm.DeferUntil = hm.Now().Add(retryAfter)
+		}
+	}
+
+	result.fail(CheckStatus, msg)
+	result.Reason = ReasonRateLimited
+	if hm.RateLimitWarn {
+		result.Result = ResultWarn
+	}
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given either in
+// seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,109 @@
+package monitor
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const defaultMaxRedirects = 10
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// RedirectHop is one redirect response received while following redirects.
+type RedirectHop struct {
+	URL        string // URL that answered with the redirect
+	Method     string // Method of the request that was redirected
+	StatusCode int
+	Location   string // Location header as sent by the server
+}
+
+// RedirectChain stores the redirects followed, starting with the monitored
+// address.
+type RedirectChain []RedirectHop
+
+// Valuer and Scanner implementation for RedirectChain
+func (rc RedirectChain) Value() (driver.Value, error) {
+	return json.Marshal(rc)
+}
+
+func (rc *RedirectChain) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal RedirectChain value: %v", value)
+	}
+
+	if err := json.Unmarshal(bytes, rc); err != nil {
+		// Chains were stored as plain URLs before hops were recorded
+		var urls []string
+		if json.Unmarshal(bytes, &urls) != nil {
+			return err
+		}
+		*rc = make(RedirectChain, 0, len(urls))
+		for _, url := range urls {
+			*rc = append(*rc, RedirectHop{URL: url})
+		}
+	}
+	return nil
+}
+
+// checkRedirect returns an http.Client CheckRedirect func that applies the
+// monitor's redirect policy and records each hop into result.
+func (hm *HttpMonitor) checkRedirect(result *HttpResponse) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !hm.followRedirects() {
+			return http.ErrUseLastResponse
+		}
+
+		previous := via[len(via)-1]
+		hop := RedirectHop{URL: previous.URL.String(), Method: previous.Method}
+		if req.Response != nil {
+			hop.StatusCode = req.Response.StatusCode
+			hop.Location = req.Response.Header.Get("Location")
+		}
+		result.RedirectChain = append(result.RedirectChain, hop)
+
+		if len(via) > hm.maxRedirects() {
+			return errTooManyRedirects
+		}
+
+		if hm.PreserveMethodOnRedirect && req.Method != via[0].Method {
+			return preserveMethod(req, via[0])
+		}
+		return nil
+	}
+}
+
+// preserveMethod makes the redirected req resend the method and body of the
+// original request, which the client switched to GET.
+func preserveMethod(req, original *http.Request) error {
+	req.Method = original.Method
+	if original.GetBody == nil {
+		return nil
+	}
+
+	body, err := original.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	req.GetBody = original.GetBody
+	req.ContentLength = original.ContentLength
+	if contentType := original.Header.Get("Content-Type"); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return nil
+}
+
+func (hm *HttpMonitor) maxRedirects() int {
+	if hm.MaxRedirects <= 0 {
+		return defaultMaxRedirects
+	}
+	return hm.MaxRedirects
+}
+
+func (hm *HttpMonitor) followRedirects() bool {
+	return hm.FollowRedirects == nil || *hm.FollowRedirects
+}
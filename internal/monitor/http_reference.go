@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// fetchReference returns the body of ReferenceURL, requested with the same
+// method and headers as the monitored endpoint.
+func (hm *HttpMonitor) fetchReference(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, hm.RequestMethod, hm.ReferenceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range hm.ReqHeaders {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Transport: hm.transport()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("reference responded %d", resp.StatusCode)
+	}
+	return hm.readBody(resp.Body, cancel)
+}
+
+// bodyDifference returns the fraction of lines of a and b without a
+// counterpart in the other, regardless of order: 0 for identical bodies and 1
+// for bodies sharing no line.
+func bodyDifference(a, b []byte) float64 {
+	if bytes.Equal(a, b) {
+		return 0
+	}
+
+	linesA := bytes.Split(a, []byte("\n"))
+	linesB := bytes.Split(b, []byte("\n"))
+	counts := make(map[string]int, len(linesA))
+	for _, line := range linesA {
+		counts[string(line)]++
+	}
+	matched := 0
+	for _, line := range linesB {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			matched++
+		}
+	}
+	return 1 - float64(2*matched)/float64(len(linesA)+len(linesB))
+}
+
+// checkReference compares body to the body of ReferenceURL, describing the
+// divergence when it exceeds ReferenceTolerance.
+func (hm *HttpMonitor) checkReference(ctx context.Context, body []byte) (string, error) {
+	reference, err := hm.fetchReference(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch reference: %w", err)
+	}
+
+	difference := bodyDifference(body, reference)
+	if difference <= hm.ReferenceTolerance {
+		return "", nil
+	}
+	return fmt.Sprintf("body differs from %s by %.0f%% of lines", hm.ReferenceURL, difference*100), nil
+}
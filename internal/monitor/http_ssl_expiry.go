@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Days before expiry to notify at when SSLExpiryThresholds is unset
+var defaultSSLExpiryThresholds = []int{30, 14, 7, 1}
+
+func validateSSLExpiryThresholds(thresholds []int) error {
+	for _, threshold := range thresholds {
+		if threshold <= 0 {
+			return errors.New("SSL expiry thresholds must be positive days")
+		}
+	}
+	return nil
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// sslExpiryThresholds returns the thresholds in days, earliest first.
+func (hm *HttpMonitor) sslExpiryThresholds() []int {
+	if len(hm.SSLExpiryThresholds) == 0 {
+		return defaultSSLExpiryThresholds
+	}
+	thresholds := slices.Clone(hm.SSLExpiryThresholds)
+	slices.Sort(thresholds)
+	slices.Reverse(thresholds)
+	return thresholds
+}
+
+// sslWarnThreshold returns how long before expiry a certificate is warned
+// about.
+func (hm *HttpMonitor) sslWarnThreshold() time.Duration {
+	if hm.SslWarnThreshold > 0 {
+		return hm.SslWarnThreshold
+	}
+	return days(hm.sslExpiryThresholds()[0])
+}
+
+// sslExpiryWarning returns the warning for a certificate expiring at expiry,
+// empty when it's outside sslWarnThreshold or its expiry is unknown.
+func (hm *HttpMonitor) sslExpiryWarning(expiry time.Time) string {
+	if expiry.IsZero() {
+		return ""
+	}
+	remaining := expiry.Sub(hm.Now())
+	if remaining >= hm.sslWarnThreshold() {
+		return ""
+	}
+	at := expiry.UTC().Format(time.RFC3339)
+	if remaining <= 0 {
+		return fmt.Sprintf("certificate expired at %s", at)
+	}
+	return fmt.Sprintf("certificate expires in %s (at %s)", remaining.Round(time.Minute), at)
+}
+
+// trackSSLExpiry returns the latest threshold crossed by a certificate
+// expiring at expiry, or zero when it was already notified. Only the latest
+// is returned when a check crosses several, and a renewed certificate starts
+// over.
+func (hm *HttpMonitor) trackSSLExpiry(expiry time.Time) int {
+	if expiry.IsZero() {
+		return 0
+	}
+
+	remaining := expiry.Sub(hm.Now())
+	crossed := 0
+	for _, threshold := range hm.sslExpiryThresholds() {
+		if remaining < days(threshold) {
+			crossed = threshold
+		}
+	}
+	if crossed == 0 {
+		hm.SSLExpiryNotified = 0
+		return 0
+	}
+	if hm.SSLExpiryNotified != 0 && crossed >= hm.SSLExpiryNotified {
+		return 0
+	}
+	hm.SSLExpiryNotified = crossed
+	return crossed
+}
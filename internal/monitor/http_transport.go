@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TransportLimits bounds the connections HTTP monitors open. Zero means no
+// limit, as in http.Transport.
+type TransportLimits struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+}
+
+var (
+	transportMu     sync.Mutex
+	transportLimits = TransportLimits{MaxIdleConns: 100, MaxIdleConnsPerHost: 2}
+	transports      = make(map[transportKey]*http.Transport)
+)
+
+// transportKey holds the monitor settings that need a transport of their
+// own. Monitors with equal keys share connections.
+type transportKey struct {
+	maxConnsPerHost int
+	httpVersion     string
+	// PEM rather than parsed, so that monitors presenting the same client
+	// certificate share a transport
+	clientCertPEM string
+	clientKeyPEM  Secret
+	trustedRoots  *x509.CertPool
+}
+
+// SetTransportLimits sets the connection limits of the transports shared by
+// HTTP monitors. Transports created under the previous limits are closed.
+func SetTransportLimits(limits TransportLimits) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	transportLimits = limits
+	for key, transport := range transports {
+		transport.CloseIdleConnections()
+		delete(transports, key)
+	}
+}
+
+func (hm *HttpMonitor) transportKey() transportKey {
+	return transportKey{
+		maxConnsPerHost: hm.MaxConnsPerHost,
+		httpVersion:     hm.ForceHTTPVersion,
+		clientCertPEM:   hm.ClientCertPEM,
+		clientKeyPEM:    hm.ClientKeyPEM,
+		trustedRoots:    hm.trustedRoots,
+	}
+}
+
+// transport returns the pooled transport for the monitor's settings, creating
+// it on first use. Timeouts are per request and don't affect the transport.
+func (hm *HttpMonitor) transport() *http.Transport {
+	return pooledTransport(hm.transportKey())
+}
+
+// pooledTransport returns the transport shared by monitors with key, creating
+// it on first use.
+func pooledTransport(key transportKey) *http.Transport {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	transport, ok := transports[key]
+	if !ok {
+		transport = newTransport(key)
+		transports[key] = transport
+	}
+	return transport
+}
+
+// newTransport builds a transport for key under the current limits.
+// transportMu must be held.
+func newTransport(key transportKey) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = transportLimits.MaxIdleConns
+	transport.MaxIdleConnsPerHost = transportLimits.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = transportLimits.MaxConnsPerHost
+	if key.maxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = key.maxConnsPerHost
+	}
+	// A non-nil empty TLSNextProto disables HTTP/2
+	if key.httpVersion == HTTPVersion1 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	transport.TLSClientConfig = transportTLSConfig(key)
+	// Same dialer as http.DefaultTransport, resolving through the DNS cache
+	// and refusing targets outside the allowed networks
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkTarget}
+	transport.DialContext = sharedDNSCache.dialContext(dialer.DialContext)
+	return transport
+}
+
+// transportTLSConfig returns the TLS config of the transports for key, nil
+// for the defaults.
+func transportTLSConfig(key transportKey) *tls.Config {
+	config := clientTLSConfig(key)
+	if key.trustedRoots == nil {
+		return config
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.RootCAs = key.trustedRoots
+	return config
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP versions an HttpMonitor can force with ForceHTTPVersion
+const (
+	HTTPVersion1 = "1.1"
+	HTTPVersion2 = "2"
+	HTTPVersion3 = "3"
+)
+
+// Major protocol version of the responses each forced version must negotiate
+var httpVersionMajors = map[string]int{
+	HTTPVersion1: 1,
+	HTTPVersion2: 2,
+	HTTPVersion3: 3,
+}
+
+// HTTP/3 transports, by the key of the monitors sharing them. transportMu
+// guards them too.
+var h3Transports = make(map[transportKey]*http3.Transport)
+
+func (hm *HttpMonitor) validateForceHTTPVersion() error {
+	if hm.ForceHTTPVersion == "" {
+		return nil
+	}
+	if _, ok := httpVersionMajors[hm.ForceHTTPVersion]; !ok {
+		return fmt.Errorf("invalid HTTP version %q, must be 1.1, 2 or 3", hm.ForceHTTPVersion)
+	}
+	if hm.ForceHTTPVersion == HTTPVersion1 {
+		return nil
+	}
+	parsedURL, err := url.Parse(hm.Address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if parsedURL.Scheme != "https" {
+		return fmt.Errorf("forcing HTTP/%s requires an https address", hm.ForceHTTPVersion)
+	}
+	return nil
+}
+
+// roundTripper returns the transport the monitored request is sent with,
+// an HTTP/3 one when ForceHTTPVersion asks for it.
+func (hm *HttpMonitor) roundTripper() http.RoundTripper {
+	if hm.ForceHTTPVersion != HTTPVersion3 {
+		return hm.transport()
+	}
+
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	key := hm.transportKey()
+	transport, ok := h3Transports[key]
+	if !ok {
+		transport = &http3.Transport{Dial: dialQUIC, TLSClientConfig: transportTLSConfig(key)}
+		h3Transports[key] = transport
+	}
+	return transport
+}
+
+// dialQUIC dials addr over QUIC, refusing targets outside the allowed
+// networks as checkTarget does for TCP.
+func dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{ip}
+	} else if addrs, err = lookupTarget(ctx, "ip", host); err != nil {
+		return nil, err
+	}
+
+	err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	for _, ip := range addrs {
+		if !targetAllowed(ip) {
+			err = fmt.Errorf("%w: %s", ErrTargetDenied, ip.Unmap())
+			continue
+		}
+		var conn quic.EarlyConnection
+		conn, err = quic.DialAddrEarly(ctx, net.JoinHostPort(ip.Unmap().String(), port), tlsCfg, cfg)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// checkHTTPVersion returns an error when resp wasn't served over the forced
+// HTTP version.
+func (hm *HttpMonitor) checkHTTPVersion(resp *http.Response) error {
+	major, ok := httpVersionMajors[hm.ForceHTTPVersion]
+	if !ok {
+		return nil
+	}
+	if resp.ProtoMajor != major {
+		return fmt.Errorf("negotiated %s instead of the forced HTTP/%s", resp.Proto, hm.ForceHTTPVersion)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"shraga/internal/logging"
+	"time"
+)
+
+// warmup sends the monitored request once and discards the response, waking
+// up an endpoint with a cold start before the measured request.
+func (hm *HttpMonitor) warmup(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := hm.newRequest(ctx)
+	if err != nil {
+		return err
+	}
+	// The redirect chain of the warmup isn't reported
+	client := &http.Client{
+		Transport:     hm.roundTripper(),
+		CheckRedirect: hm.checkRedirect(&HttpResponse{}),
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logging.Logger.Sugar().Debugf("Warmup request of monitor %d failed: %v", hm.ID, err)
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	return resp.Body.Close()
+}
@@ -0,0 +1,28 @@
+package monitor
+
+import "time"
+
+// Incident is a period during which a monitor was down. It is open while
+// EndedAt is nil.
+type Incident struct {
+	ID        uint `gorm:"primaryKey"`
+	MonitorID uint `gorm:"index"`
+	StartedAt time.Time
+	EndedAt   *time.Time
+	Reason    Reason // Reason of the result that opened the incident
+	ErrorMsg  string // Error of the result that opened the incident
+}
+
+// IsOpen reports whether the monitor is still down.
+func (i Incident) IsOpen() bool {
+	return i.EndedAt == nil
+}
+
+// Duration returns how long the incident lasted, or has lasted until now if
+// it is still open.
+func (i Incident) Duration(now time.Time) time.Duration {
+	if i.EndedAt != nil {
+		return i.EndedAt.Sub(i.StartedAt)
+	}
+	return now.Sub(i.StartedAt)
+}
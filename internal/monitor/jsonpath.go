@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+)
+
+// JsonPathAssertion asserts that every value selected by Path in a JSON
+// response equals Expected. Path may use array filters, e.g.
+// $[?(@.service=="db")].status.
+type JsonPathAssertion struct {
+	Path     string
+	Expected string
+}
+
+func (a JsonPathAssertion) validate() error {
+	if _, err := jp.ParseString(a.Path); err != nil {
+		return fmt.Errorf("invalid jsonpath %q: %w", a.Path, err)
+	}
+	return nil
+}
+
+// check evaluates the assertion against a parsed JSON document.
+func (a JsonPathAssertion) check(doc any) error {
+	path, err := jp.ParseString(a.Path)
+	if err != nil {
+		return fmt.Errorf("invalid jsonpath %q: %w", a.Path, err)
+	}
+
+	matches := path.Get(doc)
+	if len(matches) == 0 {
+		return fmt.Errorf("jsonpath %s matched nothing, expected %q", a.Path, a.Expected)
+	}
+
+	for _, match := range matches {
+		got := jsonPathValueString(match)
+		if got != a.Expected {
+			return fmt.Errorf("jsonpath %s: got %q, expected %q", a.Path, got, a.Expected)
+		}
+	}
+	return nil
+}
+
+// checkJsonPaths parses body as JSON and runs all configured assertions.
+func (hm *HttpMonitor) checkJsonPaths(body []byte) error {
+	return runJsonPathAssertions(hm.JsonPathAssertions, body)
+}
+
+// runJsonPathAssertions parses body as JSON and runs assertions against it.
+func runJsonPathAssertions(assertions []JsonPathAssertion, body []byte) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+
+	doc, err := oj.Parse(body)
+	if err != nil {
+		return fmt.Errorf("response is not valid JSON: %w", err)
+	}
+
+	for _, assertion := range assertions {
+		if err := assertion.check(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonPathValueString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return oj.JSON(v)
+}
@@ -0,0 +1,189 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"shraga/internal/metrics"
+	"shraga/internal/monitor"
+	"sync"
+	"time"
+)
+
+// How often the cached monitors are reloaded while the database is up
+const degradedRefreshInterval = time.Minute
+
+// degradedMode keeps checks running while the database is unavailable. It
+// caches copies of the enabled monitors last loaded from the database, and
+// buffers the results of checks run meanwhile until they can be saved.
+type degradedMode struct {
+	mu        sync.Mutex
+	monitors  map[uint]monitor.Monitorer
+	checking  map[uint]offlineCheck // Offline checks in flight, by monitor ID
+	refreshed time.Time             // When monitors were last replaced
+	results   []monitor.MonitorResponser
+	capacity  int
+	flushing  sync.Mutex // Keeps flushes from reordering results
+}
+
+// offlineCheck is a copy of a cached monitor handed to a worker by due.
+type offlineCheck struct {
+	cached  monitor.Monitorer // The cache entry it was copied from
+	checked monitor.Monitorer
+}
+
+func newDegradedMode(capacity int) *degradedMode {
+	return &degradedMode{
+		monitors: make(map[uint]monitor.Monitorer),
+		checking: make(map[uint]offlineCheck),
+		capacity: capacity,
+	}
+}
+
+// stale reports whether the cache is due to be replaced with the enabled
+// monitors.
+func (d *degradedMode) stale() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Since(d.refreshed) >= degradedRefreshInterval
+}
+
+// remember replaces the cache with enabled, the enabled monitors, so that
+// monitors deleted or disabled since aren't checked offline.
+func (d *degradedMode) remember(enabled []monitor.Monitorer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.monitors = make(map[uint]monitor.Monitorer, len(enabled))
+	for _, mon := range enabled {
+		d.monitors[mon.GetBase().ID] = mon
+	}
+	d.refreshed = time.Now()
+}
+
+// update replaces the cached copies of the claimed monitors, which are more
+// recent. Monitors that aren't cached are left out until the next refresh.
+// The claimed monitors are copied, as workers check them meanwhile.
+func (d *degradedMode) update(claimed []monitor.Monitorer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, mon := range claimed {
+		if _, ok := d.monitors[mon.GetBase().ID]; ok {
+			d.monitors[mon.GetBase().ID] = shallowCopy(mon)
+		}
+	}
+}
+
+// due returns copies of the cached monitors whose interval elapsed, marked as
+// checked so that they aren't dispatched again before their next interval.
+// Monitors whose offline check is still in flight are skipped until done.
+func (d *degradedMode) due() []monitor.Monitorer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var due []monitor.Monitorer
+	for id, mon := range d.monitors {
+		if _, ok := d.checking[id]; ok {
+			continue
+		}
+		base := mon.GetBase()
+		now := base.Now()
+		if !base.Due(now) {
+			continue
+		}
+		checked := shallowCopy(mon)
+		checked.GetBase().LastMonitorTime = now
+		d.checking[id] = offlineCheck{cached: mon, checked: checked}
+		due = append(due, checked)
+	}
+	return due
+}
+
+// done ends the offline check of mon, returned by due, caching mon in place of
+// the monitor it was copied from, unless the cache was replaced meanwhile.
+// Monitors that due didn't return are ignored.
+func (d *degradedMode) done(mon monitor.Monitorer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := mon.GetBase().ID
+	check, ok := d.checking[id]
+	if !ok || check.checked != mon {
+		return
+	}
+	delete(d.checking, id)
+	if d.monitors[id] == check.cached {
+		d.monitors[id] = mon
+	}
+}
+
+// buffer keeps result until the database recovers. The oldest result is
+// dropped once the buffer is full.
+func (d *degradedMode) buffer(result monitor.MonitorResponser) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(d.results, result)
+	d.trim()
+}
+
+// trim drops the oldest results past the capacity. d.mu must be held.
+func (d *degradedMode) trim() {
+	for len(d.results) > d.capacity {
+		logging.Logger.Sugar().Warnf("result buffer full, dropping result of monitor %d", d.results[0].GetBaseMonitorResponse().MonitorID)
+		d.results = d.results[1:]
+	}
+	metrics.BufferedResults.Set(float64(len(d.results)))
+}
+
+// flush saves the buffered results in the order they were checked, without
+// holding up the results buffered meanwhile. It stops once the database is
+// unavailable again, keeping the unsaved results for the next attempt. Results
+// failing otherwise won't ever be saved, and are dropped.
+func (d *degradedMode) flush(ctx context.Context, save func(context.Context, monitor.MonitorResponser) error) error {
+	d.flushing.Lock()
+	defer d.flushing.Unlock()
+
+	d.mu.Lock()
+	pending := d.results
+	d.results = nil
+	d.mu.Unlock()
+
+	if len(pending) > 0 {
+		logging.Logger.Sugar().Infof("flushing %d buffered results", len(pending))
+	}
+	var err error
+	for len(pending) > 0 {
+		saveErr := save(ctx, pending[0])
+		if saveErr != nil && resultUnsaved(saveErr) {
+			err = saveErr
+			break
+		}
+		if saveErr != nil {
+			logging.Logger.Sugar().Errorf("Dropping buffered result of monitor %d: %v", pending[0].GetBaseMonitorResponse().MonitorID, saveErr)
+		}
+		pending = pending[1:]
+	}
+
+	// Put back what's left ahead of the results buffered meanwhile
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(pending, d.results...)
+	d.trim()
+	return err
+}
+
+// unsavedError is returned by saveResult when the result itself couldn't be
+// saved, as opposed to the sinks or incidents failing after it was.
+type unsavedError struct {
+	err error
+}
+
+func (e unsavedError) Error() string { return e.err.Error() }
+func (e unsavedError) Unwrap() error { return e.err }
+
+// resultUnsaved reports whether err, returned by saveResult, means the result
+// wasn't saved because the database is unavailable, so it's worth buffering
+// until it recovers. Other failures would fail again, or already saved it.
+func resultUnsaved(err error) bool {
+	var unsaved unsavedError
+	return errors.As(err, &unsaved) && db.IsUnavailable(err)
+}
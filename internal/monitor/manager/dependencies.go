@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"context"
+	"shraga/internal/db"
+	"shraga/internal/monitor"
+	"shraga/internal/notify"
+	"slices"
+)
+
+// correlate sets the likely root cause of event among the upstream
+// dependencies of its monitor, or, when the monitor itself is the root cause,
+// the dependents down with it.
+func (m *Manager) correlate(ctx context.Context, event *notify.Event) error {
+	if event.Current != monitor.ResultDown && event.Previous != monitor.ResultDown {
+		return nil
+	}
+
+	graph, err := m.db.GetDependencyGraph(ctx)
+	if err != nil {
+		return err
+	}
+	// The stored result of the monitor is only updated once it is unlocked
+	if node, ok := graph[event.MonitorID]; ok {
+		node.LastResult = event.Current
+		graph[event.MonitorID] = node
+	}
+
+	if event.Current == monitor.ResultDown {
+		event.RootCause = rootCause(graph, event.MonitorID)
+	}
+	if event.RootCause == 0 {
+		event.DownDependents = downDependents(graph, event.MonitorID)
+	}
+	return nil
+}
+
+// rootCause returns the down monitor id depends on, directly or transitively,
+// that has no down dependency of its own, the one with the lowest ID when
+// there are several. Zero means no dependency is down.
+func rootCause(graph map[uint]db.DependencyNode, id uint) uint {
+	var roots, down []uint
+	visited := map[uint]bool{id: true}
+	queue := slices.Clone(graph[id].DependsOn)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] || graph[current].LastResult != monitor.ResultDown {
+			continue
+		}
+		visited[current] = true
+		down = append(down, current)
+
+		upstreamDown := false
+		for _, upstream := range graph[current].DependsOn {
+			if graph[upstream].LastResult == monitor.ResultDown && upstream != id {
+				upstreamDown = true
+				queue = append(queue, upstream)
+			}
+		}
+		if !upstreamDown {
+			roots = append(roots, current)
+		}
+	}
+	if len(roots) == 0 {
+		// Down dependencies depending on each other have no root, any of them
+		// will do
+		if len(down) > 0 {
+			return slices.Min(down)
+		}
+		return 0
+	}
+	return slices.Min(roots)
+}
+
+// downDependents returns the down monitors depending on id, directly or
+// transitively through other down monitors, sorted by ID.
+func downDependents(graph map[uint]db.DependencyNode, id uint) []uint {
+	dependents := make(map[uint][]uint)
+	for node, deps := range graph {
+		for _, upstream := range deps.DependsOn {
+			dependents[upstream] = append(dependents[upstream], node)
+		}
+	}
+
+	var down []uint
+	visited := map[uint]bool{id: true}
+	queue := slices.Clone(dependents[id])
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] || graph[current].LastResult != monitor.ResultDown {
+			continue
+		}
+		visited[current] = true
+		down = append(down, current)
+		queue = append(queue, dependents[current]...)
+	}
+	slices.Sort(down)
+	return down
+}
@@ -2,88 +2,317 @@ package manager
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"reflect"
 	"shraga/internal/db"
 	"shraga/internal/logging"
+	"shraga/internal/metrics"
 	"shraga/internal/monitor"
+	"shraga/internal/notify"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
-const maxWorkers = 10
+const (
+	defaultWorkers       = 10
+	defaultTickInterval  = 1 * time.Second
+	defaultRawRetention  = 1 * time.Hour
+	housekeepingInterval = 1 * time.Minute
+	// Above the longest request timeout of monitors, 5 minutes
+	defaultCheckTimeout = 10 * time.Minute
+	// Allowed on top of a monitor's own timeout before its check is stuck,
+	// for the work around its requests
+	checkTimeoutMargin = 15 * time.Second
+	// The scheduler is considered stalled after missing this many ticks
+	watchdogTicks = 5
+	// Name of the lease electing the replica that dispatches checks
+	schedulerLease = "scheduler"
+)
 
 type Manager struct {
 	db       db.Database
 	doWorkCh chan monitor.Monitorer
 	wg       *sync.WaitGroup
+
+	mu           sync.Mutex
+	runCtx       context.Context // Set once Run starts the worker pool
+	workers      []chan struct{} // Closing a channel stops its worker
+	workerCount  int
+	busy         atomic.Int32 // Workers running a check
+	tickInterval time.Duration
+	tickReset    chan struct{}
+
+	resultRetention time.Duration // Default for monitors without their own
+	notifiers       map[string]*notifierQueue
+	notifying       sync.WaitGroup // Events queued and not yet delivered
+	sinks           []*sinkQueue
+	sinking         sync.WaitGroup // Results queued and not yet written to a sink
+	limiter         *rate.Limiter  // Caps dispatched checks per second when set
+	checkTimeout    time.Duration  // Caps how long a check runs before it's abandoned
+
+	// Defaults for monitors that don't set AggregateResults or RawRetention
+	aggregateResults bool
+	rawRetention     time.Duration
+
+	lastTick atomic.Int64 // Unix nanoseconds of the latest scheduler tick
+	stalled  atomic.Bool
+
+	// Set to elect one dispatching replica, whose checks the workers of every
+	// replica claim; otherwise this one dispatches to its own workers
+	leaseHolder string
+	leaseTTL    time.Duration
+	leader      atomic.Bool
+
+	// Set to keep checking cached monitors while the database is unavailable
+	degraded *degradedMode
+	dbDown   atomic.Bool
+}
+
+// Option configures optional behaviour of Manager.
+type Option func(*Manager)
+
+// WithWorkers sets how many monitors are checked concurrently.
+func WithWorkers(n int) Option {
+	return func(m *Manager) {
+		m.workerCount = n
+	}
+}
+
+// WithTickInterval sets how often due monitors are looked up.
+func WithTickInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.tickInterval = d
+	}
+}
+
+// WithResultRetention sets how long results are kept for monitors that don't
+// configure their own retention. Zero keeps them forever.
+func WithResultRetention(d time.Duration) Option {
+	return func(m *Manager) {
+		m.resultRetention = d
+	}
+}
+
+// WithResultSampling sets whether results are rolled up per minute, keeping
+// raw results for rawRetention, for monitors that don't configure their own.
+func WithResultSampling(aggregate bool, rawRetention time.Duration) Option {
+	return func(m *Manager) {
+		m.aggregateResults = aggregate
+		m.rawRetention = rawRetention
+	}
+}
+
+// WithNotifier sends the result changes of monitors to notifier, which
+// monitors can select by name. Events are delivered in the background, in
+// order, each within notifyTimeout.
+func WithNotifier(name string, notifier notify.Notifier) Option {
+	return func(m *Manager) {
+		m.notifiers[name] = newNotifierQueue(name, notifier, &m.notifying)
+	}
+}
+
+// WithMaxChecksPerSecond caps how many checks are dispatched per second
+// across all monitors, regardless of the worker count. Checks over the cap
+// wait for the next token. Zero leaves dispatching unlimited.
+func WithMaxChecksPerSecond(limit float64) Option {
+	return func(m *Manager) {
+		if limit <= 0 {
+			m.limiter = nil
+			return
+		}
+		m.limiter = rate.NewLimiter(rate.Limit(limit), max(1, int(limit)))
+	}
+}
+
+// WithCheckTimeout caps how long a check may run before its worker abandons
+// it, recording it as down with ReasonStuck. Checks of monitors with their own
+// timeout are abandoned sooner, checkTimeoutMargin past it. It guards against
+// checks that ignore their context; zero never abandons them.
+func WithCheckTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.checkTimeout = d
+	}
+}
+
+// WithLeaderElection makes the manager dispatch due checks and run
+// housekeeping only while it holds the scheduler lease, renewed every third
+// of ttl, so that one of several replicas schedules at a time. The workers of
+// every replica, the leader's included, claim the dispatched checks as they
+// have room for them. holder must be unique per replica.
+func WithLeaderElection(holder string, ttl time.Duration) Option {
+	return func(m *Manager) {
+		m.leaseHolder = holder
+		m.leaseTTL = ttl
+	}
+}
+
+// WithDegradedMode keeps checking the last-known monitors when they can't be
+// loaded from the database, buffering up to bufferSize results in memory
+// until it recovers.
+func WithDegradedMode(bufferSize int) Option {
+	return func(m *Manager) {
+		m.degraded = newDegradedMode(bufferSize)
+	}
 }
 
 // NewManager returns new Manager.
-func NewManager(db db.Database) *Manager {
-	return &Manager{
-		db:       db,
-		doWorkCh: make(chan monitor.Monitorer),
-		wg:       &sync.WaitGroup{},
+func NewManager(db db.Database, opts ...Option) *Manager {
+	m := &Manager{
+		db:           db,
+		doWorkCh:     make(chan monitor.Monitorer),
+		wg:           &sync.WaitGroup{},
+		workerCount:  defaultWorkers,
+		tickInterval: defaultTickInterval,
+		tickReset:    make(chan struct{}, 1),
+		rawRetention: defaultRawRetention,
+		checkTimeout: defaultCheckTimeout,
+		notifiers:    make(map[string]*notifierQueue),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// SetWorkers resizes the worker pool. Stopped workers finish their current
+// check first.
+func (m *Manager) SetWorkers(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workerCount = n
+	if m.runCtx != nil {
+		m.resizeWorkerPool(m.runCtx)
 	}
 }
 
+// SetTickInterval changes how often due monitors are looked up.
+func (m *Manager) SetTickInterval(d time.Duration) {
+	m.mu.Lock()
+	m.tickInterval = d
+	m.mu.Unlock()
+
+	select {
+	case m.tickReset <- struct{}{}:
+	default:
+		// A reset is already pending and will pick up the new interval
+	}
+}
+
+func (m *Manager) getTickInterval() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tickInterval
+}
+
 func (m *Manager) startWorkerPool(ctx context.Context) {
 	logging.Logger.Sugar().Info("starting worker pool")
-	for i := 0; i < maxWorkers; i++ {
-		m.wg.Add(1)
-		go func(workerId int) {
-			logger := logging.Logger.Sugar().With("worker", workerId)
-			logger.Info("started")
-			defer m.wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runCtx = ctx
+	m.resizeWorkerPool(ctx)
+}
+
+// resizeWorkerPool starts or stops workers until workerCount are running.
+// m.mu must be held.
+func (m *Manager) resizeWorkerPool(ctx context.Context) {
+	for len(m.workers) < m.workerCount {
+		quit := make(chan struct{})
+		m.workers = append(m.workers, quit)
+		m.startWorker(ctx, len(m.workers)-1, quit)
+	}
+	for len(m.workers) > m.workerCount {
+		last := len(m.workers) - 1
+		close(m.workers[last])
+		m.workers = m.workers[:last]
+	}
+}
+
+func (m *Manager) startWorker(ctx context.Context, workerId int, quit <-chan struct{}) {
+	m.wg.Add(1)
+	go func() {
+		logger := logging.Logger.Sugar().With("worker", workerId)
+		logger.Info("started")
+		defer m.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-quit:
+				logger.Info("worker pool shrunk, worker stopping")
+				return
+			case mon, ok := <-m.doWorkCh:
+				if !ok {
+					logger.Info("channel closed, worker stopping")
 					return
-				case mon, ok := <-m.doWorkCh:
-					if !ok {
-						logger.Info("channel closed, worker stopping")
-						return
-					}
-					workLogger := logger.With("monitorID", mon.GetBase().ID)
-					err := m.work(ctx, mon, workLogger)
-					if err != nil {
-						workLogger.Errorf("failed to monitor: %v", err)
-					}
 				}
+				m.busy.Add(1)
+				workLogger := logger.With("monitorID", mon.GetBase().ID)
+				err := m.work(ctx, mon, workLogger)
+				if err != nil {
+					workLogger.Errorf("failed to monitor: %v", err)
+				}
+				m.busy.Add(-1)
 			}
-		}(i)	
-	}
+		}
+	}()
 }
 
 func (m *Manager) Run(ctx context.Context) error {
+	if m.leaseHolder == "" {
+		m.leader.Store(true)
+	} else {
+		m.renewLease(ctx)
+		go m.runLeaderElection(ctx)
+	}
+
 	m.startWorkerPool(ctx)
+	go m.runHousekeeping(ctx)
 
-	ticker := time.NewTicker(1 * time.Second)
+	m.lastTick.Store(time.Now().UnixNano())
+	go m.runWatchdog(ctx)
+
+	ticker := time.NewTicker(m.getTickInterval())
 	defer ticker.Stop()
 
-	// Using a separate goroutine to close the channel
-	go func() {
-		<-ctx.Done()
-		close(m.doWorkCh)
-	}()
+	// Run is the only sender, closing the channel once it stops sending.
+	// Closing it on ctx.Done() instead could panic a pending send.
+	defer close(m.doWorkCh)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-m.tickReset:
+			ticker.Reset(m.getTickInterval())
 		case <-ticker.C:
-			availableMonitors, err := m.db.GetMonitorsToRun(ctx)
+			m.lastTick.Store(time.Now().UnixNano())
+			availableMonitors, err := m.monitorsToRun(ctx)
 			if err != nil {
 				logging.Logger.Sugar().Errorf("Failed to get monitors: %v", err)
 				continue
 			}
 
-			for _, availableMonitor := range availableMonitors {
+			for i, availableMonitor := range availableMonitors {
+				if m.limiter != nil {
+					if err := m.limiter.Wait(ctx); err != nil {
+						m.release(ctx, availableMonitors[i:])
+						return ctx.Err()
+					}
+				}
 				select {
 				case m.doWorkCh <- availableMonitor:
-					// Successfully sent to worker
+					// A worker took it, waiting for one is part of the lag
+					observeSchedulerLag(availableMonitor)
 				case <-ctx.Done():
+					m.release(ctx, availableMonitors[i:])
 					return ctx.Err()
 				}
 			}
@@ -91,24 +320,573 @@ func (m *Manager) Run(ctx context.Context) error {
 	}
 }
 
-func (m *Manager) work(ctx context.Context, mon monitor.Monitorer, logger *zap.SugaredLogger) error {
-	logger.Info("start monitoring")
-	err := m.db.Lock(ctx, mon)
+// monitorsToRun returns the monitors due for a check. In degraded mode, the
+// cached monitors are checked while the database is unavailable, and the
+// buffered results are flushed once it recovers.
+func (m *Manager) monitorsToRun(ctx context.Context) ([]monitor.Monitorer, error) {
+	monitors, err := m.claimMonitors(ctx)
+	if m.degraded == nil {
+		return monitors, err
+	}
 	if err != nil {
+		// Only the scheduler checks offline, or every replica would check
+		// the cached monitors
+		if m.leaseHolder != "" && !m.leader.Load() {
+			return nil, err
+		}
+		if !m.dbDown.Swap(true) {
+			logging.Logger.Sugar().Warnf("database unavailable, checking cached monitors: %v", err)
+		}
+		return m.degraded.due(), nil
+	}
+
+	if m.dbDown.Swap(false) {
+		logging.Logger.Sugar().Info("database recovered")
+	}
+	err = m.degraded.flush(ctx, func(ctx context.Context, result monitor.MonitorResponser) error {
+		_, err := m.saveResult(ctx, result)
 		return err
+	})
+	if err != nil {
+		logging.Logger.Sugar().Errorf("Failed to flush buffered results: %v", err)
+	}
+	if m.degraded.stale() {
+		enabled, err := m.db.GetEnabledMonitors(ctx)
+		if err != nil {
+			logging.Logger.Sugar().Errorf("Failed to refresh cached monitors: %v", err)
+		} else {
+			m.degraded.remember(enabled)
+		}
 	}
+	m.degraded.update(monitors)
+	return monitors, nil
+}
+
+// claimMonitors claims the monitors due for a check. Under leader election,
+// the leader dispatches them first, and every replica claims as many as it
+// has idle workers for.
+func (m *Manager) claimMonitors(ctx context.Context) ([]monitor.Monitorer, error) {
+	if m.leaseHolder == "" {
+		return m.db.GetMonitorsToRun(ctx)
+	}
+	if m.leader.Load() {
+		if _, err := m.db.DispatchMonitors(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return m.db.ClaimDispatched(ctx, m.idleWorkers())
+}
+
+// idleWorkers returns how many workers are waiting for a check.
+func (m *Manager) idleWorkers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.workerCount - int(m.busy.Load())
+}
+
+// work checks mon, which GetMonitorsToRun claimed, and unlocks it.
+func (m *Manager) work(ctx context.Context, mon monitor.Monitorer, logger *zap.SugaredLogger) error {
+	if m.degraded != nil {
+		defer m.degraded.done(mon)
+	}
+	if m.dbDown.Load() {
+		m.workOffline(ctx, mon, logger)
+		return nil
+	}
+
+	logger.Info("start monitoring")
 	defer func() {
-		unlockErr := m.db.Unlock(ctx, mon)
+		// ctx is done when the scheduler stops, which mustn't leave the claim
+		// of a check in flight locked
+		unlockErr := m.db.Unlock(context.WithoutCancel(ctx), mon)
 		if unlockErr != nil {
 			logger.Errorf("failed to unlock monitor: %v", unlockErr)
 		}
 	}()
 
-	result := mon.Monitor(ctx)
-	err = m.db.SaveResult(ctx, result)
+	dependencyDown, err := m.dependencyDown(ctx, mon)
+	if err != nil {
+		logger.Errorf("failed to check dependencies: %v", err)
+	}
+	if dependencyDown && mon.GetBase().SkipWhenDependencyDown {
+		logger.Info("dependency is down, skipping check")
+		return nil
+	}
+
+	startTime := time.Now()
+	result, err := m.check(ctx, mon, logger)
 	if err != nil {
 		return err
 	}
+	metrics.ObserveCheckDuration(ctx, mon.GetBase().Type.String(), time.Since(startTime))
+	previous := mon.GetBase().LastResult
+	mon.GetBase().RecordResult(result)
+	metrics.SetConsecutiveFailures(mon.GetBase().ID, mon.GetBase().ConsecutiveFailures)
+	closed, err := m.saveResult(ctx, result)
+	if err != nil {
+		if m.degraded == nil || !resultUnsaved(err) {
+			return err
+		}
+		logger.Warnf("failed to save result, buffering it: %v", err)
+		m.degraded.buffer(result)
+	}
+
+	m.notifyTransition(ctx, mon, previous, result, closed, dependencyDown, logger)
+	m.notifySSLExpiry(ctx, mon, result, logger)
 	return nil
+}
+
+// release unlocks monitors claimed by GetMonitorsToRun but never handed to a
+// worker, so that they're picked up again rather than left locked. Their
+// latest check time is kept, as they weren't checked.
+func (m *Manager) release(ctx context.Context, monitors []monitor.Monitorer) {
+	if m.degraded != nil {
+		for _, mon := range monitors {
+			m.degraded.done(mon)
+		}
+	}
+	// Monitors checked offline weren't claimed
+	if m.dbDown.Load() {
+		return
+	}
+	// ctx is done when the scheduler stops, which mustn't abandon the claims
+	ctx = context.WithoutCancel(ctx)
+	for _, mon := range monitors {
+		if err := m.db.ForceUnlock(ctx, mon.GetBase().ID); err != nil {
+			logging.Logger.Sugar().Errorf("Failed to release monitor %d: %v", mon.GetBase().ID, err)
+		}
+	}
+}
+
+// check runs the check of mon. A check running past checkTimeoutFor is
+// abandoned to free the worker, its goroutine left to finish on its own.
+func (m *Manager) check(ctx context.Context, mon monitor.Monitorer, logger *zap.SugaredLogger) (monitor.MonitorResponser, error) {
+	timeout := m.checkTimeoutFor(mon)
+	if timeout <= 0 {
+		return mon.Monitor(ctx), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// The check runs on a copy, so that once abandoned it can't write runtime
+	// state while the worker records and saves the stuck result
+	checked := cloneMonitor(mon)
+	// Buffered so that an abandoned check doesn't block once it returns
+	done := make(chan monitor.MonitorResponser, 1)
+	go func() {
+		done <- checked.Monitor(ctx)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		copyMonitor(mon, checked)
+		return result, nil
+	case <-timer.C:
+	}
+
+	logger.Errorf("check still running after %s, abandoning it", timeout)
+	metrics.StuckChecks.WithLabelValues(mon.GetBase().Type.String()).Inc()
+	return monitor.StuckResponse(mon, timeout)
+}
+
+// checkTimeoutFor returns how long the check of mon may run: checkTimeoutMargin
+// past the monitor's own timeout, capped by checkTimeout.
+func (m *Manager) checkTimeoutFor(mon monitor.Monitorer) time.Duration {
+	if m.checkTimeout <= 0 {
+		return 0
+	}
+	timed, ok := mon.(monitor.TimedMonitor)
+	if !ok || timed.GetTimeout() <= 0 {
+		return m.checkTimeout
+	}
+	return min(m.checkTimeout, timed.GetTimeout()+checkTimeoutMargin)
+}
+
+// cloneMonitor returns a shallow copy of mon when it keeps runtime state,
+// otherwise mon itself.
+func cloneMonitor(mon monitor.Monitorer) monitor.Monitorer {
+	if _, ok := mon.(monitor.StatefulMonitor); !ok {
+		return mon
+	}
+	return shallowCopy(mon)
+}
+
+// shallowCopy returns a shallow copy of mon, or mon itself when it isn't a
+// pointer to a struct.
+func shallowCopy(mon monitor.Monitorer) monitor.Monitorer {
+	value := reflect.ValueOf(mon)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return mon
+	}
+	clone := reflect.New(value.Elem().Type())
+	clone.Elem().Set(value.Elem())
+	return clone.Interface().(monitor.Monitorer)
+}
 
+// copyMonitor copies the fields the finished check of clone, returned by
+// cloneMonitor, changed back into mon. Unchanged fields aren't written, as
+// the scheduler may read them meanwhile.
+func copyMonitor(mon, clone monitor.Monitorer) {
+	if clone != mon {
+		copyChangedFields(reflect.ValueOf(mon).Elem(), reflect.ValueOf(clone).Elem())
+	}
+}
+
+func copyChangedFields(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			copyChangedFields(dst.Field(i), src.Field(i))
+			continue
+		}
+		if !reflect.DeepEqual(dst.Field(i).Interface(), src.Field(i).Interface()) {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// workOffline checks mon while the database is unavailable. The monitor isn't
+// locked, and its result is buffered until the database recovers.
+func (m *Manager) workOffline(ctx context.Context, mon monitor.Monitorer, logger *zap.SugaredLogger) {
+	logger.Info("start monitoring offline")
+
+	startTime := time.Now()
+	result, err := m.check(ctx, mon, logger)
+	if err != nil {
+		logger.Errorf("failed to monitor: %v", err)
+		return
+	}
+	metrics.ObserveCheckDuration(ctx, mon.GetBase().Type.String(), time.Since(startTime))
+	previous := mon.GetBase().LastResult
+	mon.GetBase().RecordResult(result)
+	metrics.SetConsecutiveFailures(mon.GetBase().ID, mon.GetBase().ConsecutiveFailures)
+	m.degraded.buffer(result)
+
+	// Dependencies can't be looked up, so nothing is suppressed
+	m.notifyTransition(ctx, mon, previous, result, nil, false, logger)
+	m.notifySSLExpiry(ctx, mon, result, logger)
+}
+
+// ingestedResult is a result recorded by Ingest, with what notifying its
+// transition needs
+type ingestedResult struct {
+	result   monitor.MonitorResponser
+	previous monitor.Result
+	closed   *monitor.Incident
+}
+
+// Ingest records results, reported by an external probe for the monitor with
+// the given ID, in timestamp order and in a single transaction. The results
+// newer than the monitor's latest check are recorded as if it had been
+// checked: they update incidents and the runtime state, and notify on
+// transitions. Older ones, e.g. a probe catching up, are only stored. While a
+// check has claimed the monitor, db.ErrMonitorBusy is returned.
+func (m *Manager) Ingest(ctx context.Context, id uint, results []monitor.MonitorResponser) error {
+	logger := logging.Logger.Sugar().With("monitorID", id)
+	results = slices.Clone(results)
+	slices.SortStableFunc(results, func(a, b monitor.MonitorResponser) int {
+		return a.GetBaseMonitorResponse().ResponseTime.Compare(b.GetBaseMonitorResponse().ResponseTime)
+	})
+
+	var mon monitor.Monitorer
+	var recorded []ingestedResult
+	err := m.db.InTransaction(ctx, func(tx db.Database) error {
+		var err error
+		// Locked, so that it isn't claimed while its state is updated
+		mon, err = tx.GetMonitorForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		base := mon.GetBase()
+		for _, result := range results {
+			if err := tx.SaveResult(ctx, result); err != nil {
+				return err
+			}
+			checkedAt := result.GetBaseMonitorResponse().ResponseTime
+			if !checkedAt.After(base.LastMonitorTime) {
+				continue
+			}
+
+			previous := base.LastResult
+			base.RecordResult(result)
+			base.LastMonitorTime = checkedAt
+			closed, err := tx.UpdateIncident(ctx, result)
+			if err != nil {
+				return err
+			}
+			recorded = append(recorded, ingestedResult{result: result, previous: previous, closed: closed})
+		}
+		if len(recorded) == 0 {
+			return nil
+		}
+		return tx.SaveRuntimeState(ctx, mon)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		m.sink(result)
+	}
+	if len(recorded) < len(results) {
+		logger.Infof("stored %d results older than the latest check without updating the monitor", len(results)-len(recorded))
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	metrics.SetConsecutiveFailures(id, mon.GetBase().ConsecutiveFailures)
+	dependencyDown, err := m.dependencyDown(ctx, mon)
+	if err != nil {
+		logger.Errorf("failed to check dependencies: %v", err)
+	}
+	for _, r := range recorded {
+		m.notifyTransition(ctx, mon, r.previous, r.result, r.closed, dependencyDown, logger)
+	}
+	return nil
+}
+
+// saveResult stores result, writes it to the result sinks and updates the
+// incidents of its monitor, returning the incident result closed, if any.
+// Failing to store result returns an unsavedError.
+func (m *Manager) saveResult(ctx context.Context, result monitor.MonitorResponser) (*monitor.Incident, error) {
+	if err := m.db.SaveResult(ctx, result); err != nil {
+		return nil, unsavedError{err}
+	}
+	m.sink(result)
+	return m.db.UpdateIncident(ctx, result)
+}
+
+// notifyTransition notifies when result changes the result of mon from
+// previous. The downtime of closed, the incident result closed, is included.
+// Nothing is sent while dependencyDown, as the dependency's own notifications
+// cover the outage. The first check after it recovers notifies what changed
+// meanwhile.
+func (m *Manager) notifyTransition(ctx context.Context, mon monitor.Monitorer, previous monitor.Result, result monitor.MonitorResponser, closed *monitor.Incident, dependencyDown bool, logger *zap.SugaredLogger) {
+	base := mon.GetBase()
+	if dependencyDown {
+		if _, ok := notify.Transition(previous, result.GetBaseMonitorResponse()); ok {
+			logger.Info("dependency is down, not notifying")
+			if !base.SuppressedTransition {
+				base.SuppressedTransition, base.SuppressedFrom = true, previous
+			}
+		}
+		return
+	}
+	if base.SuppressedTransition {
+		// What changed since the first suppressed transition is notified, so
+		// that a monitor still down is announced, and one back to its result
+		// from before isn't
+		previous = base.SuppressedFrom
+		base.SuppressedTransition, base.SuppressedFrom = false, monitor.ResultUnknown
+	}
+
+	if event, ok := notify.Transition(previous, result.GetBaseMonitorResponse()); ok {
+		if base.Snoozed() {
+			logger.Infof("monitor snoozed until %s, not notifying", base.SnoozeUntil.Format(time.RFC3339))
+			return
+		}
+		if closed != nil {
+			event.Downtime = closed.Duration(result.GetBaseMonitorResponse().ResponseTime)
+		}
+		event.Type = mon.GetBase().Type
+		event.Address = monitorAddress(mon)
+		event.OwnerTeam = mon.GetBase().OwnerTeam
+		event.OwnerEmail = mon.GetBase().OwnerEmail
+		if err := m.correlate(ctx, &event); err != nil {
+			logger.Warnf("failed to correlate with dependencies: %v", err)
+		}
+		m.notify(mon, event, logger)
+	}
+}
+
+// notifySSLExpiry notifies when the certificate checked by result crossed an
+// SSL expiry threshold.
+func (m *Manager) notifySSLExpiry(ctx context.Context, mon monitor.Monitorer, result monitor.MonitorResponser, logger *zap.SugaredLogger) {
+	expiry, ok := result.(monitor.SSLExpiryResponser)
+	if !ok || expiry.GetSSLExpiryThreshold() == 0 {
+		return
+	}
+	if mon.GetBase().Snoozed() {
+		logger.Infof("monitor snoozed until %s, not notifying", mon.GetBase().SnoozeUntil.Format(time.RFC3339))
+		return
+	}
+
+	base := result.GetBaseMonitorResponse()
+	m.notify(mon, notify.Event{
+		MonitorID:          base.MonitorID,
+		Type:               mon.GetBase().Type,
+		Address:            monitorAddress(mon),
+		Previous:           base.Result,
+		Current:            base.Result,
+		Time:               base.ResponseTime,
+		SSLExpiryThreshold: expiry.GetSSLExpiryThreshold(),
+		OwnerTeam:          mon.GetBase().OwnerTeam,
+		OwnerEmail:         mon.GetBase().OwnerEmail,
+	}, logger)
+}
+
+// monitorAddress returns the address mon checks, empty when it doesn't report
+// one.
+func monitorAddress(mon monitor.Monitorer) string {
+	if addressed, ok := mon.(monitor.AddressedMonitor); ok {
+		return addressed.GetAddress()
+	}
+	return ""
+}
+
+// notify queues event for the notifiers mon selects, every notifier when it
+// selects none. Delivery doesn't hold the worker, and its failures are only
+// logged.
+func (m *Manager) notify(mon monitor.Monitorer, event notify.Event, logger *zap.SugaredLogger) {
+	names := mon.GetBase().Notifiers
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(m.notifiers))
+	}
+	for _, name := range names {
+		queue, ok := m.notifiers[name]
+		if !ok {
+			logger.Warnf("unknown notifier %q", name)
+			continue
+		}
+		queue.enqueue(event, logger)
+	}
+}
+
+// runWatchdog checks, independently of Run's loop, that the scheduler keeps
+// ticking. A wedged loop would otherwise silently stop all checks.
+func (m *Manager) runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(m.getTickInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkStalled(time.Now())
+			ticker.Reset(m.getTickInterval())
+		}
+	}
+}
+
+// checkStalled updates the stalled state based on the time since the latest
+// tick, alerting when the scheduler stalls or recovers.
+func (m *Manager) checkStalled(now time.Time) {
+	sinceTick := now.Sub(time.Unix(0, m.lastTick.Load()))
+	stalled := sinceTick > watchdogTicks*m.getTickInterval()
+
+	if stalled && !m.stalled.Swap(true) {
+		logging.Logger.Sugar().Errorf("scheduler stalled: no tick for %s", sinceTick.Round(time.Second))
+		metrics.SchedulerStalled.Set(1)
+	} else if !stalled && m.stalled.Swap(false) {
+		logging.Logger.Sugar().Info("scheduler recovered")
+		metrics.SchedulerStalled.Set(0)
+	}
+}
+
+// Healthy returns an error while the scheduler is stalled.
+func (m *Manager) Healthy() error {
+	if m.stalled.Load() {
+		return errors.New("scheduler stalled")
+	}
+	return nil
+}
+
+// runLeaderElection keeps renewing the scheduler lease until ctx is done,
+// then releases it so another replica can take over right away.
+func (m *Manager) runLeaderElection(ctx context.Context) {
+	ticker := time.NewTicker(m.leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if m.leader.Load() {
+				if err := m.db.ReleaseLease(context.Background(), schedulerLease, m.leaseHolder); err != nil {
+					logging.Logger.Sugar().Errorf("Failed to release scheduler lease: %v", err)
+				}
+			}
+			return
+		case <-ticker.C:
+			m.renewLease(ctx)
+		}
+	}
+}
+
+// renewLease acquires or renews the scheduler lease. Leadership is given up
+// when the lease can't be confirmed, as it may expire meanwhile.
+func (m *Manager) renewLease(ctx context.Context) {
+	acquired, err := m.db.AcquireLease(ctx, schedulerLease, m.leaseHolder, m.leaseTTL)
+	if err != nil {
+		logging.Logger.Sugar().Errorf("Failed to renew scheduler lease: %v", err)
+		acquired = false
+	}
+
+	if acquired && !m.leader.Swap(true) {
+		logging.Logger.Sugar().Infof("%s became the scheduler leader", m.leaseHolder)
+	} else if !acquired && m.leader.Swap(false) {
+		logging.Logger.Sugar().Warnf("%s lost the scheduler leadership", m.leaseHolder)
+	}
+}
+
+// runHousekeeping periodically rolls up the results of aggregated monitors
+// and purges expired results until ctx is done.
+func (m *Manager) runHousekeeping(ctx context.Context) {
+	ticker := time.NewTicker(housekeepingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !m.leader.Load() {
+				continue
+			}
+			if err := m.db.RollupResults(ctx, m.aggregateResults, m.rawRetention); err != nil {
+				logging.Logger.Sugar().Errorf("Failed to roll up results: %v", err)
+			}
+			if err := m.db.PurgeResults(ctx, m.resultRetention); err != nil {
+				logging.Logger.Sugar().Errorf("Failed to purge results: %v", err)
+			}
+		}
+	}
+}
+
+// observeSchedulerLag records how overdue mon is once a worker took it.
+func observeSchedulerLag(mon monitor.Monitorer) {
+	base := mon.GetBase()
+	if base.LastMonitorTime.IsZero() {
+		// Never checked before, so there is no due time to be late for
+		return
+	}
+	lag := base.Now().Sub(base.LastMonitorTime.Add(base.Interval))
+	metrics.SchedulerLag.Observe(lag.Seconds())
+}
+
+// dependencyDown reports whether any monitor mon depends on is currently down.
+func (m *Manager) dependencyDown(ctx context.Context, mon monitor.Monitorer) (bool, error) {
+	dependsOn := mon.GetBase().DependsOn
+	if len(dependsOn) == 0 {
+		return false, nil
+	}
+
+	results, err := m.db.GetLastResults(ctx, dependsOn)
+	if err != nil {
+		return false, err
+	}
+
+	for _, result := range results {
+		if result == monitor.ResultDown {
+			return true, nil
+		}
+	}
+	return false, nil
 }
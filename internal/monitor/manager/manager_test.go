@@ -0,0 +1,1018 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"shraga/internal/metrics"
+	"shraga/internal/monitor"
+	"shraga/internal/monitor/mock"
+	"shraga/internal/notify"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	testifymock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// anyContext matches the context a check runs with, which the watchdog
+// derives from the worker's
+var anyContext = testifymock.MatchedBy(func(context.Context) bool { return true })
+
+type fakeDatabase struct {
+	db.Database
+	mu          sync.Mutex
+	lastResults map[uint]monitor.Result
+	saved       []monitor.MonitorResponser
+	leaseHolder string
+	leaseErr    error
+	toRun       []monitor.Monitorer
+	enabled     []monitor.Monitorer // Returned by GetEnabledMonitors, toRun when nil
+	closed      *monitor.Incident   // Returned by UpdateIncident
+	dbErr       error               // Returned by GetMonitorsToRun and SaveResult when set
+	states      []map[string]any    // Saved by SaveRuntimeState
+	graph       map[uint]db.DependencyNode
+	claimed     map[uint]bool // Claimed by GetMonitorsToRun until unlocked, when set
+	dispatched  map[uint]bool // Set by DispatchMonitors until claimed
+}
+
+func (f *fakeDatabase) GetMonitorsToRun(context.Context) ([]monitor.Monitorer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.claimed == nil || f.dbErr != nil {
+		return f.toRun, f.dbErr
+	}
+	var monitors []monitor.Monitorer
+	for _, mon := range f.toRun {
+		if !f.claimed[mon.GetBase().ID] {
+			f.claimed[mon.GetBase().ID] = true
+			monitors = append(monitors, mon)
+		}
+	}
+	return monitors, nil
+}
+
+func (f *fakeDatabase) DispatchMonitors(context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dbErr != nil {
+		return 0, f.dbErr
+	}
+	var dispatched int64
+	for _, mon := range f.toRun {
+		id := mon.GetBase().ID
+		if !f.claimed[id] && !f.dispatched[id] {
+			f.dispatched[id] = true
+			dispatched++
+		}
+	}
+	return dispatched, nil
+}
+
+func (f *fakeDatabase) ClaimDispatched(_ context.Context, limit int) ([]monitor.Monitorer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dbErr != nil {
+		return nil, f.dbErr
+	}
+	var monitors []monitor.Monitorer
+	for _, mon := range f.toRun {
+		id := mon.GetBase().ID
+		if len(monitors) < limit && f.dispatched[id] && !f.claimed[id] {
+			f.claimed[id] = true
+			delete(f.dispatched, id)
+			monitors = append(monitors, mon)
+		}
+	}
+	return monitors, nil
+}
+
+func (f *fakeDatabase) GetEnabledMonitors(context.Context) ([]monitor.Monitorer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.enabled == nil {
+		return f.toRun, f.dbErr
+	}
+	return f.enabled, f.dbErr
+}
+
+func (f *fakeDatabase) GetMonitorForUpdate(_ context.Context, id uint) (monitor.Monitorer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.claimed[id] {
+		return nil, db.ErrMonitorBusy
+	}
+	for _, mon := range f.toRun {
+		if mon.GetBase().ID == id {
+			return mon, nil
+		}
+	}
+	return nil, db.ErrMonitorNotFound
+}
+
+// InTransaction runs fn without a transaction, so failures aren't rolled back
+func (f *fakeDatabase) InTransaction(_ context.Context, fn func(db.Database) error) error {
+	return fn(f)
+}
+
+func (f *fakeDatabase) AcquireLease(_ context.Context, _, holder string, _ time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.leaseErr != nil {
+		return false, f.leaseErr
+	}
+	if f.leaseHolder == "" {
+		f.leaseHolder = holder
+	}
+	return f.leaseHolder == holder, nil
+}
+
+func (f *fakeDatabase) ReleaseLease(_ context.Context, _, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.leaseHolder == holder {
+		f.leaseHolder = ""
+	}
+	return nil
+}
+
+func (f *fakeDatabase) Unlock(ctx context.Context, mon monitor.Monitorer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.ForceUnlock(ctx, mon.GetBase().ID)
+}
+
+func (f *fakeDatabase) ForceUnlock(_ context.Context, id uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.claimed, id)
+	return nil
+}
+
+func (f *fakeDatabase) SaveRuntimeState(_ context.Context, mon monitor.Monitorer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states = append(f.states, mon.(monitor.StatefulMonitor).RuntimeState())
+	return nil
+}
+
+func (f *fakeDatabase) SaveResult(_ context.Context, result monitor.MonitorResponser) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dbErr != nil {
+		return f.dbErr
+	}
+	f.saved = append(f.saved, result)
+	return nil
+}
+
+func (f *fakeDatabase) UpdateIncident(context.Context, monitor.MonitorResponser) (*monitor.Incident, error) {
+	return f.closed, nil
+}
+
+func (f *fakeDatabase) GetDependencyGraph(context.Context) (map[uint]db.DependencyNode, error) {
+	return maps.Clone(f.graph), nil
+}
+
+func (f *fakeDatabase) GetLastResults(_ context.Context, ids []uint) (map[uint]monitor.Result, error) {
+	results := make(map[uint]monitor.Result)
+	for _, id := range ids {
+		if result, ok := f.lastResults[id]; ok {
+			results[id] = result
+		}
+	}
+	return results, nil
+}
+
+func TestManager_work_SkipsWhenDependencyDown(t *testing.T) {
+	database := &fakeDatabase{lastResults: map[uint]monitor.Result{1: monitor.ResultDown}}
+	m := NewManager(database)
+
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(&monitor.BaseMonitor{ID: 2, DependsOn: []uint{1}, SkipWhenDependencyDown: true})
+
+	err := m.work(context.Background(), mon, logging.Logger.Sugar())
+	assert.NoError(t, err)
+	assert.Empty(t, database.saved)
+}
+
+func TestManager_work_RunsWhenDependencyUp(t *testing.T) {
+	database := &fakeDatabase{lastResults: map[uint]monitor.Result{1: monitor.ResultUp}}
+	m := NewManager(database)
+
+	base := &monitor.BaseMonitor{ID: 2, DependsOn: []uint{1}, SkipWhenDependencyDown: true}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 2, Result: monitor.ResultUp}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	err := m.work(context.Background(), mon, logging.Logger.Sugar())
+	assert.NoError(t, err)
+	assert.Equal(t, []monitor.MonitorResponser{result}, database.saved)
+	assert.Equal(t, monitor.ResultUp, base.LastResult)
+}
+
+// fakeNotifier records the events it's sent. Tests read them after
+// m.notifying.Wait(), once delivery is done.
+type fakeNotifier struct {
+	events []notify.Event
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, event notify.Event) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeNotifier) TestNotify(context.Context) error { return nil }
+
+func TestManager_work_NotifiesTransitions(t *testing.T) {
+	notifier := &fakeNotifier{}
+	m := NewManager(&fakeDatabase{}, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultUp, OwnerTeam: "payments"}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown, ErrorMsg: "refused"}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	// Still down, nothing new to notify
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Equal(t, []notify.Event{{MonitorID: 3, Previous: monitor.ResultUp, Current: monitor.ResultDown, ErrorMsg: "refused", OwnerTeam: "payments"}}, notifier.events)
+}
+
+// blockingNotifier holds every delivery until release is closed
+type blockingNotifier struct {
+	fakeNotifier
+	release chan struct{}
+}
+
+func (b *blockingNotifier) Notify(ctx context.Context, event notify.Event) error {
+	<-b.release
+	return b.fakeNotifier.Notify(ctx, event)
+}
+
+func TestManager_work_SlowNotifierDoesNotHoldWorker(t *testing.T) {
+	slow := &blockingNotifier{release: make(chan struct{})}
+	fast := &fakeNotifier{}
+	m := NewManager(&fakeDatabase{}, WithNotifier("slow", slow), WithNotifier("fast", fast))
+
+	base := &monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultUp}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	done := make(chan error)
+	go func() { done <- m.work(context.Background(), mon, logging.Logger.Sugar()) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the check waited for the notifier")
+	}
+
+	close(slow.release)
+	m.notifying.Wait()
+	assert.Len(t, slow.events, 1)
+	assert.Len(t, fast.events, 1)
+}
+
+func TestManager_work_NotifiesSelectedNotifiers(t *testing.T) {
+	slack := &fakeNotifier{}
+	webhook := &fakeNotifier{}
+	m := NewManager(&fakeDatabase{}, WithNotifier("slack", slack), WithNotifier("webhook", webhook))
+
+	base := &monitor.BaseMonitor{ID: 3, Type: monitor.TypeHTTP, LastResult: monitor.ResultUp, Notifiers: []string{"webhook", "pager"}}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Empty(t, slack.events)
+	assert.Equal(t, []notify.Event{{MonitorID: 3, Type: monitor.TypeHTTP, Previous: monitor.ResultUp, Current: monitor.ResultDown}}, webhook.events)
+
+	// Without a selection, every notifier is alerted
+	base.Notifiers = nil
+	result.Result = monitor.ResultUp
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Len(t, slack.events, 1)
+	assert.Len(t, webhook.events, 2)
+}
+
+func TestMonitorAddress(t *testing.T) {
+	assert.Equal(t, "https://example.com", monitorAddress(&monitor.HttpMonitor{Address: "https://example.com"}))
+	assert.Equal(t, "ftp.example.com", monitorAddress(&monitor.FtpMonitor{FileTransferConfig: monitor.FileTransferConfig{Address: "ftp.example.com"}}))
+	assert.Equal(t, "db.internal", monitorAddress(&monitor.TcpMonitor{Host: "db.internal"}))
+	assert.Empty(t, monitorAddress(mock.NewMonitorer(t)))
+}
+
+func TestManager_work_NotifiesDowntimeOnRecovery(t *testing.T) {
+	notifier := &fakeNotifier{}
+	recovered := time.Date(2020, 1, 1, 12, 14, 0, 0, time.UTC)
+	database := &fakeDatabase{closed: &monitor.Incident{MonitorID: 3, StartedAt: recovered.Add(-14 * time.Minute), EndedAt: &recovered}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultDown}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultUp, ResponseTime: recovered}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, 14*time.Minute, notifier.events[0].Downtime)
+}
+
+func TestManager_work_SnoozedDoesNotNotify(t *testing.T) {
+	notifier := &fakeNotifier{}
+	database := &fakeDatabase{}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultUp, SnoozeUntil: time.Now().Add(time.Hour)}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Empty(t, notifier.events)
+	assert.Equal(t, []monitor.MonitorResponser{result}, database.saved, "snoozed checks should still be recorded")
+}
+
+func TestManager_work_DependencyDownDoesNotNotify(t *testing.T) {
+	notifier := &fakeNotifier{}
+	database := &fakeDatabase{lastResults: map[uint]monitor.Result{1: monitor.ResultDown}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 2, LastResult: monitor.ResultUp, DependsOn: []uint{1}}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 2, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Empty(t, notifier.events)
+	assert.Equal(t, []monitor.MonitorResponser{result}, database.saved, "the check should still run and be recorded")
+	assert.Equal(t, monitor.ResultDown, base.LastResult)
+
+	// Having recovered along with the dependency, it went unnoticed
+	database.lastResults[1] = monitor.ResultUp
+	result.Result = monitor.ResultUp
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Empty(t, notifier.events)
+	assert.False(t, base.SuppressedTransition)
+}
+
+func TestManager_work_DependencyRecoversDependentStaysDown(t *testing.T) {
+	notifier := &fakeNotifier{}
+	database := &fakeDatabase{lastResults: map[uint]monitor.Result{1: monitor.ResultDown}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 2, LastResult: monitor.ResultUp, DependsOn: []uint{1}}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 2, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Empty(t, notifier.events)
+
+	// The dependency recovers, and the dependent being down is announced
+	database.lastResults[1] = monitor.ResultUp
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, monitor.ResultUp, notifier.events[0].Previous)
+	assert.Equal(t, monitor.ResultDown, notifier.events[0].Current)
+
+	// Its recovery then follows the announcement
+	result.Result = monitor.ResultUp
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, monitor.ResultUp, notifier.events[1].Current)
+}
+
+func TestManager_work_NotifiesSSLExpiry(t *testing.T) {
+	notifier := &fakeNotifier{}
+	m := NewManager(&fakeDatabase{}, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultWarn}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultWarn}, SSLExpiryThreshold: 7}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	assert.Equal(t, []notify.Event{{MonitorID: 3, Previous: monitor.ResultWarn, Current: monitor.ResultWarn, SSLExpiryThreshold: 7}}, notifier.events)
+}
+
+func TestManager_Ingest(t *testing.T) {
+	notifier := &fakeNotifier{}
+	checked := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	mon := &monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultUp, LastMonitorTime: checked}}
+	database := &fakeDatabase{toRun: []monitor.Monitorer{mon}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	down := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown, ErrorMsg: "timeout", ResponseTime: checked.Add(time.Minute)}}
+	up := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultUp, ResponseTime: checked.Add(2 * time.Minute)}}
+
+	require.NoError(t, m.Ingest(context.Background(), 3, []monitor.MonitorResponser{up, down}))
+	assert.Equal(t, []monitor.MonitorResponser{down, up}, database.saved, "results should be recorded in timestamp order")
+	require.Len(t, database.states, 1, "the batch should save the state once")
+	assert.Equal(t, monitor.ResultUp, database.states[0]["last_result"])
+	assert.Equal(t, checked.Add(2*time.Minute), mon.LastMonitorTime)
+	m.notifying.Wait()
+	assert.Equal(t, []notify.Event{
+		{MonitorID: 3, Previous: monitor.ResultUp, Current: monitor.ResultDown, ErrorMsg: "timeout", Time: checked.Add(time.Minute)},
+		{MonitorID: 3, Previous: monitor.ResultDown, Current: monitor.ResultUp, Time: checked.Add(2 * time.Minute)},
+	}, notifier.events)
+}
+
+func TestManager_Ingest_OlderResultsOnlyStored(t *testing.T) {
+	notifier := &fakeNotifier{}
+	checked := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	mon := &monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultUp, LastMonitorTime: checked}}
+	database := &fakeDatabase{toRun: []monitor.Monitorer{mon}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	// A probe catching up on results from before the latest check
+	late := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown, ResponseTime: checked.Add(-time.Minute)}}
+	require.NoError(t, m.Ingest(context.Background(), 3, []monitor.MonitorResponser{late}))
+	assert.Equal(t, []monitor.MonitorResponser{late}, database.saved)
+	assert.Empty(t, database.states)
+	assert.Equal(t, monitor.ResultUp, mon.LastResult)
+	m.notifying.Wait()
+	assert.Empty(t, notifier.events)
+}
+
+func TestManager_Ingest_ClaimedMonitor(t *testing.T) {
+	mon := &monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 3}}
+	database := &fakeDatabase{toRun: []monitor.Monitorer{mon}, claimed: map[uint]bool{3: true}}
+	m := NewManager(database)
+
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown, ResponseTime: time.Now()}}
+	assert.ErrorIs(t, m.Ingest(context.Background(), 3, []monitor.MonitorResponser{result}), db.ErrMonitorBusy)
+	assert.Empty(t, database.saved)
+	assert.Equal(t, monitor.ResultUnknown, mon.LastResult)
+}
+
+func TestManager_SetWorkers_ResizesPool(t *testing.T) {
+	m := NewManager(&fakeDatabase{}, WithWorkers(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.startWorkerPool(ctx)
+	assert.Len(t, m.workers, 2)
+
+	m.SetWorkers(5)
+	assert.Len(t, m.workers, 5)
+
+	m.SetWorkers(1)
+	assert.Len(t, m.workers, 1)
+
+	cancel()
+	m.wg.Wait()
+}
+
+func TestManager_checkStalled(t *testing.T) {
+	m := NewManager(&fakeDatabase{}, WithTickInterval(time.Second))
+	lastTick := time.Now()
+	m.lastTick.Store(lastTick.UnixNano())
+
+	m.checkStalled(lastTick.Add(2 * time.Second))
+	assert.NoError(t, m.Healthy())
+
+	m.checkStalled(lastTick.Add(10 * time.Second))
+	assert.EqualError(t, m.Healthy(), "scheduler stalled")
+
+	m.lastTick.Store(lastTick.Add(10 * time.Second).UnixNano())
+	m.checkStalled(lastTick.Add(11 * time.Second))
+	assert.NoError(t, m.Healthy())
+}
+
+func TestManager_renewLease(t *testing.T) {
+	database := &fakeDatabase{leaseHolder: "other"}
+	m := NewManager(database, WithLeaderElection("replica-1", 15*time.Second))
+
+	m.renewLease(context.Background())
+	assert.False(t, m.leader.Load())
+
+	// The other replica's lease expired and was taken over
+	database.leaseHolder = ""
+	m.renewLease(context.Background())
+	assert.True(t, m.leader.Load())
+
+	database.leaseErr = errors.New("connection refused")
+	m.renewLease(context.Background())
+	assert.False(t, m.leader.Load())
+}
+
+func TestWithMaxChecksPerSecond(t *testing.T) {
+	m := NewManager(&fakeDatabase{}, WithMaxChecksPerSecond(0.5))
+	assert.NotNil(t, m.limiter)
+	assert.True(t, m.limiter.Allow())
+	assert.False(t, m.limiter.Allow(), "checks over the cap should wait for a token")
+
+	m = NewManager(&fakeDatabase{}, WithMaxChecksPerSecond(0))
+	assert.Nil(t, m.limiter)
+}
+
+func TestManager_DegradedMode(t *testing.T) {
+	base := &monitor.BaseMonitor{ID: 4, Interval: time.Minute}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 4, Result: monitor.ResultUp}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	database := &fakeDatabase{toRun: []monitor.Monitorer{mon}}
+	m := NewManager(database, WithDegradedMode(10))
+
+	monitors, err := m.monitorsToRun(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []monitor.Monitorer{mon}, monitors)
+
+	// The database goes down, so the cached monitor is checked once per interval
+	database.dbErr = errors.New("connection refused")
+	monitors, err = m.monitorsToRun(context.Background())
+	assert.NoError(t, err)
+	require.Len(t, monitors, 1)
+	assert.Equal(t, uint(4), monitors[0].GetBase().ID)
+	assert.NoError(t, m.work(context.Background(), monitors[0], logging.Logger.Sugar()))
+	assert.Empty(t, database.saved)
+
+	monitors, err = m.monitorsToRun(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, monitors)
+
+	// Recovery flushes the buffered result
+	database.dbErr = nil
+	database.toRun = nil
+	_, err = m.monitorsToRun(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []monitor.MonitorResponser{result}, database.saved)
+}
+
+func TestManager_DegradedMode_BufferFull(t *testing.T) {
+	m := NewManager(&fakeDatabase{}, WithDegradedMode(2))
+	for id := uint(1); id <= 3; id++ {
+		m.degraded.buffer(&monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: id}})
+	}
+
+	var flushed []uint
+	err := m.degraded.flush(context.Background(), func(_ context.Context, result monitor.MonitorResponser) error {
+		flushed = append(flushed, result.GetBaseMonitorResponse().MonitorID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{2, 3}, flushed, "the oldest result should be dropped")
+}
+
+func TestManager_work_BuffersOnlyUnavailableDatabase(t *testing.T) {
+	base := &monitor.BaseMonitor{ID: 4}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 4, Result: monitor.ResultUp}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	database := &fakeDatabase{dbErr: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	m := NewManager(database, WithDegradedMode(10))
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	assert.Len(t, m.degraded.results, 1)
+
+	// The database rejecting the result would reject it again once flushed
+	database.dbErr = errors.New(`duplicate key value violates unique constraint "results_pkey"`)
+	assert.ErrorContains(t, m.work(context.Background(), mon, logging.Logger.Sugar()), "duplicate key")
+	assert.Len(t, m.degraded.results, 1)
+}
+
+func TestManager_DegradedMode_FlushDropsRejectedResults(t *testing.T) {
+	m := NewManager(&fakeDatabase{}, WithDegradedMode(10))
+	for id := uint(1); id <= 4; id++ {
+		m.degraded.buffer(&monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: id}})
+	}
+
+	var flushed []uint
+	err := m.degraded.flush(context.Background(), func(_ context.Context, result monitor.MonitorResponser) error {
+		id := result.GetBaseMonitorResponse().MonitorID
+		switch id {
+		case 2:
+			return unsavedError{errors.New("invalid input syntax")}
+		case 3:
+			// Checks keep buffering while the flush saves
+			m.degraded.buffer(&monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 5}})
+			return unsavedError{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+		}
+		flushed = append(flushed, id)
+		return nil
+	})
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, []uint{1}, flushed, "the rejected result should be dropped, not block the flush")
+
+	var left []uint
+	for _, result := range m.degraded.results {
+		left = append(left, result.GetBaseMonitorResponse().MonitorID)
+	}
+	assert.Equal(t, []uint{3, 4, 5}, left, "unsaved results should stay ahead of newer ones")
+}
+
+func TestManager_DegradedMode_ForgetsRemovedMonitors(t *testing.T) {
+	kept := &monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 1, Interval: time.Minute}}
+	removed := &monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 2, Interval: time.Minute}}
+	database := &fakeDatabase{enabled: []monitor.Monitorer{kept, removed}}
+	m := NewManager(database, WithDegradedMode(10))
+
+	_, err := m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, m.degraded.monitors, 2)
+
+	// Monitor 2 is deleted, and the cache is refreshed
+	database.enabled = []monitor.Monitorer{kept}
+	m.degraded.refreshed = time.Time{}
+	_, err = m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+
+	database.dbErr = errors.New("connection refused")
+	monitors, err := m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+	require.Len(t, monitors, 1)
+	assert.Equal(t, uint(1), monitors[0].GetBase().ID)
+}
+
+func TestManager_DegradedMode_SkipsChecksInFlight(t *testing.T) {
+	mon := &staleMonitor{
+		HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 3, Type: monitor.TypeHTTP, Interval: time.Millisecond}},
+		release:     make(chan struct{}),
+		written:     make(chan struct{}),
+	}
+	database := &fakeDatabase{enabled: []monitor.Monitorer{mon}}
+	m := NewManager(database, WithDegradedMode(10))
+	_, err := m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+
+	database.dbErr = errors.New("connection refused")
+	monitors, err := m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+	require.Len(t, monitors, 1)
+	done := make(chan error)
+	go func() {
+		done <- m.work(context.Background(), monitors[0], logging.Logger.Sugar())
+	}()
+
+	// The check outlasts its interval, but isn't dispatched again meanwhile
+	time.Sleep(10 * time.Millisecond)
+	again, err := m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	close(mon.release)
+	require.NoError(t, <-done)
+	time.Sleep(10 * time.Millisecond)
+	monitors, err = m.monitorsToRun(context.Background())
+	require.NoError(t, err)
+	require.Len(t, monitors, 1)
+	assert.Equal(t, "stale", monitors[0].(*staleMonitor).LastBodyHash, "the state of the finished check should be cached")
+}
+
+type fakeSink struct {
+	saved []monitor.MonitorResponser
+	err   error
+}
+
+func (f *fakeSink) Save(_ context.Context, result monitor.MonitorResponser) error {
+	f.saved = append(f.saved, result)
+	return f.err
+}
+
+func TestManager_work_WritesResultSinks(t *testing.T) {
+	database := &fakeDatabase{}
+	broken := &fakeSink{err: errors.New("broker unavailable")}
+	sink := &fakeSink{}
+	m := NewManager(database, WithResultSinks(broken, sink))
+
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultUp}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(&monitor.BaseMonitor{ID: 3})
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()), "a failing sink doesn't fail the check")
+	m.sinking.Wait()
+	assert.Equal(t, []monitor.MonitorResponser{result}, database.saved)
+	assert.Equal(t, []monitor.MonitorResponser{result}, broken.saved)
+	assert.Equal(t, []monitor.MonitorResponser{result}, sink.saved)
+}
+
+// blockingSink holds every write until released.
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (b *blockingSink) Save(ctx context.Context, _ monitor.MonitorResponser) error {
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestManager_work_SlowSinkDoesNotHoldWorker(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	m := NewManager(&fakeDatabase{}, WithResultSinks(sink))
+
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(&monitor.BaseMonitor{ID: 3})
+	mon.On("Monitor", anyContext).Return(&monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultUp}})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.work(context.Background(), mon, logging.Logger.Sugar())
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the worker waited for the sink")
+	}
+	close(sink.release)
+	m.sinking.Wait()
+}
+
+type hungMonitor struct {
+	monitor.HttpMonitor
+	release chan struct{}
+}
+
+// Monitor ignores its context, as a misbehaving check would.
+func (h *hungMonitor) Monitor(context.Context) monitor.MonitorResponser {
+	<-h.release
+	return &monitor.HttpResponse{}
+}
+
+func TestManager_work_AbandonsStuckCheck(t *testing.T) {
+	database := &fakeDatabase{}
+	m := NewManager(database, WithCheckTimeout(50*time.Millisecond))
+
+	mon := &hungMonitor{HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 3, Type: monitor.TypeHTTP}}, release: make(chan struct{})}
+	defer close(mon.release)
+
+	require.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	require.Len(t, database.saved, 1)
+	result := database.saved[0].GetBaseMonitorResponse()
+	assert.Equal(t, monitor.ResultDown, result.Result)
+	assert.Equal(t, monitor.ReasonStuck, result.Reason)
+	assert.Equal(t, "check abandoned after running for 50ms", result.ErrorMsg)
+	assert.Equal(t, monitor.ResultDown, mon.LastResult)
+}
+
+// staleMonitor writes runtime state once released, after its check was
+// abandoned.
+type staleMonitor struct {
+	monitor.HttpMonitor
+	release chan struct{}
+	written chan struct{}
+}
+
+func (s *staleMonitor) Monitor(context.Context) monitor.MonitorResponser {
+	<-s.release
+	s.LastBodyHash = "stale"
+	close(s.written)
+	return &monitor.HttpResponse{}
+}
+
+func TestManager_work_AbandonedCheckDoesNotWriteState(t *testing.T) {
+	database := &fakeDatabase{}
+	m := NewManager(database, WithCheckTimeout(50*time.Millisecond))
+
+	mon := &staleMonitor{
+		HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 3, Type: monitor.TypeHTTP}, LastBodyHash: "current"},
+		release:     make(chan struct{}),
+		written:     make(chan struct{}),
+	}
+	require.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	assert.Equal(t, monitor.ReasonStuck, database.saved[0].GetBaseMonitorResponse().Reason)
+
+	// Saving the state while the abandoned check writes its own is no race
+	close(mon.release)
+	require.NoError(t, database.SaveRuntimeState(context.Background(), mon))
+	<-mon.written
+	assert.Equal(t, "current", mon.LastBodyHash)
+	assert.Equal(t, monitor.ResultDown, mon.LastResult)
+}
+
+func TestManager_checkTimeoutFor(t *testing.T) {
+	hm := &monitor.HttpMonitor{ReqTimeout: 5 * time.Second}
+	assert.Equal(t, 20*time.Second, NewManager(&fakeDatabase{}).checkTimeoutFor(hm))
+	hm.WarmupRequest = true
+	assert.Equal(t, 25*time.Second, NewManager(&fakeDatabase{}).checkTimeoutFor(hm))
+
+	// The global timeout caps it, and applies to monitors without their own
+	assert.Equal(t, 10*time.Second, NewManager(&fakeDatabase{}, WithCheckTimeout(10*time.Second)).checkTimeoutFor(hm))
+	assert.Equal(t, defaultCheckTimeout, NewManager(&fakeDatabase{}).checkTimeoutFor(mock.NewMonitorer(t)))
+	assert.Zero(t, NewManager(&fakeDatabase{}, WithCheckTimeout(0)).checkTimeoutFor(hm))
+}
+
+// checkCounts is shared by the copies of a monitor its checks run on.
+type checkCounts struct {
+	running    atomic.Int32
+	maxRunning atomic.Int32
+	checks     atomic.Int32
+}
+
+func TestManager_work_UnlocksAfterShutdown(t *testing.T) {
+	database := &fakeDatabase{claimed: map[uint]bool{3: true}}
+	m := NewManager(database)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultUp}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(&monitor.BaseMonitor{ID: 3})
+	mon.On("Monitor", anyContext).Run(func(testifymock.Arguments) { cancel() }).Return(result)
+
+	require.NoError(t, m.work(ctx, mon, logging.Logger.Sugar()))
+	assert.Empty(t, database.claimed, "the claim should be released although the scheduler stopped")
+}
+
+type slowMonitor struct {
+	monitor.HttpMonitor
+	*checkCounts
+}
+
+// Monitor takes several ticks, tracking how many of its checks overlap.
+func (s *slowMonitor) Monitor(context.Context) monitor.MonitorResponser {
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+	if running > s.maxRunning.Load() {
+		s.maxRunning.Store(running)
+	}
+	s.checks.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: s.ID, Result: monitor.ResultUp}}
+}
+
+func TestManager_Run_DoesNotOverlapChecks(t *testing.T) {
+	mon := &slowMonitor{HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 5, Type: monitor.TypeHTTP}}, checkCounts: &checkCounts{}}
+	database := &fakeDatabase{toRun: []monitor.Monitorer{mon}, claimed: map[uint]bool{}}
+	m := NewManager(database, WithWorkers(4), WithTickInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Run(ctx), context.DeadlineExceeded)
+	m.wg.Wait()
+
+	assert.Equal(t, int32(1), mon.maxRunning.Load(), "a check ran concurrently with itself")
+	assert.Greater(t, mon.checks.Load(), int32(1))
+}
+
+func TestManager_Run_SchedulerLagIncludesWaitForWorker(t *testing.T) {
+	lag := func() (uint64, float64) {
+		var m dto.Metric
+		require.NoError(t, metrics.SchedulerLag.Write(&m))
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+	countBefore, sumBefore := lag()
+
+	// Both are due now, and the single worker takes 50ms per check
+	due := time.Now().Add(-time.Hour)
+	counts := &checkCounts{}
+	first := &slowMonitor{HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 5, Interval: time.Hour, LastMonitorTime: due}}, checkCounts: counts}
+	second := &slowMonitor{HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 6, Interval: time.Hour, LastMonitorTime: due}}, checkCounts: counts}
+	database := &fakeDatabase{toRun: []monitor.Monitorer{first, second}, claimed: map[uint]bool{}}
+	m := NewManager(database, WithWorkers(1), WithTickInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for counts.checks.Load() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	assert.ErrorIs(t, m.Run(ctx), context.Canceled)
+	m.wg.Wait()
+
+	count, sum := lag()
+	assert.Equal(t, uint64(2), count-countBefore, "only checks taken by a worker should be observed")
+	assert.GreaterOrEqual(t, sum-sumBefore, 0.04, "the second check waited for the worker")
+}
+
+func TestManager_Run_FollowerRunsDispatchedChecks(t *testing.T) {
+	dispatched := &slowMonitor{HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 5}}, checkCounts: &checkCounts{}}
+	due := &slowMonitor{HttpMonitor: monitor.HttpMonitor{BaseMonitor: monitor.BaseMonitor{ID: 6}}, checkCounts: &checkCounts{}}
+	database := &fakeDatabase{
+		toRun:       []monitor.Monitorer{dispatched, due},
+		claimed:     map[uint]bool{},
+		dispatched:  map[uint]bool{5: true},
+		leaseHolder: "replica-1",
+	}
+	run := func(m *Manager, until *slowMonitor) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		go func() {
+			for until.checks.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+		}()
+		assert.ErrorIs(t, m.Run(ctx), context.Canceled)
+		m.wg.Wait()
+	}
+
+	// The follower checks what the leader dispatched, and nothing else
+	run(NewManager(database, WithWorkers(2), WithTickInterval(5*time.Millisecond), WithLeaderElection("replica-2", time.Minute)), dispatched)
+	assert.Equal(t, int32(1), dispatched.checks.Load())
+	assert.Zero(t, due.checks.Load(), "only the leader should dispatch")
+
+	// The leader dispatches to its own workers too
+	run(NewManager(database, WithWorkers(2), WithTickInterval(5*time.Millisecond), WithLeaderElection("replica-1", time.Minute)), due)
+	assert.Equal(t, int32(1), due.checks.Load())
+}
+
+func TestManager_work_NotifiesRootCause(t *testing.T) {
+	notifier := &fakeNotifier{}
+	// web depends on api, which depends on the database, as does the worker
+	database := &fakeDatabase{graph: map[uint]db.DependencyNode{
+		1: {LastResult: monitor.ResultDown},
+		2: {DependsOn: []uint{1}, LastResult: monitor.ResultDown},
+		3: {DependsOn: []uint{2}, LastResult: monitor.ResultUp},
+		4: {DependsOn: []uint{1}, LastResult: monitor.ResultUp},
+	}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 3, LastResult: monitor.ResultUp}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 3, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, uint(1), notifier.events[0].RootCause)
+	assert.Empty(t, notifier.events[0].DownDependents)
+}
+
+func TestManager_work_NotifiesDownDependents(t *testing.T) {
+	notifier := &fakeNotifier{}
+	database := &fakeDatabase{graph: map[uint]db.DependencyNode{
+		1: {LastResult: monitor.ResultUp},
+		2: {DependsOn: []uint{1}, LastResult: monitor.ResultDown},
+		3: {DependsOn: []uint{2}, LastResult: monitor.ResultDown},
+		4: {DependsOn: []uint{1}, LastResult: monitor.ResultUp},
+	}}
+	m := NewManager(database, WithNotifier("fake", notifier))
+
+	base := &monitor.BaseMonitor{ID: 1, LastResult: monitor.ResultUp}
+	result := &monitor.HttpResponse{BaseMonitorResponse: monitor.BaseMonitorResponse{MonitorID: 1, Result: monitor.ResultDown}}
+	mon := mock.NewMonitorer(t)
+	mon.On("GetBase").Return(base)
+	mon.On("Monitor", anyContext).Return(result)
+
+	assert.NoError(t, m.work(context.Background(), mon, logging.Logger.Sugar()))
+	m.notifying.Wait()
+	require.Len(t, notifier.events, 1)
+	assert.Zero(t, notifier.events[0].RootCause)
+	assert.Equal(t, []uint{2, 3}, notifier.events[0].DownDependents)
+}
+
+func TestRootCause(t *testing.T) {
+	graph := map[uint]db.DependencyNode{
+		1: {LastResult: monitor.ResultDown},
+		2: {DependsOn: []uint{1, 5}, LastResult: monitor.ResultDown},
+		3: {DependsOn: []uint{2, 4}, LastResult: monitor.ResultDown},
+		4: {LastResult: monitor.ResultUp},
+		5: {LastResult: monitor.ResultUp},
+		// Down together, depending on each other
+		6: {DependsOn: []uint{7}, LastResult: monitor.ResultDown},
+		7: {DependsOn: []uint{6}, LastResult: monitor.ResultDown},
+		8: {DependsOn: []uint{7}, LastResult: monitor.ResultDown},
+	}
+	assert.Equal(t, uint(1), rootCause(graph, 3))
+	assert.Equal(t, uint(1), rootCause(graph, 2))
+	assert.Zero(t, rootCause(graph, 1))
+	assert.Zero(t, rootCause(graph, 4))
+	assert.Equal(t, uint(6), rootCause(graph, 8))
+
+	assert.Equal(t, []uint{2, 3}, downDependents(graph, 1))
+	assert.Equal(t, []uint{6, 8}, downDependents(graph, 7))
+}
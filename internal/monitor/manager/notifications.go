@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"context"
+	"shraga/internal/metrics"
+	"shraga/internal/notify"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Events waiting for delivery by a notifier; more are dropped
+	notifyQueueSize = 256
+	// Bounds the delivery of one event, retries included, so that a notifier
+	// that is down only delays the events queued behind it
+	notifyTimeout = 30 * time.Second
+)
+
+type notification struct {
+	event  notify.Event
+	logger *zap.SugaredLogger
+}
+
+// notifierQueue delivers the events of one notifier in order, off the check
+// workers, so that a slow or failing notifier neither holds a worker nor
+// delays the other notifiers.
+type notifierQueue struct {
+	name     string
+	notifier notify.Notifier
+	events   chan notification
+	start    sync.Once
+	pending  *sync.WaitGroup // Shared by the queues of a manager
+}
+
+func newNotifierQueue(name string, notifier notify.Notifier, pending *sync.WaitGroup) *notifierQueue {
+	return &notifierQueue{
+		name:     name,
+		notifier: notifier,
+		events:   make(chan notification, notifyQueueSize),
+		pending:  pending,
+	}
+}
+
+// enqueue queues event for delivery, dropping it when the queue is full. The
+// delivering goroutine is started on first use, and lives as long as the
+// process.
+func (q *notifierQueue) enqueue(event notify.Event, logger *zap.SugaredLogger) {
+	q.start.Do(func() { go q.run() })
+
+	q.pending.Add(1)
+	select {
+	case q.events <- notification{event: event, logger: logger}:
+	default:
+		q.pending.Done()
+		logger.Errorf("notification queue of %s full, dropping event", q.name)
+		metrics.DroppedNotifications.WithLabelValues(q.name).Inc()
+	}
+}
+
+func (q *notifierQueue) run() {
+	for n := range q.events {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := q.notifier.Notify(ctx, n.event); err != nil {
+			n.logger.Errorf("failed to notify %s: %v", q.name, err)
+		}
+		cancel()
+		q.pending.Done()
+	}
+}
@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"context"
+	"shraga/internal/db"
+	"shraga/internal/logging"
+	"shraga/internal/metrics"
+	"shraga/internal/monitor"
+	"sync"
+	"time"
+)
+
+const (
+	// Results waiting to be written to a sink; more are dropped
+	sinkQueueSize = 1024
+	// Bounds writing one result to a sink, so that a sink that is down only
+	// delays the results queued behind it
+	sinkTimeout = 30 * time.Second
+)
+
+// ResultSink receives the result of every check, e.g. to stream results to a
+// data pipeline. *db.GormDb is one, storing results in another database.
+type ResultSink interface {
+	Save(ctx context.Context, result monitor.MonitorResponser) error
+}
+
+var _ ResultSink = (*db.GormDb)(nil)
+
+// WithResultSinks writes results to sinks as well as to the database. Sinks
+// can't replace the database: incidents, state transitions and their
+// notifications, degraded mode and the API's queries all read the results
+// stored there. Results are written in the background, in order, each within
+// sinkTimeout.
+func WithResultSinks(sinks ...ResultSink) Option {
+	return func(m *Manager) {
+		for _, sink := range sinks {
+			m.sinks = append(m.sinks, newSinkQueue(sink, &m.sinking))
+		}
+	}
+}
+
+// sinkQueue writes results to one sink in order, off the check workers, so
+// that a slow or failing sink neither holds a worker nor delays the other
+// sinks.
+type sinkQueue struct {
+	sink    ResultSink
+	results chan monitor.MonitorResponser
+	start   sync.Once
+	pending *sync.WaitGroup // Shared by the queues of a manager
+}
+
+func newSinkQueue(sink ResultSink, pending *sync.WaitGroup) *sinkQueue {
+	return &sinkQueue{
+		sink:    sink,
+		results: make(chan monitor.MonitorResponser, sinkQueueSize),
+		pending: pending,
+	}
+}
+
+// enqueue queues result to be written, dropping it when the queue is full.
+// The writing goroutine is started on first use, and lives as long as the
+// process.
+func (q *sinkQueue) enqueue(result monitor.MonitorResponser) {
+	q.start.Do(func() { go q.run() })
+
+	q.pending.Add(1)
+	select {
+	case q.results <- result:
+	default:
+		q.pending.Done()
+		logging.Logger.Sugar().With("monitorID", result.GetBaseMonitorResponse().MonitorID).Errorf("queue of result sink %T full, dropping result", q.sink)
+		metrics.DroppedSinkResults.Inc()
+	}
+}
+
+func (q *sinkQueue) run() {
+	for result := range q.results {
+		ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+		if err := q.sink.Save(ctx, result); err != nil {
+			logging.Logger.Sugar().With("monitorID", result.GetBaseMonitorResponse().MonitorID).Errorf("failed to save result to %T: %v", q.sink, err)
+		}
+		cancel()
+		q.pending.Done()
+	}
+}
+
+// sink queues result for every sink. Failures are logged, and don't fail the
+// check.
+func (m *Manager) sink(result monitor.MonitorResponser) {
+	for _, queue := range m.sinks {
+		queue.enqueue(result)
+	}
+}
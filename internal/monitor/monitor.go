@@ -2,21 +2,115 @@ package monitor
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"shraga/internal/logging"
+	"sync/atomic"
 	"time"
 
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 )
 
-var now = time.Now
-
 //go:generate stringer -type MonitorType -trimprefix Type
 type MonitorType int
 
 const (
 	TypeUnknown MonitorType = iota
 	TypeHTTP
+	TypeFTP
+	TypeSFTP
+	TypeGRPC
+	TypeTCP
+	TypeSitemap
 )
 
+// New returns an empty monitor of the given type.
+func New(monitorType MonitorType) (Monitorer, error) {
+	switch monitorType {
+	case TypeHTTP:
+		return &HttpMonitor{BaseMonitor: BaseMonitor{Type: TypeHTTP}}, nil
+	case TypeFTP:
+		return &FtpMonitor{BaseMonitor: BaseMonitor{Type: TypeFTP}}, nil
+	case TypeSFTP:
+		return &SftpMonitor{BaseMonitor: BaseMonitor{Type: TypeSFTP}}, nil
+	case TypeGRPC:
+		return &GrpcMonitor{BaseMonitor: BaseMonitor{Type: TypeGRPC}}, nil
+	case TypeTCP:
+		return &TcpMonitor{BaseMonitor: BaseMonitor{Type: TypeTCP}}, nil
+	case TypeSitemap:
+		return &SitemapMonitor{BaseMonitor: BaseMonitor{Type: TypeSitemap}}, nil
+	default:
+		return nil, fmt.Errorf("unknown type: %s", monitorType)
+	}
+}
+
+// minIntervals holds the shortest interval each type may be checked at,
+// reflecting how expensive its checks are.
+var minIntervals = map[MonitorType]time.Duration{
+	TypeHTTP: 5 * time.Second,
+	TypeFTP:  30 * time.Second,
+	TypeSFTP: 30 * time.Second,
+	TypeGRPC: 5 * time.Second,
+	TypeTCP:  1 * time.Second,
+	// Checks every URL of the sitemap
+	TypeSitemap: 5 * time.Minute,
+}
+
+// latencyEMAAlpha weighs the latest latency in LatencyEMA. Lower values
+// smooth more.
+const latencyEMAAlpha = 0.2
+
+// defaultInterval is applied on save to monitors without an Interval, in
+// nanoseconds
+var defaultInterval atomic.Int64
+
+func init() {
+	defaultInterval.Store(int64(time.Minute))
+}
+
+// SetDefaultInterval sets the interval given to monitors saved without one.
+// It defaults to a minute.
+func SetDefaultInterval(d time.Duration) {
+	defaultInterval.Store(int64(d))
+}
+
+// notifierNames are the notifiers monitors may select, any when nil
+var notifierNames atomic.Pointer[[]string]
+
+// SetNotifierNames sets the notifiers monitors may select in Notifiers.
+// Saving a monitor that selects another is rejected.
+func SetNotifierNames(names []string) {
+	notifierNames.Store(&names)
+}
+
+// validateNotifiers rejects notifiers that aren't configured. Partial updates,
+// e.g. of the runtime state, don't write Notifiers and aren't checked, so
+// removing a notifier doesn't stop the monitors that still select it.
+func (b *BaseMonitor) validateNotifiers(tx *gorm.DB) error {
+	if tx != nil && tx.Statement != nil {
+		if _, partial := tx.Statement.Dest.(map[string]any); partial {
+			return nil
+		}
+	}
+	names := notifierNames.Load()
+	if names == nil {
+		return nil
+	}
+	for _, name := range b.Notifiers {
+		if !lo.Contains(*names, name) {
+			return fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	return nil
+}
+
+// MinInterval returns the shortest interval monitors of type t may be
+// checked at. Shorter intervals are raised to it on save.
+func (t MonitorType) MinInterval() time.Duration {
+	return minIntervals[t]
+}
+
 //go:generate stringer -type Result -trimprefix Result
 type Result int
 
@@ -27,6 +121,28 @@ const (
 	ResultWarn
 )
 
+// Reason gives the specific cause of a failed check.
+//
+//go:generate stringer -type Reason -trimprefix Reason
+type Reason int
+
+const (
+	ReasonNone Reason = iota
+	ReasonRedirectLoop
+	ReasonCertChanged
+	ReasonValidatorFailed
+	ReasonDNS
+	ReasonConnRefused
+	ReasonTimeout
+	ReasonTLS
+	ReasonBodyTimeout
+	ReasonPartialOutage
+	ReasonBodyChanged
+	ReasonSustainedWarn
+	ReasonRateLimited
+	ReasonStuck
+)
+
 //go:generate mockery --name MonitorResponser --output ./mock --outpkg mock
 type MonitorResponser interface {
 	GetBaseMonitorResponse() *BaseMonitorResponse
@@ -37,9 +153,22 @@ type BaseMonitorResponse struct {
 	MonitorID    uint `gorm:"index"`
 	ResponseTime time.Time
 	Result       Result
+	Reason       Reason
 	ErrorMsg     string
 }
 
+// LatencyResponser is implemented by responses that measure the latency of
+// the check.
+type LatencyResponser interface {
+	GetLatency() time.Duration
+}
+
+// SSLExpiryResponser is implemented by responses that report the SSL expiry
+// threshold, in days, the certificate crossed in the check, or zero.
+type SSLExpiryResponser interface {
+	GetSSLExpiryThreshold() int
+}
+
 //go:generate mockery --name Monitorer --output ./mock --outpkg mock
 type Monitorer interface {
 	Monitor(context.Context) MonitorResponser
@@ -48,6 +177,24 @@ type Monitorer interface {
 	GetBase() *BaseMonitor
 }
 
+// StatefulMonitor is implemented by monitors that carry state from one check
+// to the next. The returned columns are persisted when the monitor is unlocked.
+type StatefulMonitor interface {
+	RuntimeState() map[string]any
+}
+
+// AddressedMonitor is implemented by monitors that report the address they
+// check, e.g. for notifications.
+type AddressedMonitor interface {
+	GetAddress() string
+}
+
+// TimedMonitor is implemented by monitors whose checks are bounded by their
+// own timeouts. GetTimeout returns the longest a check should run.
+type TimedMonitor interface {
+	GetTimeout() time.Duration
+}
+
 type BaseMonitor struct {
 	ID              uint          `gorm:"primaryKey"`
 	Type            MonitorType   `gorm:"index"`
@@ -56,22 +203,238 @@ type BaseMonitor struct {
 	Enabled         bool
 	LastMonitorTime time.Time
 	IsMonitoring    bool
+	LastResult      Result // Result of the latest check
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
+	// Due and waiting for a worker of any replica to claim it, set by the
+	// elected scheduler under leader election
+	Dispatched bool `gorm:"not null;default:false"`
+	// Checks in a row that were down, reset by any other result
+	ConsecutiveFailures int
+	// Checks in a row that warned, and when the first of them ran
+	ConsecutiveWarnings int
+	WarningSince        time.Time
+	// Exponential moving average of the latency of checks that weren't down,
+	// in milliseconds
+	LatencyEMA float64
+	// IDs of monitors this one depends on. While any of them is down the
+	// check is skipped if SkipWhenDependencyDown is set.
+	DependsOn              []uint `gorm:"-"`
+	DependsOnJSON          string `json:"-"`
+	SkipWhenDependencyDown bool
+	// Set while a transition suppressed because a dependency was down waits
+	// for it to recover, with the result the monitor had before
+	SuppressedTransition bool
+	SuppressedFrom       Result
+	// Promote a sustained warning to down, after WarnPromoteAfter checks in a
+	// row that warned or once warning for WarnPromoteFor. Zero disables either.
+	WarnPromoteAfter  int
+	WarnPromoteForInt int64         `gorm:"column:warn_promote_for"`
+	WarnPromoteFor    time.Duration `gorm:"-"`
+	// Roll results up per minute and purge raw results older than
+	// RawRetention. Both fall back to the global default when unset.
+	AggregateResults *bool
+	RawRetentionInt  int64         `gorm:"column:raw_retention"`
+	RawRetention     time.Duration `gorm:"-"`
+	// How long results are kept, falling back to the global default when zero
+	ResultRetentionInt int64         `gorm:"column:result_retention"`
+	ResultRetention    time.Duration `gorm:"-"`
+	// Labels for grouping monitors, e.g. {"region": "eu"}
+	Tags     map[string]string `gorm:"-"`
+	TagsJSON string            `json:"-"`
+	// Team and contact owning the monitor, used to route its notifications
+	OwnerTeam  string `gorm:"index"`
+	OwnerEmail string `gorm:"index"`
+	// Names of the notifiers alerted of the monitor's changes, e.g.
+	// ["slack", "webhook"]. Empty alerts every notifier.
+	Notifiers     []string `gorm:"-"`
+	NotifiersJSON string   `json:"-"`
+	// Notifications are suppressed until then, while checks keep running
+	SnoozeUntil time.Time
+	// The next check waits until then, e.g. as asked by a Retry-After header
+	DeferUntil time.Time
+	// Clock overrides the wall clock for this monitor, e.g. for simulation.
+	Clock func() time.Time `gorm:"-" json:"-"`
 }
 
 func (b *BaseMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	if b.Interval == 0 {
+		b.Interval = time.Duration(defaultInterval.Load())
+	}
+	if b.Interval < b.Type.MinInterval() {
+		b.Interval = b.Type.MinInterval()
+	}
 	// Serialize duration as nanoseconds
 	b.IntervalInt = int64(b.Interval)
+
+	if b.RawRetention != 0 && b.RawRetention < MinRawRetention {
+		b.RawRetention = MinRawRetention
+	}
+	b.RawRetentionInt = int64(b.RawRetention)
+	b.ResultRetentionInt = int64(b.ResultRetention)
+	b.WarnPromoteForInt = int64(b.WarnPromoteFor)
+
+	if b.Tags != nil {
+		b.TagsJSON, err = marshalColumn("tags_json", b.Tags)
+		if err != nil {
+			return
+		}
+	}
+
+	if b.DependsOn != nil {
+		if lo.Contains(b.DependsOn, b.ID) && b.ID != 0 {
+			return fmt.Errorf("monitor %d cannot depend on itself", b.ID)
+		}
+
+		b.DependsOnJSON, err = marshalColumn("depends_on_json", b.DependsOn)
+		if err != nil {
+			return
+		}
+	}
+
+	if b.Notifiers != nil {
+		if err = b.validateNotifiers(tx); err != nil {
+			return
+		}
+		b.NotifiersJSON, err = marshalColumn("notifiers_json", b.Notifiers)
+		if err != nil {
+			return
+		}
+	}
 	return nil
 }
 
 func (b *BaseMonitor) AfterFind(tx *gorm.DB) (err error) {
 	// Deserialize interval to time.Duration
 	b.Interval = time.Duration(b.IntervalInt)
+	b.RawRetention = time.Duration(b.RawRetentionInt)
+	b.ResultRetention = time.Duration(b.ResultRetentionInt)
+	b.WarnPromoteFor = time.Duration(b.WarnPromoteForInt)
+
+	if b.TagsJSON != "" {
+		if err := unmarshalColumn(b.ID, "tags_json", b.TagsJSON, &b.Tags); err != nil {
+			return err
+		}
+	}
+
+	if b.DependsOnJSON != "" {
+		if err := unmarshalColumn(b.ID, "depends_on_json", b.DependsOnJSON, &b.DependsOn); err != nil {
+			return err
+		}
+	}
+
+	if b.NotifiersJSON != "" {
+		if err := unmarshalColumn(b.ID, "notifiers_json", b.NotifiersJSON, &b.Notifiers); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// RuntimeState returns the check state to persist after each run.
+func (b *BaseMonitor) RuntimeState() map[string]any {
+	return map[string]any{
+		"last_result":           b.LastResult,
+		"latency_ema":           b.LatencyEMA,
+		"consecutive_failures":  b.ConsecutiveFailures,
+		"consecutive_warnings":  b.ConsecutiveWarnings,
+		"warning_since":         b.WarningSince,
+		"defer_until":           b.DeferUntil,
+		"suppressed_transition": b.SuppressedTransition,
+		"suppressed_from":       b.SuppressedFrom,
+	}
+}
+
+// RecordResult updates the runtime state of the monitor with the result of a
+// check. A warning sustained past WarnPromoteAfter or WarnPromoteFor is
+// promoted to down in result.
+func (b *BaseMonitor) RecordResult(result MonitorResponser) {
+	b.ObserveLatency(result)
+	b.promoteSustainedWarning(result.GetBaseMonitorResponse())
+
+	b.LastResult = result.GetBaseMonitorResponse().Result
+	if b.LastResult == ResultDown {
+		b.ConsecutiveFailures++
+	} else {
+		b.ConsecutiveFailures = 0
+	}
+}
+
+// promoteSustainedWarning tracks the warning streak of the monitor, and turns
+// resp down when it lasted too long.
+func (b *BaseMonitor) promoteSustainedWarning(resp *BaseMonitorResponse) {
+	if resp.Result != ResultWarn {
+		b.ConsecutiveWarnings = 0
+		b.WarningSince = time.Time{}
+		return
+	}
+
+	checkedAt := resp.ResponseTime
+	if checkedAt.IsZero() {
+		checkedAt = b.Now()
+	}
+	if b.ConsecutiveWarnings == 0 {
+		b.WarningSince = checkedAt
+	}
+	b.ConsecutiveWarnings++
+
+	warningFor := checkedAt.Sub(b.WarningSince)
+	sustained := (b.WarnPromoteAfter > 0 && b.ConsecutiveWarnings >= b.WarnPromoteAfter) ||
+		(b.WarnPromoteFor > 0 && warningFor >= b.WarnPromoteFor)
+	if !sustained {
+		return
+	}
+
+	msg := fmt.Sprintf("warning for %d checks over %s", b.ConsecutiveWarnings, warningFor.Round(time.Second))
+	if resp.ErrorMsg != "" {
+		msg += ": " + resp.ErrorMsg
+	}
+	resp.Result = ResultDown
+	resp.Reason = ReasonSustainedWarn
+	resp.ErrorMsg = msg
+}
+
+// ObserveLatency folds the latency of result into LatencyEMA. Results that
+// are down are skipped, as their latency is usually a timeout.
+func (b *BaseMonitor) ObserveLatency(result MonitorResponser) {
+	latency, ok := result.(LatencyResponser)
+	if !ok || result.GetBaseMonitorResponse().Result == ResultDown {
+		return
+	}
+
+	ms := float64(latency.GetLatency()) / float64(time.Millisecond)
+	if b.LatencyEMA == 0 {
+		b.LatencyEMA = ms
+		return
+	}
+	b.LatencyEMA += latencyEMAAlpha * (ms - b.LatencyEMA)
+}
+
+// Now returns the current time according to the monitor's clock.
+func (b *BaseMonitor) Now() time.Time {
+	if b.Clock != nil {
+		return b.Clock()
+	}
+	return time.Now()
+}
+
+// Due reports whether the monitor should be checked at now: its interval
+// elapsed since the latest check, and the check isn't deferred.
+func (b *BaseMonitor) Due(now time.Time) bool {
+	return b.LastMonitorTime.Add(b.Interval).Before(now) && !now.Before(b.DeferUntil)
+}
+
+// Overdue returns how long past its due time the monitor is at now. A
+// monitor that was never checked is overdue since long before any other.
+func (b *BaseMonitor) Overdue(now time.Time) time.Duration {
+	return now.Sub(b.LastMonitorTime.Add(b.Interval))
+}
+
+// Snoozed reports whether the notifications of the monitor are suppressed.
+func (b *BaseMonitor) Snoozed() bool {
+	return b.Now().Before(b.SnoozeUntil)
+}
+
 func (b *BaseMonitor) GetBase() (*BaseMonitor) {
 	return b
 }
@@ -87,3 +450,35 @@ func (b *BaseMonitor) IsEnabled() bool {
 func (b *BaseMonitor) GetType() MonitorType {
 	return b.Type
 }
+
+// maxColumnJSONBytes bounds the JSON stored in one column, so that a corrupt
+// or oversized row fails to load instead of exhausting memory.
+const maxColumnJSONBytes = 64 << 10
+
+// marshalColumn serializes v for storage in column.
+func marshalColumn(column string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", column, err)
+	}
+	if len(data) > maxColumnJSONBytes {
+		return "", fmt.Errorf("%s is %d bytes, over the %d bytes limit", column, len(data), maxColumnJSONBytes)
+	}
+	return string(data), nil
+}
+
+// unmarshalColumn deserializes column of monitor id into v, logging the
+// monitor when the stored value is oversized or corrupt.
+func unmarshalColumn(id uint, column, data string, v any) error {
+	var err error
+	if len(data) > maxColumnJSONBytes {
+		err = fmt.Errorf("%s is %d bytes, over the %d bytes limit", column, len(data), maxColumnJSONBytes)
+	} else if unmarshalErr := json.Unmarshal([]byte(data), v); unmarshalErr != nil {
+		err = fmt.Errorf("%s: %w", column, unmarshalErr)
+	}
+	if err != nil {
+		logging.Logger.Sugar().Errorf("Monitor %d has a corrupt %s: %v", id, column, err)
+		return fmt.Errorf("monitor %d: %w", id, err)
+	}
+	return nil
+}
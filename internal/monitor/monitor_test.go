@@ -0,0 +1,179 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestBaseMonitor_BeforeSave_MinInterval(t *testing.T) {
+	tm := &TcpMonitor{BaseMonitor: BaseMonitor{Interval: 100 * time.Millisecond}, Host: "example.com", Ports: []int{22}}
+	assert.NoError(t, tm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, time.Second, tm.Interval)
+
+	fm := &FtpMonitor{BaseMonitor: BaseMonitor{Interval: 5 * time.Second}}
+	assert.NoError(t, fm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, 30*time.Second, fm.Interval)
+	assert.Equal(t, int64(30*time.Second), fm.IntervalInt)
+
+	hm := &HttpMonitor{BaseMonitor: BaseMonitor{Interval: time.Minute}}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, time.Minute, hm.Interval)
+}
+
+func TestBaseMonitor_BeforeSave_DefaultInterval(t *testing.T) {
+	hm := &HttpMonitor{}
+	assert.NoError(t, hm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, time.Minute, hm.Interval)
+
+	SetDefaultInterval(2 * time.Second)
+	t.Cleanup(func() { SetDefaultInterval(time.Minute) })
+	// The default is still raised to the type's minimum
+	fm := &FtpMonitor{}
+	assert.NoError(t, fm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, 30*time.Second, fm.Interval)
+}
+
+func TestBaseMonitor_BeforeSave_UnknownNotifier(t *testing.T) {
+	b := &BaseMonitor{Notifiers: []string{"pager"}}
+	assert.NoError(t, b.BeforeSave(&gorm.DB{}), "any notifier is accepted until they're set")
+
+	SetNotifierNames([]string{"slack", "webhook"})
+	t.Cleanup(func() { notifierNames.Store(nil) })
+	assert.EqualError(t, b.BeforeSave(&gorm.DB{}), `unknown notifier "pager"`)
+
+	// Runtime state updates don't rewrite Notifiers
+	partial := &gorm.DB{Statement: &gorm.Statement{Dest: map[string]any{"last_result": ResultUp}}}
+	assert.NoError(t, b.BeforeSave(partial))
+
+	b.Notifiers = []string{"webhook"}
+	assert.NoError(t, b.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, `["webhook"]`, b.NotifiersJSON)
+}
+
+func TestHttpMonitor_AfterFind_OversizedColumn(t *testing.T) {
+	hm := &HttpMonitor{
+		BaseMonitor:    BaseMonitor{ID: 7},
+		ReqHeadersJSON: `{"X-Padding": "` + strings.Repeat("a", maxColumnJSONBytes) + `"}`,
+	}
+	err := hm.AfterFind(&gorm.DB{})
+	assert.ErrorContains(t, err, "monitor 7: req_headers_json is")
+	assert.Nil(t, hm.ReqHeaders)
+
+	hm.ReqHeadersJSON = `{"Accept": `
+	assert.ErrorContains(t, hm.AfterFind(&gorm.DB{}), "monitor 7: req_headers_json: unexpected end of JSON input")
+
+	hm.ReqHeadersJSON = `{"Accept": "text/plain"}`
+	assert.NoError(t, hm.AfterFind(&gorm.DB{}))
+	assert.Equal(t, map[string]string{"Accept": "text/plain"}, hm.ReqHeaders)
+}
+
+func TestHttpMonitor_BeforeSave_OversizedColumn(t *testing.T) {
+	hm := &HttpMonitor{
+		Address:          "https://example.com",
+		ValidStatusCodes: make([]int, maxColumnJSONBytes),
+	}
+	assert.ErrorContains(t, hm.BeforeSave(&gorm.DB{}), "valid_status_codes_json is")
+}
+
+func TestBaseMonitor_ObserveLatency(t *testing.T) {
+	b := &BaseMonitor{}
+	up := func(ms int64) *HttpResponse {
+		return &HttpResponse{BaseMonitorResponse: BaseMonitorResponse{Result: ResultUp}, Latency: ms}
+	}
+
+	b.ObserveLatency(up(100))
+	assert.Equal(t, 100.0, b.LatencyEMA, "the first latency should seed the average")
+
+	b.ObserveLatency(up(200))
+	assert.InDelta(t, 120.0, b.LatencyEMA, 0.001)
+
+	// Timeouts of down checks don't skew the average
+	b.ObserveLatency(&HttpResponse{BaseMonitorResponse: BaseMonitorResponse{Result: ResultDown}, Latency: 30000})
+	assert.InDelta(t, 120.0, b.LatencyEMA, 0.001)
+}
+
+func TestBaseMonitor_RecordResult(t *testing.T) {
+	b := &BaseMonitor{}
+	result := func(r Result) *HttpResponse {
+		return &HttpResponse{BaseMonitorResponse: BaseMonitorResponse{Result: r}}
+	}
+
+	b.RecordResult(result(ResultDown))
+	b.RecordResult(result(ResultDown))
+	assert.Equal(t, ResultDown, b.LastResult)
+	assert.Equal(t, 2, b.ConsecutiveFailures)
+
+	b.RecordResult(result(ResultWarn))
+	assert.Equal(t, ResultWarn, b.LastResult)
+	assert.Equal(t, 0, b.ConsecutiveFailures)
+}
+
+func TestBaseMonitor_RecordResult_PromotesSustainedWarning(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	warn := func(at time.Duration) *HttpResponse {
+		return &HttpResponse{BaseMonitorResponse: BaseMonitorResponse{Result: ResultWarn, ResponseTime: start.Add(at), ErrorMsg: "slow"}}
+	}
+
+	b := &BaseMonitor{WarnPromoteAfter: 3}
+	b.RecordResult(warn(0))
+	b.RecordResult(warn(time.Minute))
+	assert.Equal(t, ResultWarn, b.LastResult)
+	promoted := warn(2 * time.Minute)
+	b.RecordResult(promoted)
+	assert.Equal(t, ResultDown, promoted.Result)
+	assert.Equal(t, ReasonSustainedWarn, promoted.Reason)
+	assert.Equal(t, "warning for 3 checks over 2m0s: slow", promoted.ErrorMsg)
+	assert.Equal(t, 1, b.ConsecutiveFailures)
+
+	// Recovering resets the streak
+	b.RecordResult(&HttpResponse{BaseMonitorResponse: BaseMonitorResponse{Result: ResultUp}})
+	assert.Equal(t, 0, b.ConsecutiveWarnings)
+	assert.True(t, b.WarningSince.IsZero())
+
+	b = &BaseMonitor{WarnPromoteFor: 10 * time.Minute}
+	b.RecordResult(warn(0))
+	notYet := warn(9 * time.Minute)
+	b.RecordResult(notYet)
+	assert.Equal(t, ResultWarn, notYet.Result)
+	promoted = warn(10 * time.Minute)
+	b.RecordResult(promoted)
+	assert.Equal(t, ResultDown, promoted.Result)
+	assert.Equal(t, start, b.WarningSince)
+
+	// Without thresholds warnings are never promoted
+	b = &BaseMonitor{}
+	for i := 0; i < 10; i++ {
+		b.RecordResult(warn(time.Duration(i) * time.Hour))
+	}
+	assert.Equal(t, ResultWarn, b.LastResult)
+}
+
+func TestBaseMonitor_Due(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := &BaseMonitor{Interval: time.Minute, LastMonitorTime: now.Add(-2 * time.Minute)}
+	assert.True(t, b.Due(now))
+
+	b.DeferUntil = now.Add(time.Minute)
+	assert.False(t, b.Due(now))
+	assert.True(t, b.Due(now.Add(time.Minute)))
+
+	b.LastMonitorTime = now.Add(-30 * time.Second)
+	b.DeferUntil = time.Time{}
+	assert.False(t, b.Due(now))
+}
+
+func TestBaseMonitor_Overdue(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := &BaseMonitor{Interval: time.Minute, LastMonitorTime: now.Add(-3 * time.Minute)}
+	assert.Equal(t, 2*time.Minute, b.Overdue(now))
+
+	b.LastMonitorTime = now.Add(-30 * time.Second)
+	assert.Equal(t, -30*time.Second, b.Overdue(now))
+
+	never := &BaseMonitor{Interval: time.Minute}
+	assert.Greater(t, never.Overdue(now), b.Overdue(now))
+}
@@ -10,11 +10,16 @@ func _() {
 	var x [1]struct{}
 	_ = x[TypeUnknown-0]
 	_ = x[TypeHTTP-1]
+	_ = x[TypeFTP-2]
+	_ = x[TypeSFTP-3]
+	_ = x[TypeGRPC-4]
+	_ = x[TypeTCP-5]
+	_ = x[TypeSitemap-6]
 }
 
-const _MonitorType_name = "UnknownHTTP"
+const _MonitorType_name = "UnknownHTTPFTPSFTPGRPCTCPSitemap"
 
-var _MonitorType_index = [...]uint8{0, 7, 11}
+var _MonitorType_index = [...]uint8{0, 7, 11, 14, 18, 22, 25, 32}
 
 func (i MonitorType) String() string {
 	if i < 0 || i >= MonitorType(len(_MonitorType_index)-1) {
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseMonitorType returns the MonitorType named s, case-insensitively,
+// e.g. "http" or "SFTP".
+func ParseMonitorType(s string) (MonitorType, error) {
+	for t := TypeUnknown + 1; int(t) < len(_MonitorType_index)-1; t++ {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return TypeUnknown, fmt.Errorf("unknown monitor type %q", s)
+}
+
+// ParseResult returns the Result named s, case-insensitively, e.g. "up".
+func ParseResult(s string) (Result, error) {
+	for r := ResultUnknown; int(r) < len(_Result_index)-1; r++ {
+		if strings.EqualFold(s, r.String()) {
+			return r, nil
+		}
+	}
+	return ResultUnknown, fmt.Errorf("unknown result %q", s)
+}
+
+// UnmarshalJSON accepts either the numeric value or the name of the type.
+func (t *MonitorType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return json.Unmarshal(data, (*int)(t))
+	}
+
+	parsed, err := ParseMonitorType(name)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// UnmarshalJSON accepts either the numeric value or the name of the result.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return json.Unmarshal(data, (*int)(r))
+	}
+
+	parsed, err := ParseResult(name)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
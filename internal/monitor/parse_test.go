@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMonitorType(t *testing.T) {
+	for name, expected := range map[string]MonitorType{
+		"http": TypeHTTP,
+		"FTP":  TypeFTP,
+		"Sftp": TypeSFTP,
+		"grpc": TypeGRPC,
+	} {
+		parsed, err := ParseMonitorType(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, parsed)
+	}
+
+	_, err := ParseMonitorType("unknown")
+	assert.EqualError(t, err, `unknown monitor type "unknown"`)
+}
+
+func TestParseResult(t *testing.T) {
+	parsed, err := ParseResult("up")
+	assert.NoError(t, err)
+	assert.Equal(t, ResultUp, parsed)
+
+	parsed, err = ParseResult("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, ResultWarn, parsed)
+
+	_, err = ParseResult("sideways")
+	assert.Error(t, err)
+}
+
+func TestMonitorType_UnmarshalJSON(t *testing.T) {
+	var header struct {
+		Type   MonitorType
+		Result Result
+	}
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"Type": "http", "Result": "down"}`), &header))
+	assert.Equal(t, TypeHTTP, header.Type)
+	assert.Equal(t, ResultDown, header.Result)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"Type": 2, "Result": 1}`), &header))
+	assert.Equal(t, TypeFTP, header.Type)
+	assert.Equal(t, ResultUp, header.Result)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"Type": "gopher"}`), &header))
+}
@@ -0,0 +1,36 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// StuckResponse returns the result of a check of mon abandoned after running
+// for timeout.
+func StuckResponse(mon Monitorer, timeout time.Duration) (MonitorResponser, error) {
+	return newResponse(mon, BaseMonitorResponse{
+		MonitorID:    mon.GetBase().ID,
+		ResponseTime: mon.GetBase().Now(),
+		Result:       ResultDown,
+		Reason:       ReasonStuck,
+		ErrorMsg:     fmt.Sprintf("check abandoned after running for %s", timeout),
+	}, timeout.Milliseconds())
+}
+
+// newResponse returns the response type of mon holding base and latency, in
+// milliseconds.
+func newResponse(mon Monitorer, base BaseMonitorResponse, latency int64) (MonitorResponser, error) {
+	switch mon.GetType() {
+	case TypeHTTP:
+		return &HttpResponse{BaseMonitorResponse: base, Latency: latency}, nil
+	case TypeFTP, TypeSFTP:
+		return &FileTransferResponse{BaseMonitorResponse: base, Latency: latency}, nil
+	case TypeGRPC:
+		return &GrpcResponse{BaseMonitorResponse: base, Latency: latency}, nil
+	case TypeTCP:
+		return &TcpResponse{BaseMonitorResponse: base, Latency: latency}, nil
+	case TypeSitemap:
+		return &SitemapResponse{BaseMonitorResponse: base, Latency: latency}, nil
+	}
+	return nil, fmt.Errorf("unknown type: %s", mon.GetType())
+}
@@ -0,0 +1,30 @@
+package monitor
+
+import "time"
+
+// MinRawRetention is the shortest window of raw results kept for monitors
+// aggregating results. Shorter RawRetention is raised to it on save.
+const MinRawRetention = 5 * time.Minute
+
+// ResultRollup aggregates one minute of a monitor's results. Monitors
+// aggregating results keep only a short window of raw results, while their
+// rollups are retained long-term.
+type ResultRollup struct {
+	MonitorID  uint      `gorm:"primaryKey;autoIncrement:false"`
+	Bucket     time.Time `gorm:"primaryKey"` // Start of the minute
+	Count      int64
+	UpCount    int64
+	DownCount  int64
+	WarnCount  int64
+	MinLatency int64 // Milliseconds
+	MaxLatency int64 // Milliseconds
+	SumLatency int64 // Milliseconds
+}
+
+// AvgLatency returns the mean latency of the bucket in milliseconds.
+func (r ResultRollup) AvgLatency() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return float64(r.SumLatency) / float64(r.Count)
+}
@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Redacted replaces secrets in JSON output, e.g. of exported monitors.
+const Redacted = "<redacted>"
+
+// Secret is a credential stored with a monitor. It's redacted when encoded
+// as JSON or formatted, so it can't leak through exports or logs; convert it
+// to a string to use it.
+type Secret string
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return json.Marshal("")
+	}
+	return json.Marshal(Redacted)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// IsCredentialHeader reports whether the header name usually carries a
+// credential, e.g. Authorization or X-Api-Key.
+func IsCredentialHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Proxy-Authorization", "Cookie":
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, part := range []string{"token", "secret", "password", "api-key", "apikey", "auth"} {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"shraga/internal/logging"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+type SftpMonitor struct {
+	BaseMonitor
+	FileTransferConfig
+	PrivateKey Secret // PEM encoded, used instead of Password when set
+	HostKey    string // authorized_keys format; any host key is accepted when empty
+}
+
+func (sm *SftpMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	sm.Type = TypeSFTP
+	err = sm.BaseMonitor.BeforeSave(tx)
+	if err != nil {
+		return
+	}
+	if err = sm.FileTransferConfig.beforeSave(); err != nil {
+		return
+	}
+
+	if sm.PrivateKey != "" {
+		if _, err = ssh.ParsePrivateKey([]byte(sm.PrivateKey)); err != nil {
+			return fmt.Errorf("invalid private key: %w", err)
+		}
+	}
+	if sm.HostKey != "" {
+		if _, _, _, _, err = ssh.ParseAuthorizedKey([]byte(sm.HostKey)); err != nil {
+			return fmt.Errorf("invalid host key: %w", err)
+		}
+	}
+	return nil
+}
+
+func (sm *SftpMonitor) AfterFind(tx *gorm.DB) (err error) {
+	err = sm.BaseMonitor.AfterFind(tx)
+	if err != nil {
+		return
+	}
+	sm.FileTransferConfig.afterFind()
+	return nil
+}
+
+func (sm *SftpMonitor) Monitor(ctx context.Context) MonitorResponser {
+	logging.Logger.Sugar().Infof("Start monitoring: %d", sm.ID)
+
+	monitorResult := &FileTransferResponse{
+		BaseMonitorResponse: BaseMonitorResponse{
+			MonitorID:    sm.ID,
+			Result:       ResultDown,
+			ResponseTime: sm.Now(),
+		},
+	}
+
+	sshConfig, err := sm.clientConfig()
+	if err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sm.Timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	address := sm.hostPort("22")
+	dialer := newDialer()
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		monitorResult.Reason = classifyError(err)
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	defer netConn.Close()
+
+	// The SSH handshake and SFTP requests don't take a context, bound them by
+	// the connection deadline instead
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, address, sshConfig)
+	if err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	defer sshClient.Close()
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		monitorResult.ErrorMsg = err.Error()
+		return monitorResult
+	}
+	defer client.Close()
+
+	if sm.ListDir != "" {
+		if _, err := client.ReadDir(sm.ListDir); err != nil {
+			monitorResult.ErrorMsg = err.Error()
+			return monitorResult
+		}
+	}
+
+	if sm.FilePath != "" {
+		if _, err := client.Stat(sm.FilePath); err != nil {
+			monitorResult.ErrorMsg = err.Error()
+			return monitorResult
+		}
+	}
+
+	monitorResult.Latency = time.Since(startTime).Milliseconds()
+	monitorResult.Result = ResultUp
+	return monitorResult
+}
+
+func (sm *SftpMonitor) clientConfig() (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		User:            sm.Username,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         sm.Timeout,
+	}
+
+	if sm.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(sm.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	} else {
+		config.Auth = []ssh.AuthMethod{ssh.Password(string(sm.Password))}
+	}
+
+	if sm.HostKey != "" {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sm.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key: %w", err)
+		}
+		config.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,338 @@
+package monitor
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"shraga/internal/logging"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSitemapConcurrency = 10
+	maxSitemapConcurrency     = 50
+	defaultSitemapMaxURLs     = 1000
+	// The most URLs a single sitemap may list, per the sitemaps protocol
+	maxSitemapURLs = 50000
+	// Longest sitemap read, protecting against endless bodies
+	maxSitemapBytes = 50 << 20
+	// Failures beyond these are counted but not listed in the response
+	maxReportedURLFailures = 100
+)
+
+// URLFailure is a URL of a sitemap that couldn't be fetched successfully.
+type URLFailure struct {
+	URL        string
+	StatusCode int `json:",omitempty"`
+	Error      string
+}
+
+// URLFailures stores the failed URLs of a SitemapMonitor check.
+type URLFailures []URLFailure
+
+// Valuer and Scanner implementation for URLFailures
+func (uf URLFailures) Value() (driver.Value, error) {
+	return json.Marshal(uf)
+}
+
+func (uf *URLFailures) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal URLFailures value: %v", value)
+	}
+
+	return json.Unmarshal(bytes, uf)
+}
+
+type SitemapResponse struct {
+	BaseMonitorResponse
+	Latency     int64 // Slowest URL to respond, in milliseconds
+	URLCount    int
+	FailedCount int
+	// The first failed URLs, in sitemap order
+	FailedURLs URLFailures
+}
+
+func (sr *SitemapResponse) GetBaseMonitorResponse() *BaseMonitorResponse {
+	return &sr.BaseMonitorResponse
+}
+
+func (sr *SitemapResponse) GetLatency() time.Duration {
+	return time.Duration(sr.Latency) * time.Millisecond
+}
+
+// SitemapMonitor checks that every URL listed in the sitemap at SitemapURL
+// responds with a 2xx status. Sitemap indexes are followed one level deep.
+type SitemapMonitor struct {
+	BaseMonitor
+	SitemapURL string
+	// URLs checked at once, defaulting to 10
+	Concurrency int
+	// URLs checked at most, the first ones of the sitemap; defaults to 1000
+	MaxURLs int
+	// Fraction of URLs that may fail with the check only warning, e.g. 0.01
+	// for 1%. Zero fails the check on any URL failing.
+	FailureTolerance float64
+	ReqTimeoutInt    int64         `gorm:"column:req_timeout"`
+	ReqTimeout       time.Duration `gorm:"-"` // Per URL
+}
+
+func (sm *SitemapMonitor) GetAddress() string {
+	return sm.SitemapURL
+}
+
+func (sm *SitemapMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	sm.Type = TypeSitemap
+	err = sm.BaseMonitor.BeforeSave(tx)
+	if err != nil {
+		return
+	}
+
+	parsedURL, err := url.Parse(sm.SitemapURL)
+	if err != nil {
+		return fmt.Errorf("invalid sitemap URL: %w", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("sitemap URL must be http or https, got %q", sm.SitemapURL)
+	}
+	if err = validateTarget(parsedURL.Hostname()); err != nil {
+		return
+	}
+
+	if sm.FailureTolerance < 0 || sm.FailureTolerance > 1 {
+		return fmt.Errorf("failure tolerance must be between 0 and 1, got %g", sm.FailureTolerance)
+	}
+
+	if sm.Concurrency <= 0 {
+		sm.Concurrency = defaultSitemapConcurrency
+	} else if sm.Concurrency > maxSitemapConcurrency {
+		sm.Concurrency = maxSitemapConcurrency
+	}
+	if sm.MaxURLs <= 0 {
+		sm.MaxURLs = defaultSitemapMaxURLs
+	} else if sm.MaxURLs > maxSitemapURLs {
+		sm.MaxURLs = maxSitemapURLs
+	}
+
+	if sm.ReqTimeout == 0 {
+		sm.ReqTimeout = defaultHttpClientTimeout
+	} else if sm.ReqTimeout > maxHttpClientTimeout {
+		sm.ReqTimeout = maxHttpClientTimeout
+	} else if sm.ReqTimeout < minHttpClientTimeout {
+		sm.ReqTimeout = minHttpClientTimeout
+	}
+	sm.ReqTimeoutInt = int64(sm.ReqTimeout)
+	return nil
+}
+
+func (sm *SitemapMonitor) AfterFind(tx *gorm.DB) (err error) {
+	err = sm.BaseMonitor.AfterFind(tx)
+	if err != nil {
+		return
+	}
+
+	sm.ReqTimeout = time.Duration(sm.ReqTimeoutInt)
+	return nil
+}
+
+func (sm *SitemapMonitor) Monitor(ctx context.Context) MonitorResponser {
+	logging.Logger.Sugar().Infof("Start monitoring: %d", sm.ID)
+
+	monitorResult := &SitemapResponse{
+		BaseMonitorResponse: BaseMonitorResponse{
+			MonitorID:    sm.ID,
+			Result:       ResultDown,
+			ResponseTime: sm.Now(),
+		},
+	}
+
+	urls, err := sm.fetchURLs(ctx)
+	if err != nil {
+		monitorResult.Reason = classifyError(err)
+		monitorResult.ErrorMsg = fmt.Sprintf("failed to fetch sitemap: %v", err)
+		return monitorResult
+	}
+	if len(urls) == 0 {
+		monitorResult.ErrorMsg = "sitemap lists no URLs"
+		return monitorResult
+	}
+	monitorResult.URLCount = len(urls)
+
+	failures := make([]*URLFailure, len(urls))
+	latencies := make([]int64, len(urls))
+	reasons := make([]Reason, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(sm.concurrency(), len(urls)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				failures[idx], latencies[idx], reasons[idx] = sm.checkURL(ctx, urls[idx])
+			}
+		}()
+	}
+	for idx := range urls {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	var firstReason Reason
+	for i, failure := range failures {
+		monitorResult.Latency = max(monitorResult.Latency, latencies[i])
+		if failure == nil {
+			continue
+		}
+		if monitorResult.FailedCount == 0 {
+			firstReason = reasons[i]
+		}
+		monitorResult.FailedCount++
+		if len(monitorResult.FailedURLs) < maxReportedURLFailures {
+			monitorResult.FailedURLs = append(monitorResult.FailedURLs, *failure)
+		}
+	}
+
+	switch {
+	case monitorResult.FailedCount == 0:
+		monitorResult.Result = ResultUp
+		return monitorResult
+	case monitorResult.FailedCount == len(urls):
+		monitorResult.Reason = firstReason
+	case float64(monitorResult.FailedCount)/float64(len(urls)) <= sm.FailureTolerance:
+		monitorResult.Result = ResultWarn
+		monitorResult.Reason = ReasonPartialOutage
+	default:
+		monitorResult.Reason = ReasonPartialOutage
+	}
+	first := monitorResult.FailedURLs[0]
+	monitorResult.ErrorMsg = fmt.Sprintf("%d of %d URLs failed, first %s: %s", monitorResult.FailedCount, len(urls), first.URL, first.Error)
+	return monitorResult
+}
+
+func (sm *SitemapMonitor) concurrency() int {
+	if sm.Concurrency <= 0 {
+		return defaultSitemapConcurrency
+	}
+	return sm.Concurrency
+}
+
+func (sm *SitemapMonitor) maxURLs() int {
+	if sm.MaxURLs <= 0 {
+		return defaultSitemapMaxURLs
+	}
+	return sm.MaxURLs
+}
+
+// client returns a client sharing the pooled transport of HTTP monitors,
+// bounding each request by ReqTimeout.
+func (sm *SitemapMonitor) client() *http.Client {
+	timeout := sm.ReqTimeout
+	if timeout <= 0 {
+		timeout = defaultHttpClientTimeout
+	}
+	return &http.Client{Transport: pooledTransport(transportKey{}), Timeout: timeout}
+}
+
+// sitemap is either a urlset listing pages or a sitemapindex listing other
+// sitemaps.
+type sitemap struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// fetchURLs returns the first MaxURLs URLs of the sitemap, following the
+// sitemaps of a sitemap index.
+func (sm *SitemapMonitor) fetchURLs(ctx context.Context) ([]string, error) {
+	root, err := sm.fetchSitemap(ctx, sm.SitemapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := locs(root.URLs)
+	for _, nested := range root.Sitemaps {
+		if len(urls) >= sm.maxURLs() {
+			break
+		}
+		loc := strings.TrimSpace(nested.Loc)
+		child, err := sm.fetchSitemap(ctx, loc)
+		if err != nil {
+			return nil, fmt.Errorf("sitemap %s: %w", loc, err)
+		}
+		urls = append(urls, locs(child.URLs)...)
+	}
+	if len(urls) > sm.maxURLs() {
+		urls = urls[:sm.maxURLs()]
+	}
+	return urls, nil
+}
+
+func locs(entries []sitemapLoc) []string {
+	urls := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		urls = append(urls, strings.TrimSpace(entry.Loc))
+	}
+	return urls
+}
+
+func (sm *SitemapMonitor) fetchSitemap(ctx context.Context, sitemapURL string) (*sitemap, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sm.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	var parsed sitemap
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxSitemapBytes)).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %w", err)
+	}
+	if parsed.XMLName.Local != "urlset" && parsed.XMLName.Local != "sitemapindex" {
+		return nil, errors.New("invalid sitemap: expected a urlset or sitemapindex")
+	}
+	return &parsed, nil
+}
+
+// checkURL requests pageURL, returning its failure, if any, how long it took
+// to respond in milliseconds, and the reason it failed.
+func (sm *SitemapMonitor) checkURL(ctx context.Context, pageURL string) (*URLFailure, int64, Reason) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return &URLFailure{URL: pageURL, Error: err.Error()}, 0, ReasonNone
+	}
+
+	startTime := time.Now()
+	resp, err := sm.client().Do(req)
+	latency := time.Since(startTime).Milliseconds()
+	if err != nil {
+		return &URLFailure{URL: pageURL, Error: err.Error()}, latency, classifyError(err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &URLFailure{URL: pageURL, StatusCode: resp.StatusCode, Error: fmt.Sprintf("unexpected status code: %d", resp.StatusCode)}, latency, ReasonNone
+	}
+	return nil, latency, ReasonNone
+}
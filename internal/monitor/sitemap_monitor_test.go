@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// sitemapServer serves a sitemap index at /sitemap.xml listing two sitemaps
+// of pages. Pages listed in missing respond 404.
+func sitemapServer(t *testing.T, pages int, missing ...string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/sitemap-1.xml</loc></sitemap>
+	<sitemap><loc> %[1]s/sitemap-2.xml </loc></sitemap>
+</sitemapindex>`, ts.URL)
+		case "/sitemap-1.xml", "/sitemap-2.xml":
+			var urls strings.Builder
+			for i := 0; i < pages/2; i++ {
+				fmt.Fprintf(&urls, "<url><loc>%s/%s/page-%d</loc></url>", ts.URL, strings.TrimSuffix(r.URL.Path[1:], ".xml"), i)
+			}
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">%s</urlset>`, urls.String())
+		default:
+			for _, path := range missing {
+				if r.URL.Path == path {
+					http.NotFound(w, r)
+					return
+				}
+			}
+			w.Write([]byte("ok"))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSitemapMonitor_Monitor(t *testing.T) {
+	ts := sitemapServer(t, 200, "/sitemap-2/page-7")
+	sm := &SitemapMonitor{SitemapURL: ts.URL + "/sitemap.xml", Concurrency: 5, FailureTolerance: 0.01}
+
+	response := sm.Monitor(context.Background()).(*SitemapResponse)
+	assert.Equal(t, ResultWarn, response.Result)
+	assert.Equal(t, ReasonPartialOutage, response.Reason)
+	assert.Equal(t, 200, response.URLCount)
+	assert.Equal(t, 1, response.FailedCount)
+	assert.Equal(t, URLFailures{{URL: ts.URL + "/sitemap-2/page-7", StatusCode: 404, Error: "unexpected status code: 404"}}, response.FailedURLs)
+	assert.Equal(t, fmt.Sprintf("1 of 200 URLs failed, first %s/sitemap-2/page-7: unexpected status code: 404", ts.URL), response.ErrorMsg)
+
+	sm.FailureTolerance = 0
+	response = sm.Monitor(context.Background()).(*SitemapResponse)
+	assert.Equal(t, ResultDown, response.Result)
+
+	sm.MaxURLs = 50
+	response = sm.Monitor(context.Background()).(*SitemapResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+	assert.Equal(t, 50, response.URLCount)
+}
+
+func TestSitemapMonitor_Monitor_InvalidSitemap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	}))
+	defer ts.Close()
+
+	sm := &SitemapMonitor{SitemapURL: ts.URL}
+	response := sm.Monitor(context.Background()).(*SitemapResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, "failed to fetch sitemap: invalid sitemap: expected a urlset or sitemapindex", response.ErrorMsg)
+}
+
+func TestSitemapMonitor_BeforeSave(t *testing.T) {
+	sm := &SitemapMonitor{SitemapURL: "https://example.com/sitemap.xml"}
+	require.NoError(t, sm.BeforeSave(&gorm.DB{}))
+	assert.Equal(t, TypeSitemap, sm.Type)
+	assert.Equal(t, 5*time.Minute, sm.Interval)
+	assert.Equal(t, defaultSitemapConcurrency, sm.Concurrency)
+	assert.Equal(t, defaultSitemapMaxURLs, sm.MaxURLs)
+	assert.Equal(t, defaultHttpClientTimeout, sm.ReqTimeout)
+
+	sm.FailureTolerance = 1.5
+	assert.Error(t, sm.BeforeSave(&gorm.DB{}))
+
+	sm = &SitemapMonitor{SitemapURL: "ftp://example.com/sitemap.xml"}
+	assert.Error(t, sm.BeforeSave(&gorm.DB{}))
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"shraga/internal/logging"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Bounds resolving a target when a monitor is saved
+const targetLookupTimeout = 5 * time.Second
+
+var (
+	targetsMu      sync.RWMutex
+	allowedTargets []netip.Prefix
+	deniedTargets  []netip.Prefix
+	lookupTarget   = net.DefaultResolver.LookupNetIP
+)
+
+// ErrTargetDenied is returned when a monitor targets an address outside the
+// networks it may reach.
+var ErrTargetDenied = errors.New("target address is not allowed")
+
+// SetTargetNetworks restricts the addresses monitors may connect to, e.g. to
+// deny cloud metadata endpoints such as 169.254.169.254/32. When allowed is
+// set, only addresses in it are reachable; denied networks are never
+// reachable. Both are enforced when a monitor is saved and when it dials.
+func SetTargetNetworks(allowed, denied []netip.Prefix) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	allowedTargets = allowed
+	deniedTargets = denied
+}
+
+func targetsRestricted() bool {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	return len(allowedTargets) > 0 || len(deniedTargets) > 0
+}
+
+func targetAllowed(addr netip.Addr) bool {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+
+	addr = addr.Unmap()
+	for _, prefix := range deniedTargets {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(allowedTargets) == 0 {
+		return true
+	}
+	for _, prefix := range allowedTargets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTarget is a net.Dialer Control function refusing to connect to
+// addresses that aren't allowed. It sees the address after resolution, so
+// DNS can't be used to reach a denied network.
+func checkTarget(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !targetAllowed(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrTargetDenied, addrPort.Addr().Unmap())
+	}
+	return nil
+}
+
+// newDialer returns a dialer refusing targets outside the allowed networks.
+func newDialer() *net.Dialer {
+	return &net.Dialer{Control: checkTarget}
+}
+
+// validateTarget rejects host when it resolves to an address that isn't
+// allowed. Hosts that fail to resolve are accepted, as the check is enforced
+// again when dialing.
+func validateTarget(host string) error {
+	if host == "" || !targetsRestricted() {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !targetAllowed(addr) {
+			return fmt.Errorf("%w: %s", ErrTargetDenied, addr.Unmap())
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), targetLookupTimeout)
+	defer cancel()
+	addrs, err := lookupTarget(ctx, "ip", host)
+	if err != nil {
+		logging.Logger.Sugar().Warnf("Failed to resolve %s to validate it, checking it when dialing: %v", host, err)
+		return nil
+	}
+	for _, addr := range addrs {
+		if !targetAllowed(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrTargetDenied, host, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// hostOf returns the host of a host[:port] address.
+func hostOf(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setTargetNetworks(t *testing.T, allowed, denied []string) {
+	parse := func(networks []string) []netip.Prefix {
+		var prefixes []netip.Prefix
+		for _, network := range networks {
+			prefixes = append(prefixes, netip.MustParsePrefix(network))
+		}
+		return prefixes
+	}
+	SetTargetNetworks(parse(allowed), parse(denied))
+	t.Cleanup(func() { SetTargetNetworks(nil, nil) })
+}
+
+func TestTargetAllowed(t *testing.T) {
+	assert.True(t, targetAllowed(netip.MustParseAddr("169.254.169.254")))
+
+	setTargetNetworks(t, nil, []string{"169.254.0.0/16"})
+	assert.False(t, targetAllowed(netip.MustParseAddr("169.254.169.254")))
+	assert.False(t, targetAllowed(netip.MustParseAddr("::ffff:169.254.169.254")))
+	assert.True(t, targetAllowed(netip.MustParseAddr("10.0.0.1")))
+
+	setTargetNetworks(t, []string{"10.0.0.0/8"}, []string{"10.1.0.0/16"})
+	assert.True(t, targetAllowed(netip.MustParseAddr("10.0.0.1")))
+	assert.False(t, targetAllowed(netip.MustParseAddr("10.1.0.1")))
+	assert.False(t, targetAllowed(netip.MustParseAddr("192.168.0.1")))
+}
+
+func TestValidateTarget(t *testing.T) {
+	originalLookup := lookupTarget
+	t.Cleanup(func() { lookupTarget = originalLookup })
+	lookupTarget = func(_ context.Context, _, host string) ([]netip.Addr, error) {
+		switch host {
+		case "metadata.internal":
+			return []netip.Addr{netip.MustParseAddr("169.254.169.254")}, nil
+		case "example.com":
+			return []netip.Addr{netip.MustParseAddr("93.184.215.14")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	setTargetNetworks(t, nil, []string{"169.254.0.0/16"})
+
+	assert.ErrorIs(t, validateTarget("metadata.internal"), ErrTargetDenied)
+	assert.ErrorIs(t, validateTarget("169.254.169.254"), ErrTargetDenied)
+	assert.NoError(t, validateTarget("example.com"))
+	// Checked again when dialing
+	assert.NoError(t, validateTarget("unresolvable.invalid"))
+
+	tm := &TcpMonitor{Host: "metadata.internal", Ports: []int{80}}
+	assert.ErrorIs(t, tm.BeforeSave(&gorm.DB{}), ErrTargetDenied)
+	hm := &HttpMonitor{Address: "http://169.254.169.254/latest/meta-data"}
+	assert.ErrorIs(t, hm.BeforeSave(&gorm.DB{}), ErrTargetDenied)
+}
+
+func TestHttpMonitor_Monitor_DeniedTarget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	setTargetNetworks(t, nil, []string{"127.0.0.0/8"})
+
+	hm := &HttpMonitor{
+		Address:       ts.URL,
+		RequestMethod: http.MethodGet,
+		ReqTimeout:    5 * time.Second,
+	}
+	response := hm.Monitor(context.Background())
+	assert.Equal(t, ResultDown, response.GetBaseMonitorResponse().Result)
+	assert.Contains(t, response.GetBaseMonitorResponse().ErrorMsg, "target address is not allowed: 127.0.0.1")
+}
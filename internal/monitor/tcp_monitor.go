@@ -0,0 +1,272 @@
+package monitor
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"shraga/internal/logging"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTcpTimeout = 10 * time.Second
+	maxTcpTimeout     = 1 * time.Minute
+	minTcpTimeout     = 100 * time.Millisecond
+	// Longest banner read when matching ExpectedBanner
+	maxBannerBytes = 512
+)
+
+// PortResult is the outcome of connecting to one port.
+type PortResult struct {
+	Port    int
+	Open    bool
+	Latency int64  // Milliseconds to connect
+	Banner  string // Greeting received, when ExpectedBanner is set
+	Error   string
+}
+
+// PortResults stores the result of every port checked by a TcpMonitor.
+type PortResults []PortResult
+
+// Valuer and Scanner implementation for PortResults
+func (pr PortResults) Value() (driver.Value, error) {
+	return json.Marshal(pr)
+}
+
+func (pr *PortResults) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal PortResults value: %v", value)
+	}
+
+	return json.Unmarshal(bytes, pr)
+}
+
+type TcpResponse struct {
+	BaseMonitorResponse
+	Latency     int64 // Slowest port to connect, in milliseconds
+	PortResults PortResults
+}
+
+func (tr *TcpResponse) GetBaseMonitorResponse() *BaseMonitorResponse {
+	return &tr.BaseMonitorResponse
+}
+
+func (tr *TcpResponse) GetLatency() time.Duration {
+	return time.Duration(tr.Latency) * time.Millisecond
+}
+
+// TcpMonitor checks that every port in Ports accepts TCP connections on Host.
+type TcpMonitor struct {
+	BaseMonitor
+	Host       string
+	Ports      []int         `gorm:"-"`
+	PortsJSON  string        `json:"-"`
+	TimeoutInt int64         `gorm:"column:timeout"`
+	Timeout    time.Duration `gorm:"-"`
+	// Regexp the greeting sent by the server on connect must match, e.g.
+	// "^SSH-2\.0" or "^220 .*ESMTP"
+	ExpectedBanner string
+}
+
+func (tm *TcpMonitor) GetAddress() string {
+	return tm.Host
+}
+
+func (tm *TcpMonitor) GetTimeout() time.Duration {
+	if tm.Timeout <= 0 {
+		return defaultTcpTimeout
+	}
+	return tm.Timeout
+}
+
+func (tm *TcpMonitor) BeforeSave(tx *gorm.DB) (err error) {
+	tm.Type = TypeTCP
+	err = tm.BaseMonitor.BeforeSave(tx)
+	if err != nil {
+		return
+	}
+
+	if len(tm.Ports) == 0 {
+		return errors.New("at least one port is required")
+	}
+	for _, port := range tm.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+
+	if err = validateTarget(tm.Host); err != nil {
+		return
+	}
+
+	if tm.ExpectedBanner != "" {
+		if _, err = regexp.Compile(tm.ExpectedBanner); err != nil {
+			return fmt.Errorf("invalid expected banner: %w", err)
+		}
+	}
+
+	tm.PortsJSON, err = marshalColumn("ports_json", tm.Ports)
+	if err != nil {
+		return
+	}
+
+	if tm.Timeout == 0 {
+		tm.Timeout = defaultTcpTimeout
+	} else if tm.Timeout > maxTcpTimeout {
+		tm.Timeout = maxTcpTimeout
+	} else if tm.Timeout < minTcpTimeout {
+		tm.Timeout = minTcpTimeout
+	}
+	tm.TimeoutInt = int64(tm.Timeout)
+	return nil
+}
+
+func (tm *TcpMonitor) AfterFind(tx *gorm.DB) (err error) {
+	err = tm.BaseMonitor.AfterFind(tx)
+	if err != nil {
+		return
+	}
+
+	if tm.PortsJSON != "" {
+		if err := unmarshalColumn(tm.ID, "ports_json", tm.PortsJSON, &tm.Ports); err != nil {
+			return err
+		}
+	}
+
+	tm.Timeout = time.Duration(tm.TimeoutInt)
+	if tm.Timeout == 0 {
+		tm.Timeout = defaultTcpTimeout
+	}
+	return nil
+}
+
+func (tm *TcpMonitor) Monitor(ctx context.Context) MonitorResponser {
+	logging.Logger.Sugar().Infof("Start monitoring: %d", tm.ID)
+
+	monitorResult := &TcpResponse{
+		BaseMonitorResponse: BaseMonitorResponse{
+			MonitorID:    tm.ID,
+			Result:       ResultDown,
+			ResponseTime: tm.Now(),
+		},
+		PortResults: make(PortResults, len(tm.Ports)),
+	}
+
+	var banner *regexp.Regexp
+	if tm.ExpectedBanner != "" {
+		var err error
+		if banner, err = regexp.Compile(tm.ExpectedBanner); err != nil {
+			monitorResult.ErrorMsg = fmt.Sprintf("invalid expected banner: %v", err)
+			return monitorResult
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tm.Timeout)
+	defer cancel()
+
+	reasons := make([]Reason, len(tm.Ports))
+	var wg sync.WaitGroup
+	for i, port := range tm.Ports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			monitorResult.PortResults[i], reasons[i] = tm.checkPort(ctx, port, banner)
+		}()
+	}
+	wg.Wait()
+
+	var closed, badBanners []string
+	for i, portResult := range monitorResult.PortResults {
+		monitorResult.Latency = max(monitorResult.Latency, portResult.Latency)
+		if portResult.Error == "" {
+			continue
+		}
+		if portResult.Open {
+			badBanners = append(badBanners, fmt.Sprintf("%d (%s)", portResult.Port, portResult.Error))
+		} else {
+			closed = append(closed, fmt.Sprintf("%d (%s)", portResult.Port, portResult.Error))
+		}
+		if monitorResult.Reason == ReasonNone {
+			monitorResult.Reason = reasons[i]
+		}
+	}
+
+	var problems []string
+	if len(closed) > 0 {
+		problems = append(problems, "closed ports: "+strings.Join(closed, ", "))
+	}
+	if len(badBanners) > 0 {
+		problems = append(problems, "unexpected banners: "+strings.Join(badBanners, ", "))
+	}
+	if len(problems) > 0 {
+		monitorResult.ErrorMsg = strings.Join(problems, "; ")
+		return monitorResult
+	}
+
+	monitorResult.Result = ResultUp
+	return monitorResult
+}
+
+// checkPort connects to port and, when banner is set, matches the greeting
+// against it.
+func (tm *TcpMonitor) checkPort(ctx context.Context, port int, banner *regexp.Regexp) (PortResult, Reason) {
+	result := PortResult{Port: port}
+
+	dialer := newDialer()
+	startTime := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(tm.Host, strconv.Itoa(port)))
+	result.Latency = time.Since(startTime).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, classifyError(err)
+	}
+	defer conn.Close()
+
+	result.Open = true
+	if banner != nil {
+		result.Banner, err = readBanner(ctx, conn, banner)
+		if err != nil {
+			result.Error = err.Error()
+			return result, classifyError(err)
+		}
+	}
+	return result, ReasonNone
+}
+
+// readBanner reads the server greeting until it matches expected, the server
+// stops sending, or ctx is done.
+func readBanner(ctx context.Context, conn net.Conn, expected *regexp.Regexp) (string, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+
+	buf := make([]byte, 0, maxBannerBytes)
+	for len(buf) < maxBannerBytes {
+		n, err := conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if expected.Match(buf) {
+			return string(buf), nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if len(buf) == 0 {
+				return "", fmt.Errorf("no banner received: %w", err)
+			}
+			return string(buf), fmt.Errorf("banner %q doesn't match %q: %w", buf, expected, err)
+		}
+	}
+	return string(buf), fmt.Errorf("banner %q doesn't match %q", buf, expected)
+}
@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// openPort returns a local port accepting connections until the test ends.
+func openPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func closedPort(t *testing.T) int {
+	_, port, err := net.SplitHostPort(closedAddress(t))
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return p
+}
+
+func TestTcpMonitor_BeforeSave(t *testing.T) {
+	tm := &TcpMonitor{Host: "example.com", Ports: []int{80, 443}}
+
+	err := tm.BeforeSave(&gorm.DB{})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeTCP, tm.Type)
+	assert.Equal(t, "[80,443]", tm.PortsJSON)
+	assert.Equal(t, int64(defaultTcpTimeout), tm.TimeoutInt)
+}
+
+func TestTcpMonitor_BeforeSave_InvalidPort(t *testing.T) {
+	tm := &TcpMonitor{Host: "example.com", Ports: []int{80, 70000}}
+
+	err := tm.BeforeSave(&gorm.DB{})
+	assert.EqualError(t, err, "invalid port 70000")
+}
+
+func TestTcpMonitor_Monitor_AllOpen(t *testing.T) {
+	ports := []int{openPort(t), openPort(t)}
+	tm := &TcpMonitor{Host: "127.0.0.1", Ports: ports, Timeout: time.Second}
+
+	response := tm.Monitor(context.Background()).(*TcpResponse)
+
+	assert.Equal(t, ResultUp, response.Result)
+	require.Len(t, response.PortResults, 2)
+	assert.True(t, response.PortResults[0].Open)
+	assert.True(t, response.PortResults[1].Open)
+}
+
+func TestTcpMonitor_Monitor_OneClosed(t *testing.T) {
+	open, closed := openPort(t), closedPort(t)
+	tm := &TcpMonitor{Host: "127.0.0.1", Ports: []int{open, closed}, Timeout: time.Second}
+
+	response := tm.Monitor(context.Background()).(*TcpResponse)
+
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, ReasonConnRefused, response.Reason)
+	assert.Contains(t, response.ErrorMsg, "closed ports: "+strconv.Itoa(closed))
+	assert.True(t, response.PortResults[0].Open)
+	assert.False(t, response.PortResults[1].Open)
+	assert.Equal(t, closed, response.PortResults[1].Port)
+}
+
+// bannerPort returns a local port that greets every connection with banner.
+func bannerPort(t *testing.T, banner string) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestTcpMonitor_Monitor_ExpectedBanner(t *testing.T) {
+	ssh := bannerPort(t, "SSH-2.0-OpenSSH_9.6\r\n")
+	tm := &TcpMonitor{Host: "127.0.0.1", Ports: []int{ssh}, Timeout: time.Second, ExpectedBanner: `^SSH-2\.0`}
+
+	response := tm.Monitor(context.Background()).(*TcpResponse)
+	assert.Equal(t, ResultUp, response.Result, response.ErrorMsg)
+	assert.Equal(t, "SSH-2.0-OpenSSH_9.6\r\n", response.PortResults[0].Banner)
+
+	tm.ExpectedBanner = `^220 .*ESMTP`
+	response = tm.Monitor(context.Background()).(*TcpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.True(t, response.PortResults[0].Open)
+	assert.Contains(t, response.ErrorMsg, "unexpected banners: "+strconv.Itoa(ssh))
+}
+
+func TestTcpMonitor_Monitor_NoBanner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		// Accept and stay silent
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	tm := &TcpMonitor{
+		Host:           "127.0.0.1",
+		Ports:          []int{l.Addr().(*net.TCPAddr).Port},
+		Timeout:        200 * time.Millisecond,
+		ExpectedBanner: "^220",
+	}
+
+	response := tm.Monitor(context.Background()).(*TcpResponse)
+	assert.Equal(t, ResultDown, response.Result)
+	assert.Equal(t, ReasonTimeout, response.Reason)
+	assert.Contains(t, response.ErrorMsg, "no banner received")
+}
+
+func TestTcpMonitor_BeforeSave_InvalidBanner(t *testing.T) {
+	tm := &TcpMonitor{Host: "example.com", Ports: []int{22}, ExpectedBanner: "("}
+
+	err := tm.BeforeSave(&gorm.DB{})
+	assert.ErrorContains(t, err, "invalid expected banner")
+}
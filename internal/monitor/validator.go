@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// maxValidatorOutput bounds how much of the validator's stderr is kept for
+// the error message.
+const maxValidatorOutput = 1024
+
+var (
+	validatorsMu      sync.RWMutex
+	allowedValidators []string
+)
+
+// SetAllowedValidatorCommands sets the executables monitors may use as
+// ValidatorCommand. Anything else is rejected at save and at run time.
+func SetAllowedValidatorCommands(commands []string) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	allowedValidators = commands
+}
+
+func validatorAllowed(command string) bool {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	return lo.Contains(allowedValidators, command)
+}
+
+func (hm *HttpMonitor) validateValidatorCommand() error {
+	if hm.ValidatorCommand == "" || validatorAllowed(hm.ValidatorCommand) {
+		return nil
+	}
+	return fmt.Errorf("validator command %q is not allowed", hm.ValidatorCommand)
+}
+
+// runValidator pipes body to the validator command and fails unless it exits
+// with status 0. The command runs without a shell and with an empty
+// environment, bounded by the monitor's request timeout.
+func (hm *HttpMonitor) runValidator(ctx context.Context, body []byte) error {
+	if err := hm.validateValidatorCommand(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hm.ReqTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, hm.ValidatorCommand, hm.ValidatorArgs...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+	cmd.Env = []string{}
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("validator timed out: %w", ctx.Err())
+	}
+
+	output := strings.TrimSpace(stderr.String())
+	if len(output) > maxValidatorOutput {
+		output = output[:maxValidatorOutput]
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to run validator: %w", err)
+	}
+	if output == "" {
+		return fmt.Errorf("validator exited with code %d", exitErr.ExitCode())
+	}
+	return fmt.Errorf("validator exited with code %d: %s", exitErr.ExitCode(), output)
+}
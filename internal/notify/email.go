@@ -0,0 +1,230 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TLS modes of the SMTP connection of an EmailNotifier
+const (
+	SMTPStartTLS = "starttls" // Upgrade a plain connection, usually on port 587
+	SMTPTLS      = "tls"      // Implicit TLS, usually on port 465
+	SMTPNone     = "none"
+)
+
+const emailAttempts = 3
+
+var (
+	// Bounds one delivery attempt, and a whole send with its retries, so
+	// that a hung server holds the caller for emailSendTimeout at most
+	emailTimeout     = 8 * time.Second
+	emailSendTimeout = 30 * time.Second
+	// Wait before the first retry, doubling for each retry after it
+	emailBackoff = 2 * time.Second
+)
+
+const (
+	defaultEmailSubject = `[shraga] {{if .SSLExpiryThreshold}}Certificate of monitor {{.MonitorID}} expires in less than {{.SSLExpiryThreshold}} days{{else}}Monitor {{.MonitorID}} is {{.Current}}{{end}}{{with .Address}} ({{.}}){{end}}`
+	defaultEmailBody    = `{{if .SSLExpiryThreshold -}}
+The certificate of monitor {{.MonitorID}}{{with .Address}} ({{.}}){{end}} expires in less than {{.SSLExpiryThreshold}} days.
+{{- else -}}
+Monitor {{.MonitorID}}{{with .Address}} ({{.}}){{end}} changed from {{.Previous}} to {{.Current}} at {{.Time.Format "2006-01-02 15:04:05 MST"}}.
+{{- with .ErrorMsg}}
+
+Error: {{.}}
+{{- end}}
+{{- if .RootCause}}
+
+Likely caused by monitor {{.RootCause}}.
+{{- end}}
+{{- if .Downtime}}
+
+Down for {{.Downtime}}.
+{{- end}}
+{{- end}}
+`
+)
+
+// EmailConfig configures the SMTP server and messages of an EmailNotifier.
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string // Authenticates with PLAIN when set
+	Password string
+	TLS      string // SMTPStartTLS, SMTPTLS or SMTPNone
+	From     string
+	To       []string
+	// text/template templates executed with the Event, defaulting to a
+	// summary of the change
+	SubjectTemplate string
+	BodyTemplate    string
+}
+
+// EmailNotifier emails events through an SMTP server. Failures to deliver,
+// e.g. while the server is down, are retried with exponential backoff.
+type EmailNotifier struct {
+	cfg     EmailConfig
+	subject *template.Template
+	body    *template.Template
+}
+
+// NewEmailNotifier returns a notifier sending through the SMTP server of cfg.
+func NewEmailNotifier(cfg EmailConfig) (*EmailNotifier, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("SMTP host, sender and recipients are required")
+	}
+	switch cfg.TLS {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", cfg.TLS)
+	}
+	if cfg.SubjectTemplate == "" {
+		cfg.SubjectTemplate = defaultEmailSubject
+	}
+	if cfg.BodyTemplate == "" {
+		cfg.BodyTemplate = defaultEmailBody
+	}
+
+	subject, err := template.New("subject").Parse(cfg.SubjectTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email subject template: %w", err)
+	}
+	body, err := template.New("body").Parse(cfg.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email body template: %w", err)
+	}
+	return &EmailNotifier{cfg: cfg, subject: subject, body: body}, nil
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	var subject, body bytes.Buffer
+	if err := e.subject.Execute(&subject, event); err != nil {
+		return fmt.Errorf("failed to render email subject: %w", err)
+	}
+	if err := e.body.Execute(&body, event); err != nil {
+		return fmt.Errorf("failed to render email body: %w", err)
+	}
+	return e.post(ctx, subject.String(), body.String())
+}
+
+// TestNotify emails the recipients a test message.
+func (e *EmailNotifier) TestNotify(ctx context.Context) error {
+	return e.post(ctx, "[shraga] Test notification", "Sent to verify the email integration of shraga; no action is needed.\n")
+}
+
+// post sends the message, retrying until emailAttempts were made, ctx is done
+// or emailSendTimeout passed.
+func (e *EmailNotifier) post(ctx context.Context, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	defer cancel()
+
+	msg := e.message(subject, body)
+	return retry(ctx, emailAttempts, emailBackoff, func() (bool, error) {
+		return e.send(ctx, msg)
+	})
+}
+
+// message formats a plain text email, its lines ending with CRLF.
+func (e *EmailNotifier) message(subject, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	// The subject is a single line, whatever the template rendered
+	subject = strings.Join(strings.Fields(subject), " ")
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes()
+}
+
+// send delivers msg once, and reports whether a failure is worth retrying:
+// the server couldn't be reached or failed temporarily.
+func (e *EmailNotifier) send(ctx context.Context, msg []byte) (bool, error) {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: e.cfg.Host}
+	var conn net.Conn
+	var err error
+	if e.cfg.TLS == SMTPTLS {
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: emailTimeout}, Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{Timeout: emailTimeout}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+
+	deadline := time.Now().Add(emailTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return smtpRetryable(err), err
+	}
+	defer client.Close()
+
+	if e.cfg.TLS == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return false, errors.New("SMTP server doesn't support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return smtpRetryable(err), err
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return smtpRetryable(err), err
+		}
+	}
+
+	if err := client.Mail(e.cfg.From); err != nil {
+		return smtpRetryable(err), err
+	}
+	for _, to := range e.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return smtpRetryable(err), err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpRetryable(err), err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return smtpRetryable(err), err
+	}
+	if err := w.Close(); err != nil {
+		return smtpRetryable(err), err
+	}
+	// The message was accepted, a failure to quit doesn't matter
+	client.Quit()
+	return false, nil
+}
+
+// smtpRetryable reports whether err is worth retrying: a transient 4xx reply
+// or a connection failure, but not a permanent 5xx reply.
+func smtpRetryable(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code < 500
+	}
+	return true
+}
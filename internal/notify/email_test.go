@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer accepts SMTP sessions, replying to MAIL commands with
+// mailReplies in turn and then accepting every message.
+type fakeSMTPServer struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	mailReplies []string
+	mails       atomic.Int32
+	messages    chan string
+}
+
+func newFakeSMTPServer(t *testing.T, mailReplies ...string) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTPServer{listener: listener, mailReplies: mailReplies, messages: make(chan string, 10)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(strings.Fields(line)[0]) {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			s.mails.Add(1)
+			s.mu.Lock()
+			reply := "250 OK"
+			if len(s.mailReplies) > 0 {
+				reply, s.mailReplies = s.mailReplies[0], s.mailReplies[1:]
+			}
+			s.mu.Unlock()
+			tp.PrintfLine("%s", reply)
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.messages <- strings.Join(lines, "\n")
+			tp.PrintfLine("250 Queued")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier_Notify(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	notifier, err := NewEmailNotifier(EmailConfig{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		TLS:  SMTPNone,
+		From: "shraga@example.com",
+		To:   []string{"oncall@example.com", "payments@example.com"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, notifier.Notify(context.Background(), Event{
+		MonitorID: 7,
+		Address:   "https://example.com/health",
+		Previous:  monitor.ResultUp,
+		Current:   monitor.ResultDown,
+		ErrorMsg:  "connection refused",
+		Time:      time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+	}))
+
+	message := <-server.messages
+	assert.Contains(t, message, "To: oncall@example.com, payments@example.com\n")
+	assert.Contains(t, message, "Subject: [shraga] Monitor 7 is Down (https://example.com/health)\n")
+	assert.Contains(t, message, "\n\nMonitor 7 (https://example.com/health) changed from Up to Down at 2020-01-01 12:00:00 UTC.\n\nError: connection refused")
+}
+
+func TestEmailNotifier_Templates(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	notifier, err := NewEmailNotifier(EmailConfig{
+		Host:            "127.0.0.1",
+		Port:            server.port(),
+		TLS:             SMTPNone,
+		From:            "shraga@example.com",
+		To:              []string{"oncall@example.com"},
+		SubjectTemplate: "{{.Address}} is {{.Current}}",
+		BodyTemplate:    "Was {{.Previous}}",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, notifier.Notify(context.Background(), Event{Address: "db.internal", Previous: monitor.ResultDown, Current: monitor.ResultUp}))
+	message := <-server.messages
+	assert.Contains(t, message, "Subject: db.internal is Up\n")
+	assert.True(t, strings.HasSuffix(message, "\n\nWas Down"), message)
+
+	_, err = NewEmailNotifier(EmailConfig{Host: "127.0.0.1", TLS: SMTPNone, From: "a@example.com", To: []string{"b@example.com"}, BodyTemplate: "{{.Address"})
+	assert.ErrorContains(t, err, "invalid email body template")
+	_, err = NewEmailNotifier(EmailConfig{Host: "127.0.0.1", TLS: "ssl", From: "a@example.com", To: []string{"b@example.com"}})
+	assert.EqualError(t, err, `unknown SMTP TLS mode "ssl"`)
+}
+
+func TestEmailNotifier_Retries(t *testing.T) {
+	defer func(backoff time.Duration) { emailBackoff = backoff }(emailBackoff)
+	emailBackoff = time.Millisecond
+
+	server := newFakeSMTPServer(t, "421 4.3.0 Try again later")
+	cfg := EmailConfig{Host: "127.0.0.1", Port: server.port(), TLS: SMTPNone, From: "shraga@example.com", To: []string{"oncall@example.com"}}
+	notifier, err := NewEmailNotifier(cfg)
+	require.NoError(t, err)
+	require.NoError(t, notifier.TestNotify(context.Background()))
+	assert.Equal(t, int32(2), server.mails.Load())
+	<-server.messages
+
+	// Permanent failures aren't retried
+	server = newFakeSMTPServer(t, "550 5.1.0 Sender rejected")
+	cfg.Port = server.port()
+	notifier, err = NewEmailNotifier(cfg)
+	require.NoError(t, err)
+	assert.ErrorContains(t, notifier.TestNotify(context.Background()), "Sender rejected")
+	assert.Equal(t, int32(1), server.mails.Load())
+}
+
+func TestEmailNotifier_ServerDown(t *testing.T) {
+	defer func(backoff time.Duration) { emailBackoff = backoff }(emailBackoff)
+	emailBackoff = time.Millisecond
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	notifier, err := NewEmailNotifier(EmailConfig{Host: "127.0.0.1", Port: port, TLS: SMTPNone, From: "shraga@example.com", To: []string{"oncall@example.com"}})
+	require.NoError(t, err)
+	err = notifier.Notify(context.Background(), Event{MonitorID: 7, Current: monitor.ResultDown})
+	assert.ErrorContains(t, err, "127.0.0.1:"+strconv.Itoa(port))
+}
+
+func TestEmailNotifier_HungServer(t *testing.T) {
+	defer func(timeout, sendTimeout, backoff time.Duration) {
+		emailTimeout, emailSendTimeout, emailBackoff = timeout, sendTimeout, backoff
+	}(emailTimeout, emailSendTimeout, emailBackoff)
+	emailTimeout, emailSendTimeout, emailBackoff = 50*time.Millisecond, time.Hour, time.Millisecond
+
+	// Accepts connections and never replies
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var conns atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	notifier, err := NewEmailNotifier(EmailConfig{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, TLS: SMTPNone, From: "shraga@example.com", To: []string{"oncall@example.com"}})
+	require.NoError(t, err)
+	assert.ErrorContains(t, notifier.TestNotify(context.Background()), "i/o timeout")
+	assert.Equal(t, int32(emailAttempts), conns.Load(), "every attempt should time out on its own")
+
+	// The retries don't outlast the send timeout
+	emailTimeout, emailSendTimeout = time.Hour, 100*time.Millisecond
+	start := time.Now()
+	assert.Error(t, notifier.TestNotify(context.Background()))
+	assert.Less(t, time.Since(start), time.Second)
+}
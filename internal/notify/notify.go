@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"shraga/internal/monitor"
+	"time"
+)
+
+// Event describes a monitor changing result from one check to the next.
+type Event struct {
+	MonitorID uint
+	Type      monitor.MonitorType
+	Address   string // What the monitor checks, when it reports it
+	Previous  monitor.Result
+	Current   monitor.Result
+	Reason    monitor.Reason
+	ErrorMsg  string
+	Time      time.Time
+	// How long the monitor was down, when the result closed an incident
+	Downtime time.Duration
+	// The SSL expiry threshold, in days, the certificate crossed. Set for
+	// certificate expiry events only, whose Current is the result of the check.
+	SSLExpiryThreshold int
+	// Owners of the monitor, for notifiers routing alerts per team
+	OwnerTeam  string
+	OwnerEmail string
+	// The upstream monitor, among those this one depends on directly or
+	// transitively, that is down without a down dependency of its own: the
+	// likely root cause of this monitor going down. Zero when there is none.
+	RootCause uint
+	// The monitors depending on this one, directly or transitively, that are
+	// down too, when this one is the likely root cause
+	DownDependents []uint
+}
+
+// Notifier delivers events to an alerting system.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+	// TestNotify sends a harmless test message, to verify the configuration
+	TestNotify(ctx context.Context) error
+}
+
+// Transition returns the event for result following a check that ended with
+// previous, and false when there is nothing to notify: the result didn't
+// change, or a monitor that was never checked came up.
+func Transition(previous monitor.Result, result *monitor.BaseMonitorResponse) (Event, bool) {
+	if previous == result.Result {
+		return Event{}, false
+	}
+	if previous == monitor.ResultUnknown && result.Result == monitor.ResultUp {
+		return Event{}, false
+	}
+
+	return Event{
+		MonitorID: result.MonitorID,
+		Previous:  previous,
+		Current:   result.Result,
+		Reason:    result.Reason,
+		ErrorMsg:  result.ErrorMsg,
+		Time:      result.ResponseTime,
+	}, true
+}
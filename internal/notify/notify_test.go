@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"testing"
+
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous monitor.Result
+		current  monitor.Result
+		notify   bool
+	}{
+		{"unchanged", monitor.ResultDown, monitor.ResultDown, false},
+		{"first check up", monitor.ResultUnknown, monitor.ResultUp, false},
+		{"first check down", monitor.ResultUnknown, monitor.ResultDown, true},
+		{"went down", monitor.ResultUp, monitor.ResultDown, true},
+		{"recovered", monitor.ResultDown, monitor.ResultUp, true},
+		{"warns", monitor.ResultUp, monitor.ResultWarn, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := Transition(tt.previous, &monitor.BaseMonitorResponse{MonitorID: 1, Result: tt.current})
+			assert.Equal(t, tt.notify, ok)
+			if ok {
+				assert.Equal(t, Event{MonitorID: 1, Previous: tt.previous, Current: tt.current}, event)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"shraga/internal/monitor"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const opsgenieTimeout = 10 * time.Second
+
+var opsgenieURLs = map[string]string{
+	"us": "https://api.opsgenie.com",
+	"eu": "https://api.eu.opsgenie.com",
+}
+
+// OpsgenieNotifier creates an Opsgenie alert when a monitor goes down or
+// warns, and closes it when the monitor recovers. Alerts are aliased by
+// monitor ID, so repeated notifications are deduplicated by Opsgenie.
+type OpsgenieNotifier struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewOpsgenieNotifier returns a notifier using the Alert API of region, "us"
+// or "eu".
+func NewOpsgenieNotifier(apiKey, region string) (*OpsgenieNotifier, error) {
+	baseURL, ok := opsgenieURLs[region]
+	if !ok {
+		return nil, fmt.Errorf("unknown Opsgenie region %q", region)
+	}
+	return &OpsgenieNotifier{
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: opsgenieTimeout},
+	}, nil
+}
+
+type opsgenieAlert struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description,omitempty"`
+	Priority    string              `json:"priority"`
+	Responders  []opsgenieResponder `json:"responders,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+}
+
+type opsgenieResponder struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (o *OpsgenieNotifier) Notify(ctx context.Context, event Event) error {
+	alias := "shraga-monitor-" + strconv.FormatUint(uint64(event.MonitorID), 10)
+
+	if event.SSLExpiryThreshold > 0 {
+		return o.notifySSLExpiry(ctx, alias, event)
+	}
+
+	switch event.Current {
+	case monitor.ResultDown, monitor.ResultWarn:
+		priority := "P1"
+		if event.Current == monitor.ResultWarn {
+			priority = "P3"
+		}
+		var responders []opsgenieResponder
+		if event.OwnerTeam != "" {
+			responders = append(responders, opsgenieResponder{Name: event.OwnerTeam, Type: "team"})
+		}
+		alert := opsgenieAlert{
+			Message:     fmt.Sprintf("Monitor %d is %s", event.MonitorID, event.Current),
+			Alias:       alias,
+			Description: event.ErrorMsg,
+			Priority:    priority,
+			Responders:  responders,
+			Details: map[string]string{
+				"reason":   event.Reason.String(),
+				"previous": event.Previous.String(),
+				"time":     event.Time.Format(time.RFC3339),
+			},
+		}
+		if event.RootCause != 0 {
+			alert.Message += fmt.Sprintf(", likely caused by monitor %d", event.RootCause)
+			alert.Details["root_cause"] = strconv.FormatUint(uint64(event.RootCause), 10)
+		}
+		if len(event.DownDependents) > 0 {
+			alert.Message += fmt.Sprintf(", along with %d dependents", len(event.DownDependents))
+			alert.Details["down_dependents"] = formatIDs(event.DownDependents)
+		}
+		return o.post(ctx, "/v2/alerts", alert)
+	case monitor.ResultUp:
+		note := fmt.Sprintf("Monitor %d recovered", event.MonitorID)
+		if event.Downtime > 0 {
+			note += fmt.Sprintf(" after %s of downtime", event.Downtime.Round(time.Second))
+		}
+		if len(event.DownDependents) > 0 {
+			note += fmt.Sprintf("; dependents %s are still down", formatIDs(event.DownDependents))
+		}
+		return o.post(ctx, "/v2/alerts/"+url.PathEscape(alias)+"/close?identifierType=alias", map[string]string{
+			"note": note,
+		})
+	}
+	return nil
+}
+
+// notifySSLExpiry creates an alert for each SSL expiry threshold, its priority
+// escalating as the expiry nears.
+func (o *OpsgenieNotifier) notifySSLExpiry(ctx context.Context, alias string, event Event) error {
+	priority := "P4"
+	switch {
+	case event.SSLExpiryThreshold <= 1:
+		priority = "P1"
+	case event.SSLExpiryThreshold <= 7:
+		priority = "P2"
+	case event.SSLExpiryThreshold <= 14:
+		priority = "P3"
+	}
+	var responders []opsgenieResponder
+	if event.OwnerTeam != "" {
+		responders = append(responders, opsgenieResponder{Name: event.OwnerTeam, Type: "team"})
+	}
+	return o.post(ctx, "/v2/alerts", opsgenieAlert{
+		Message:    fmt.Sprintf("Certificate of monitor %d expires in less than %d days", event.MonitorID, event.SSLExpiryThreshold),
+		Alias:      fmt.Sprintf("%s-ssl-expiry-%d", alias, event.SSLExpiryThreshold),
+		Priority:   priority,
+		Responders: responders,
+		Details: map[string]string{
+			"threshold_days": strconv.Itoa(event.SSLExpiryThreshold),
+			"time":           event.Time.Format(time.RFC3339),
+		},
+	})
+}
+
+// TestNotify creates a low priority test alert and closes it right away.
+func (o *OpsgenieNotifier) TestNotify(ctx context.Context) error {
+	alias := "shraga-test-notification"
+	err := o.post(ctx, "/v2/alerts", opsgenieAlert{
+		Message:     "Shraga test notification",
+		Alias:       alias,
+		Description: "Sent to verify the Opsgenie integration of shraga; no action is needed.",
+		Priority:    "P5",
+	})
+	if err != nil {
+		return err
+	}
+	return o.post(ctx, "/v2/alerts/"+url.PathEscape(alias)+"/close?identifierType=alias", map[string]string{
+		"note": "Test notification",
+	})
+}
+
+func (o *OpsgenieNotifier) post(ctx context.Context, path string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("opsgenie responded %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// formatIDs lists monitor IDs separated by commas.
+func formatIDs(ids []uint) string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(formatted, ", ")
+}
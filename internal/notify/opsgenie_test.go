@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpsgenieNotifier_Notify(t *testing.T) {
+	var paths []string
+	var alerts []opsgenieAlert
+	var notes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GenieKey secret", r.Header.Get("Authorization"))
+		paths = append(paths, r.URL.RequestURI())
+		if r.URL.Path == "/v2/alerts" {
+			var alert opsgenieAlert
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+			alerts = append(alerts, alert)
+		} else {
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			notes = append(notes, body["note"])
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewOpsgenieNotifier("secret", "eu")
+	require.NoError(t, err)
+	notifier.baseURL = ts.URL
+
+	ctx := context.Background()
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 7, Previous: monitor.ResultUp, Current: monitor.ResultDown, ErrorMsg: "refused", OwnerTeam: "payments"}))
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 7, Previous: monitor.ResultDown, Current: monitor.ResultWarn}))
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 7, Previous: monitor.ResultWarn, Current: monitor.ResultUp, Downtime: 14 * time.Minute}))
+
+	assert.Equal(t, []string{"/v2/alerts", "/v2/alerts", "/v2/alerts/shraga-monitor-7/close?identifierType=alias"}, paths)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "shraga-monitor-7", alerts[0].Alias)
+	assert.Equal(t, "P1", alerts[0].Priority)
+	assert.Equal(t, "refused", alerts[0].Description)
+	assert.Equal(t, []opsgenieResponder{{Name: "payments", Type: "team"}}, alerts[0].Responders)
+	assert.Equal(t, "P3", alerts[1].Priority)
+	assert.Empty(t, alerts[1].Responders)
+	assert.Equal(t, []string{"Monitor 7 recovered after 14m0s of downtime"}, notes)
+}
+
+func TestOpsgenieNotifier_Notify_Dependencies(t *testing.T) {
+	var alerts []opsgenieAlert
+	var notes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/alerts" {
+			var alert opsgenieAlert
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+			alerts = append(alerts, alert)
+		} else {
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			notes = append(notes, body["note"])
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewOpsgenieNotifier("secret", "us")
+	require.NoError(t, err)
+	notifier.baseURL = ts.URL
+
+	ctx := context.Background()
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 3, Previous: monitor.ResultUp, Current: monitor.ResultDown, RootCause: 1}))
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 1, Previous: monitor.ResultUp, Current: monitor.ResultDown, DownDependents: []uint{2, 3}}))
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 1, Previous: monitor.ResultDown, Current: monitor.ResultUp, DownDependents: []uint{3}}))
+
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "Monitor 3 is Down, likely caused by monitor 1", alerts[0].Message)
+	assert.Equal(t, "1", alerts[0].Details["root_cause"])
+	assert.Equal(t, "Monitor 1 is Down, along with 2 dependents", alerts[1].Message)
+	assert.Equal(t, "2, 3", alerts[1].Details["down_dependents"])
+	assert.Equal(t, []string{"Monitor 1 recovered; dependents 3 are still down"}, notes)
+}
+
+func TestOpsgenieNotifier_Notify_SSLExpiry(t *testing.T) {
+	var alerts []opsgenieAlert
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert opsgenieAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		alerts = append(alerts, alert)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewOpsgenieNotifier("secret", "us")
+	require.NoError(t, err)
+	notifier.baseURL = ts.URL
+
+	ctx := context.Background()
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 7, Previous: monitor.ResultUp, Current: monitor.ResultUp, SSLExpiryThreshold: 30}))
+	require.NoError(t, notifier.Notify(ctx, Event{MonitorID: 7, Previous: monitor.ResultWarn, Current: monitor.ResultWarn, SSLExpiryThreshold: 1}))
+
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "Certificate of monitor 7 expires in less than 30 days", alerts[0].Message)
+	assert.Equal(t, "shraga-monitor-7-ssl-expiry-30", alerts[0].Alias)
+	assert.Equal(t, "P4", alerts[0].Priority)
+	assert.Equal(t, "shraga-monitor-7-ssl-expiry-1", alerts[1].Alias)
+	assert.Equal(t, "P1", alerts[1].Priority)
+}
+
+func TestOpsgenieNotifier_TestNotify(t *testing.T) {
+	var paths []string
+	var alert opsgenieAlert
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		if r.URL.Path == "/v2/alerts" {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewOpsgenieNotifier("secret", "us")
+	require.NoError(t, err)
+	notifier.baseURL = ts.URL
+
+	require.NoError(t, notifier.TestNotify(context.Background()))
+	assert.Equal(t, []string{"/v2/alerts", "/v2/alerts/shraga-test-notification/close?identifierType=alias"}, paths)
+	assert.Equal(t, "P5", alert.Priority)
+}
+
+func TestOpsgenieNotifier_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid key", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewOpsgenieNotifier("secret", "us")
+	require.NoError(t, err)
+	notifier.baseURL = ts.URL
+
+	err = notifier.Notify(context.Background(), Event{MonitorID: 1, Current: monitor.ResultDown})
+	assert.ErrorContains(t, err, "opsgenie responded 401")
+	assert.ErrorContains(t, notifier.TestNotify(context.Background()), "opsgenie responded 401: invalid key")
+
+	_, err = NewOpsgenieNotifier("secret", "apac")
+	assert.Error(t, err)
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// retry calls send until it succeeds, reports a failure not worth retrying,
+// was called attempts times, or ctx is done. It waits backoff before the
+// first retry, doubling the wait for each retry after it.
+func retry(ctx context.Context, attempts int, backoff time.Duration, send func() (bool, error)) error {
+	for attempt := 1; ; attempt++ {
+		retryable, err := send()
+		if !retryable || attempt == attempts {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (giving up after %d attempts: %w)", err, attempt, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"shraga/internal/monitor"
+	"time"
+)
+
+const slackTimeout = 10 * time.Second
+
+// Attachment colors by the result a monitor changed to
+var slackColors = map[monitor.Result]string{
+	monitor.ResultUp:   "good",
+	monitor.ResultWarn: "warning",
+	monitor.ResultDown: "danger",
+}
+
+// SlackNotifier posts a message to a Slack incoming webhook when a monitor
+// changes result.
+type SlackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewSlackNotifier returns a notifier posting to the incoming webhook at
+// webhookURL.
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: slackTimeout},
+	}
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	var text string
+	switch {
+	case event.SSLExpiryThreshold > 0:
+		text = fmt.Sprintf("Certificate of monitor %d expires in less than %d days", event.MonitorID, event.SSLExpiryThreshold)
+	case event.Current == monitor.ResultUp:
+		text = fmt.Sprintf("Monitor %d recovered", event.MonitorID)
+		if event.Downtime > 0 {
+			text += fmt.Sprintf(" after %s of downtime", event.Downtime.Round(time.Second))
+		}
+	default:
+		text = fmt.Sprintf("Monitor %d is %s", event.MonitorID, event.Current)
+		if event.RootCause != 0 {
+			text += fmt.Sprintf(", likely caused by monitor %d", event.RootCause)
+		}
+	}
+
+	var fields []slackField
+	if event.Address != "" {
+		fields = append(fields, slackField{Title: "Address", Value: event.Address})
+	}
+	if event.SSLExpiryThreshold == 0 {
+		fields = append(fields,
+			slackField{Title: "Previous", Value: event.Previous.String(), Short: true},
+			slackField{Title: "Current", Value: event.Current.String(), Short: true},
+		)
+	}
+	if event.ErrorMsg != "" {
+		fields = append(fields, slackField{Title: "Error", Value: event.ErrorMsg})
+	}
+	if len(event.DownDependents) > 0 {
+		fields = append(fields, slackField{Title: "Down dependents", Value: formatIDs(event.DownDependents)})
+	}
+	if event.OwnerTeam != "" {
+		fields = append(fields, slackField{Title: "Owner", Value: event.OwnerTeam, Short: true})
+	}
+
+	color := slackColors[event.Current]
+	if event.SSLExpiryThreshold > 0 {
+		color = "warning"
+	}
+	return s.post(ctx, slackMessage{
+		Text:        text,
+		Attachments: []slackAttachment{{Color: color, Fields: fields}},
+	})
+}
+
+// TestNotify posts a test message to the webhook's channel.
+func (s *SlackNotifier) TestNotify(ctx context.Context) error {
+	return s.post(ctx, slackMessage{
+		Text: "Shraga test notification: the Slack integration works, no action is needed.",
+	})
+}
+
+func (s *SlackNotifier) post(ctx context.Context, message slackMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// The webhook URL is a secret, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("slack webhook: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("slack responded %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shraga/internal/monitor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackNotifier_Notify(t *testing.T) {
+	var messages []slackMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/services/T000/B000/secret", r.URL.Path)
+		var message slackMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		messages = append(messages, message)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	notifier := NewSlackNotifier(ts.URL + "/services/T000/B000/secret")
+	ctx := context.Background()
+	require.NoError(t, notifier.Notify(ctx, Event{
+		MonitorID: 7,
+		Address:   "https://example.com/health",
+		Previous:  monitor.ResultUp,
+		Current:   monitor.ResultDown,
+		ErrorMsg:  "connection refused",
+		RootCause: 3,
+	}))
+	require.NoError(t, notifier.Notify(ctx, Event{
+		MonitorID: 7,
+		Address:   "https://example.com/health",
+		Previous:  monitor.ResultDown,
+		Current:   monitor.ResultUp,
+		Downtime:  14 * time.Minute,
+	}))
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, "Monitor 7 is Down, likely caused by monitor 3", messages[0].Text)
+	assert.Equal(t, []slackAttachment{{
+		Color: "danger",
+		Fields: []slackField{
+			{Title: "Address", Value: "https://example.com/health"},
+			{Title: "Previous", Value: "Up", Short: true},
+			{Title: "Current", Value: "Down", Short: true},
+			{Title: "Error", Value: "connection refused"},
+		},
+	}}, messages[0].Attachments)
+	assert.Equal(t, "Monitor 7 recovered after 14m0s of downtime", messages[1].Text)
+	assert.Equal(t, "good", messages[1].Attachments[0].Color)
+}
+
+func TestSlackNotifier_Notify_SSLExpiry(t *testing.T) {
+	var message slackMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+	}))
+	defer ts.Close()
+
+	notifier := NewSlackNotifier(ts.URL)
+	require.NoError(t, notifier.Notify(context.Background(), Event{MonitorID: 7, Current: monitor.ResultUp, SSLExpiryThreshold: 14}))
+	assert.Equal(t, "Certificate of monitor 7 expires in less than 14 days", message.Text)
+	assert.Equal(t, "warning", message.Attachments[0].Color)
+}
+
+func TestSlackNotifier_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("invalid_token"))
+	}))
+	defer ts.Close()
+
+	notifier := NewSlackNotifier(ts.URL)
+	assert.EqualError(t, notifier.TestNotify(context.Background()), "slack responded 403: invalid_token")
+
+	ts.Close()
+	err := NewSlackNotifier(ts.URL + "/services/secret").TestNotify(context.Background())
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"shraga/internal/monitor"
+	"text/template"
+	"time"
+)
+
+const (
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+)
+
+// Wait before the first retry, doubling for each retry after it
+var webhookBackoff = time.Second
+
+// WebhookNotifier posts every event as JSON to a URL, e.g. of an internal
+// incident bus. Server errors are retried with exponential backoff.
+type WebhookNotifier struct {
+	url     string
+	headers map[string]string
+	payload *template.Template // Renders the body when set
+	client  *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting to url with the given extra
+// headers, e.g. for authentication. The body is rendered by payloadTemplate,
+// a text/template executed with the Event, when set; its json function
+// encodes a value, e.g. {{json .ErrorMsg}}. Otherwise it's webhookPayload.
+func NewWebhookNotifier(url string, headers map[string]string, payloadTemplate string) (*WebhookNotifier, error) {
+	w := &WebhookNotifier{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+	if payloadTemplate != "" {
+		payload, err := template.New("payload").Funcs(template.FuncMap{"json": jsonValue}).Parse(payloadTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook payload template: %w", err)
+		}
+		w.payload = payload
+	}
+	return w, nil
+}
+
+func jsonValue(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+type webhookPayload struct {
+	MonitorID          uint      `json:"monitorId"`
+	Type               string    `json:"type,omitempty"`
+	Address            string    `json:"address,omitempty"`
+	Previous           string    `json:"previous"`
+	Current            string    `json:"current"`
+	Reason             string    `json:"reason,omitempty"`
+	Error              string    `json:"error,omitempty"`
+	Timestamp          time.Time `json:"timestamp"`
+	Downtime           string    `json:"downtime,omitempty"`
+	SSLExpiryThreshold int       `json:"sslExpiryThreshold,omitempty"`
+	RootCause          uint      `json:"rootCause,omitempty"`
+	DownDependents     []uint    `json:"downDependents,omitempty"`
+	OwnerTeam          string    `json:"ownerTeam,omitempty"`
+	Test               bool      `json:"test,omitempty"`
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	if w.payload != nil {
+		return w.render(ctx, event)
+	}
+
+	payload := webhookPayload{
+		MonitorID:          event.MonitorID,
+		Address:            event.Address,
+		Previous:           event.Previous.String(),
+		Current:            event.Current.String(),
+		Error:              event.ErrorMsg,
+		Timestamp:          event.Time,
+		SSLExpiryThreshold: event.SSLExpiryThreshold,
+		RootCause:          event.RootCause,
+		DownDependents:     event.DownDependents,
+		OwnerTeam:          event.OwnerTeam,
+	}
+	if event.Type != monitor.TypeUnknown {
+		payload.Type = event.Type.String()
+	}
+	if event.Reason != monitor.ReasonNone {
+		payload.Reason = event.Reason.String()
+	}
+	if event.Downtime > 0 {
+		payload.Downtime = event.Downtime.Round(time.Second).String()
+	}
+	return w.post(ctx, payload)
+}
+
+// TestNotify posts a payload flagged as a test, for monitor ID zero. With a
+// payload template, it's rendered for an empty event of monitor ID zero.
+func (w *WebhookNotifier) TestNotify(ctx context.Context) error {
+	if w.payload != nil {
+		return w.render(ctx, Event{Time: time.Now()})
+	}
+	return w.post(ctx, webhookPayload{Current: "Test", Timestamp: time.Now(), Test: true})
+}
+
+// render posts the payload template executed with event, which must be
+// valid JSON.
+func (w *WebhookNotifier) render(ctx context.Context, event Event) error {
+	var body bytes.Buffer
+	if err := w.payload.Execute(&body, event); err != nil {
+		return fmt.Errorf("failed to render webhook payload: %w", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return fmt.Errorf("webhook payload template rendered invalid JSON: %s", body.Bytes())
+	}
+	return w.postBody(ctx, body.Bytes())
+}
+
+// post sends payload, retrying server errors and failed requests until
+// webhookAttempts were made or ctx is done.
+func (w *WebhookNotifier) post(ctx context.Context, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return w.postBody(ctx, body)
+}
+
+func (w *WebhookNotifier) postBody(ctx context.Context, body []byte) error {
+	return retry(ctx, webhookAttempts, webhookBackoff, func() (bool, error) {
+		return w.send(ctx, body)
+	})
+}
+
+// send posts body once, and reports whether a failure is worth retrying.
+func (w *WebhookNotifier) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return resp.StatusCode >= 500, fmt.Errorf("webhook responded %d: %s", resp.StatusCode, respBody)
+	}
+	return false, nil
+}
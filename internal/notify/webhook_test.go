@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shraga/internal/monitor"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var payload map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier := lo.Must(NewWebhookNotifier(ts.URL, map[string]string{"Authorization": "Bearer secret"}, ""))
+	require.NoError(t, notifier.Notify(context.Background(), Event{
+		MonitorID: 7,
+		Type:      monitor.TypeHTTP,
+		Address:   "https://example.com/health",
+		Previous:  monitor.ResultUp,
+		Current:   monitor.ResultDown,
+		Reason:    monitor.ReasonTimeout,
+		ErrorMsg:  "context deadline exceeded",
+		Time:      time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+	}))
+
+	assert.Equal(t, map[string]any{
+		"monitorId": float64(7),
+		"type":      "HTTP",
+		"address":   "https://example.com/health",
+		"previous":  "Up",
+		"current":   "Down",
+		"reason":    "Timeout",
+		"error":     "context deadline exceeded",
+		"timestamp": "2020-01-01T12:00:00Z",
+	}, payload)
+}
+
+func TestWebhookNotifier_PayloadTemplate(t *testing.T) {
+	var payload map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer ts.Close()
+
+	notifier, err := NewWebhookNotifier(ts.URL, nil, `{"text": {{json .ErrorMsg}}, "state": "{{.Current}}", "id": {{.MonitorID}}}`)
+	require.NoError(t, err)
+	require.NoError(t, notifier.Notify(context.Background(), Event{MonitorID: 7, Current: monitor.ResultDown, ErrorMsg: `said "no"`}))
+	assert.Equal(t, map[string]any{"text": `said "no"`, "state": "Down", "id": float64(7)}, payload)
+
+	notifier, err = NewWebhookNotifier(ts.URL, nil, `{"text": {{.ErrorMsg}}}`)
+	require.NoError(t, err)
+	assert.ErrorContains(t, notifier.Notify(context.Background(), Event{ErrorMsg: "refused"}), "webhook payload template rendered invalid JSON")
+
+	_, err = NewWebhookNotifier(ts.URL, nil, `{{.MonitorID`)
+	assert.ErrorContains(t, err, "invalid webhook payload template")
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	var attempts atomic.Int32
+	status := http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < webhookAttempts {
+			w.WriteHeader(status)
+		}
+	}))
+	defer ts.Close()
+
+	notifier := lo.Must(NewWebhookNotifier(ts.URL, nil, ""))
+	assert.NoError(t, notifier.Notify(context.Background(), Event{MonitorID: 7}))
+	assert.Equal(t, int32(webhookAttempts), attempts.Load())
+
+	// Client errors aren't retried
+	attempts.Store(0)
+	status = http.StatusBadRequest
+	assert.EqualError(t, notifier.Notify(context.Background(), Event{MonitorID: 7}), "webhook responded 400: ")
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestWebhookNotifier_GivesUpAtDeadline(t *testing.T) {
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := lo.Must(NewWebhookNotifier(ts.URL, nil, "")).Notify(ctx, Event{MonitorID: 7})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "webhook responded 502")
+	assert.Equal(t, int32(1), attempts.Load(), "the backoff outlasts the deadline")
+}